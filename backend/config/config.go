@@ -0,0 +1,428 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds every setting of the server. Settings are read from, in increasing order of precedence: the defaults,
+// the YAML config file, environment variables and command line flags.
+type Config struct {
+	// Listen address as host:port
+	Address string `yaml:"address"`
+	// Origins the frontend runs on, "https://*.example.com" allows every subdomain and "*" allows all origins
+	AllowedOrigins []string `yaml:"allowed_origins"`
+	// How long browsers cache the answer to a preflight request
+	CorsMaxAge time.Duration `yaml:"cors_max_age"`
+	LogLevel   string        `yaml:"log_level"`
+	// text or json
+	LogFormat string    `yaml:"log_format"`
+	Timeouts  Timeouts  `yaml:"timeouts"`
+	Database  Database  `yaml:"database"`
+	Tokens    Tokens    `yaml:"tokens"`
+	RateLimit RateLimit `yaml:"rate_limit"`
+	// Serve GET /debug, which exposes the whole database to admins
+	Debug bool `yaml:"debug"`
+	// Names of the users that are made admin at startup
+	Admins []string `yaml:"admins"`
+
+	// Only a flag, compacting is a one-off command rather than a setting
+	Compact bool `yaml:"-"`
+}
+
+type Timeouts struct {
+	// Reading a request, including its body
+	Read time.Duration `yaml:"read"`
+	// Handling a request and writing its response
+	Write time.Duration `yaml:"write"`
+	// Keeping an idle connection open for the next request
+	Idle time.Duration `yaml:"idle"`
+	// Draining in-flight requests when the server stops
+	Shutdown time.Duration `yaml:"shutdown"`
+	// Still accepting requests after readiness failed, until supervisors stopped sending new ones
+	DrainDelay time.Duration `yaml:"drain_delay"`
+}
+
+type Database struct {
+	// memory or sqlite
+	Type string `yaml:"type"`
+	// SQLite database file
+	Path string `yaml:"path"`
+	// Files to persist the in-memory database to, both optional
+	Snapshot         string        `yaml:"snapshot"`
+	SnapshotInterval time.Duration `yaml:"snapshot_interval"`
+	Journal          string        `yaml:"journal"`
+}
+
+type Tokens struct {
+	// database or signed
+	Type string `yaml:"type"`
+	// Signing keys as id:secret pairs separated by commas, the first one signs new tokens
+	Keys                 string        `yaml:"keys"`
+	AccessTokenLifetime  time.Duration `yaml:"access_token_lifetime"`
+	RefreshTokenLifetime time.Duration `yaml:"refresh_token_lifetime"`
+	// Also accept tokens without the Bearer scheme, for clients that predate it
+	BareTokens bool `yaml:"bare_tokens"`
+}
+
+type RateLimit struct {
+	// Sustained requests per second per client on every route without its own limit, 0 disables the default limit
+	RequestsPerSecond float64 `yaml:"requests_per_second"`
+	// Requests a client can make at once before being limited
+	Burst int `yaml:"burst"`
+	// Limit replacing the default on POST, PUT, PATCH and DELETE routes without their own limit
+	Writes RouteRateLimit `yaml:"writes"`
+	// Limits replacing the default and write limits on specific routes, by pattern like "POST /users/login"
+	Routes map[string]RouteRateLimit `yaml:"routes"`
+}
+
+type RouteRateLimit struct {
+	// 0 disables rate limiting on the route
+	RequestsPerSecond float64 `yaml:"requests_per_second"`
+	Burst             int     `yaml:"burst"`
+}
+
+var (
+	logLevels  = []string{"debug", "info", "warn", "error"}
+	logFormats = []string{"text", "json"}
+	// A method and path, the way routes are registered
+	routePattern = regexp.MustCompile(`^(GET|POST|PUT|PATCH|DELETE) /\S*$`)
+)
+
+func Default() Config {
+	return Config{
+		Address:        "localhost:8080",
+		AllowedOrigins: []string{"*"},
+		CorsMaxAge:     10 * time.Minute,
+		LogLevel:       "info",
+		LogFormat:      "text",
+		Timeouts: Timeouts{
+			Read:       10 * time.Second,
+			Write:      30 * time.Second,
+			Idle:       2 * time.Minute,
+			Shutdown:   15 * time.Second,
+			DrainDelay: 5 * time.Second,
+		},
+		Database: Database{
+			Type:             "memory",
+			Path:             "tasks.db",
+			SnapshotInterval: time.Minute,
+		},
+		Tokens: Tokens{
+			Type:                 "database",
+			AccessTokenLifetime:  time.Hour,
+			RefreshTokenLifetime: 30 * 24 * time.Hour,
+			BareTokens:           true,
+		},
+		RateLimit: RateLimit{
+			Burst:  20,
+			Writes: RouteRateLimit{RequestsPerSecond: 5, Burst: 20},
+			// Guessing passwords and creating accounts in bulk stays slow, even with the default limit disabled
+			Routes: map[string]RouteRateLimit{
+				"POST /users/login":    {RequestsPerSecond: 0.2, Burst: 5},
+				"POST /users/register": {RequestsPerSecond: 0.05, Burst: 3},
+			},
+		},
+	}
+}
+
+// setting is configurable by a flag and environment variable, env is empty for flag only settings.
+type setting struct {
+	flag   string
+	env    string
+	usage  string
+	isBool bool
+	set    func(config *Config, value string) error
+}
+
+var settings = []setting{
+	{flag: "address", env: "TASKS_ADDRESS", usage: "listen address as host:port", set: func(c *Config, v string) error { c.Address = v; return nil }},
+	{flag: "allowed-origins", env: "TASKS_ALLOWED_ORIGINS", usage: "origins allowed to call the API separated by commas, https://*.example.com allows every subdomain and * all origins", set: func(c *Config, v string) error { c.AllowedOrigins = splitList(v); return nil }},
+	{flag: "cors-max-age", env: "TASKS_CORS_MAX_AGE", usage: "how long browsers cache the answer to a preflight request", set: durationSetter(func(c *Config) *time.Duration { return &c.CorsMaxAge })},
+	{flag: "log-level", env: "TASKS_LOG_LEVEL", usage: "debug, info, warn or error", set: func(c *Config, v string) error { c.LogLevel = v; return nil }},
+	{flag: "log-format", env: "TASKS_LOG_FORMAT", usage: "text or json", set: func(c *Config, v string) error { c.LogFormat = v; return nil }},
+	{flag: "read-timeout", env: "TASKS_READ_TIMEOUT", usage: "maximum duration to read a request", set: durationSetter(func(c *Config) *time.Duration { return &c.Timeouts.Read })},
+	{flag: "write-timeout", env: "TASKS_WRITE_TIMEOUT", usage: "maximum duration to handle a request and write its response", set: durationSetter(func(c *Config) *time.Duration { return &c.Timeouts.Write })},
+	{flag: "idle-timeout", env: "TASKS_IDLE_TIMEOUT", usage: "how long idle connections are kept open", set: durationSetter(func(c *Config) *time.Duration { return &c.Timeouts.Idle })},
+	{flag: "shutdown-timeout", env: "TASKS_SHUTDOWN_TIMEOUT", usage: "how long in-flight requests can finish when the server stops", set: durationSetter(func(c *Config) *time.Duration { return &c.Timeouts.Shutdown })},
+	{flag: "drain-delay", env: "TASKS_DRAIN_DELAY", usage: "how long the server keeps accepting requests after readiness fails when it stops", set: durationSetter(func(c *Config) *time.Duration { return &c.Timeouts.DrainDelay })},
+	{flag: "database", env: "TASKS_DATABASE", usage: "database backend: memory or sqlite", set: func(c *Config, v string) error { c.Database.Type = v; return nil }},
+	{flag: "database-path", env: "TASKS_DATABASE_PATH", usage: "SQLite database file", set: func(c *Config, v string) error { c.Database.Path = v; return nil }},
+	{flag: "snapshot", env: "TASKS_SNAPSHOT", usage: "JSON file to persist the in-memory database to", set: func(c *Config, v string) error { c.Database.Snapshot = v; return nil }},
+	{flag: "snapshot-interval", env: "TASKS_SNAPSHOT_INTERVAL", usage: "how often the in-memory database is saved to the snapshot", set: durationSetter(func(c *Config) *time.Duration { return &c.Database.SnapshotInterval })},
+	{flag: "journal", env: "TASKS_JOURNAL", usage: "JSON lines file recording every change to the in-memory database", set: func(c *Config, v string) error { c.Database.Journal = v; return nil }},
+	{flag: "tokens", env: "TASKS_TOKENS", usage: "access tokens: database or signed", set: func(c *Config, v string) error { c.Tokens.Type = v; return nil }},
+	{flag: "token-keys", env: "TASKS_TOKEN_KEYS", usage: "signing keys as id:secret pairs separated by commas, the first one signs new tokens", set: func(c *Config, v string) error { c.Tokens.Keys = v; return nil }},
+	{flag: "access-token-lifetime", env: "TASKS_ACCESS_TOKEN_LIFETIME", usage: "how long access tokens are valid", set: durationSetter(func(c *Config) *time.Duration { return &c.Tokens.AccessTokenLifetime })},
+	{flag: "refresh-token-lifetime", env: "TASKS_REFRESH_TOKEN_LIFETIME", usage: "how long refresh tokens are valid", set: durationSetter(func(c *Config) *time.Duration { return &c.Tokens.RefreshTokenLifetime })},
+	{flag: "bare-tokens", env: "TASKS_BARE_TOKENS", usage: "also accept tokens without the Bearer scheme, for clients that predate it", isBool: true, set: boolSetter(func(c *Config) *bool { return &c.Tokens.BareTokens })},
+	{flag: "rate-limit", env: "TASKS_RATE_LIMIT", usage: "requests per second per client on routes without their own limit, 0 disables this default limit", set: floatSetter(func(c *Config) *float64 { return &c.RateLimit.RequestsPerSecond })},
+	{flag: "rate-limit-burst", env: "TASKS_RATE_LIMIT_BURST", usage: "requests a client can make at once before being rate limited", set: intSetter(func(c *Config) *int { return &c.RateLimit.Burst })},
+	{flag: "write-rate-limit", env: "TASKS_WRITE_RATE_LIMIT", usage: "writes per second per client on routes without their own limit, 0 disables this limit", set: floatSetter(func(c *Config) *float64 { return &c.RateLimit.Writes.RequestsPerSecond })},
+	{flag: "write-rate-limit-burst", env: "TASKS_WRITE_RATE_LIMIT_BURST", usage: "writes a client can make at once before being rate limited", set: intSetter(func(c *Config) *int { return &c.RateLimit.Writes.Burst })},
+	{flag: "debug", env: "TASKS_DEBUG", usage: "serve GET /debug to admins", isBool: true, set: boolSetter(func(c *Config) *bool { return &c.Debug })},
+	{flag: "admins", env: "TASKS_ADMINS", usage: "names of the users to make admin at startup separated by commas", set: func(c *Config, v string) error { c.Admins = splitList(v); return nil }},
+	{flag: "compact", usage: "collapse the journal into the snapshot and exit", isBool: true, set: boolSetter(func(c *Config) *bool { return &c.Compact })},
+}
+
+// Load reads the configuration from the command line arguments (without the program name), the environment and the
+// config file passed with -config or TASKS_CONFIG.
+func Load(args []string, lookupEnv func(string) (string, bool)) (*Config, error) {
+	flags := flag.NewFlagSet("tasks", flag.ContinueOnError)
+	configPath := flags.String("config", "", "YAML config file (env TASKS_CONFIG)")
+
+	// Flags are applied last, so only record them while parsing
+	flagValues := make(map[string]string)
+	for _, s := range settings {
+		usage := s.usage
+		if s.env != "" {
+			usage = fmt.Sprintf("%s (env %s)", s.usage, s.env)
+		}
+		record := func(value string) error {
+			flagValues[s.flag] = value
+			return nil
+		}
+		if s.isBool {
+			flags.BoolFunc(s.flag, usage, record)
+		} else {
+			flags.Func(s.flag, usage, record)
+		}
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if flags.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument %s", flags.Arg(0))
+	}
+
+	config := Default()
+
+	path, found := lookupEnv("TASKS_CONFIG")
+	if *configPath != "" {
+		path, found = *configPath, true
+	}
+	if found && path != "" {
+		if err := config.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, s := range settings {
+		if s.env == "" {
+			continue
+		}
+		if value, exists := lookupEnv(s.env); exists {
+			if err := s.set(&config, value); err != nil {
+				return nil, fmt.Errorf("%s: %w", s.env, err)
+			}
+		}
+	}
+	for _, s := range settings {
+		if value, exists := flagValues[s.flag]; exists {
+			if err := s.set(&config, value); err != nil {
+				return nil, fmt.Errorf("-%s: %w", s.flag, err)
+			}
+		}
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// loadFile overrides the settings present in the YAML file at path, and rejects unknown settings to catch typos.
+func (c *Config) loadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	// An empty file is a valid config without any overrides
+	if err = decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Validate returns all invalid settings at once, so they can be fixed in one go.
+func (c *Config) Validate() error {
+	var errs []error
+	if _, _, err := net.SplitHostPort(c.Address); err != nil {
+		errs = append(errs, fmt.Errorf("address %s must be host:port", c.Address))
+	}
+	if len(c.AllowedOrigins) == 0 {
+		errs = append(errs, errors.New("at least one allowed origin is required"))
+	}
+	for _, origin := range c.AllowedOrigins {
+		if origin != "*" && !isOrigin(origin) && !isOriginPattern(origin) {
+			errs = append(errs, fmt.Errorf("allowed origin %s must be *, scheme://host[:port] or scheme://*.host[:port]", origin))
+		}
+	}
+	if c.CorsMaxAge < 0 {
+		errs = append(errs, errors.New("cors max age can't be negative"))
+	}
+	if !slices.Contains(logLevels, c.LogLevel) {
+		errs = append(errs, fmt.Errorf("log level %s must be one of %s", c.LogLevel, strings.Join(logLevels, ", ")))
+	}
+	if !slices.Contains(logFormats, c.LogFormat) {
+		errs = append(errs, fmt.Errorf("log format %s must be one of %s", c.LogFormat, strings.Join(logFormats, ", ")))
+	}
+
+	if c.Timeouts.Read <= 0 || c.Timeouts.Write <= 0 || c.Timeouts.Idle <= 0 || c.Timeouts.Shutdown <= 0 {
+		errs = append(errs, errors.New("timeouts must be positive"))
+	}
+	if c.Timeouts.DrainDelay < 0 {
+		errs = append(errs, errors.New("drain delay can't be negative"))
+	}
+
+	switch c.Database.Type {
+	case "memory":
+		if c.Database.Snapshot != "" && c.Database.SnapshotInterval <= 0 {
+			errs = append(errs, errors.New("snapshot interval must be positive"))
+		}
+	case "sqlite":
+		if c.Database.Path == "" {
+			errs = append(errs, errors.New("sqlite database requires a path"))
+		}
+		if c.Database.Snapshot != "" || c.Database.Journal != "" {
+			errs = append(errs, errors.New("snapshot and journal only apply to the memory database"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown database %s, must be memory or sqlite", c.Database.Type))
+	}
+	if c.Compact && (c.Database.Snapshot == "" || c.Database.Journal == "") {
+		errs = append(errs, errors.New("compacting requires both a snapshot and a journal"))
+	}
+
+	switch c.Tokens.Type {
+	case "database":
+	case "signed":
+		if c.Tokens.Keys == "" {
+			errs = append(errs, errors.New("signed tokens require token keys"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown tokens %s, must be database or signed", c.Tokens.Type))
+	}
+	if c.Tokens.AccessTokenLifetime <= 0 {
+		errs = append(errs, errors.New("access token lifetime must be positive"))
+	}
+	if c.Tokens.RefreshTokenLifetime < c.Tokens.AccessTokenLifetime {
+		errs = append(errs, errors.New("refresh token lifetime must be at least the access token lifetime"))
+	}
+
+	if c.RateLimit.RequestsPerSecond < 0 {
+		errs = append(errs, errors.New("rate limit can't be negative"))
+	}
+	if c.RateLimit.RequestsPerSecond > 0 && c.RateLimit.Burst < 1 {
+		errs = append(errs, errors.New("rate limit burst must be at least 1"))
+	}
+	if c.RateLimit.Writes.RequestsPerSecond < 0 {
+		errs = append(errs, errors.New("write rate limit can't be negative"))
+	}
+	if c.RateLimit.Writes.RequestsPerSecond > 0 && c.RateLimit.Writes.Burst < 1 {
+		errs = append(errs, errors.New("write rate limit burst must be at least 1"))
+	}
+	var patterns []string
+	for pattern := range c.RateLimit.Routes {
+		patterns = append(patterns, pattern)
+	}
+	slices.Sort(patterns)
+	for _, pattern := range patterns {
+		limit := c.RateLimit.Routes[pattern]
+		if !routePattern.MatchString(pattern) {
+			errs = append(errs, fmt.Errorf("rate limited route %s must be a method and path, like POST /users/login", pattern))
+		}
+		if limit.RequestsPerSecond < 0 {
+			errs = append(errs, fmt.Errorf("rate limit of %s can't be negative", pattern))
+		}
+		if limit.RequestsPerSecond > 0 && limit.Burst < 1 {
+			errs = append(errs, fmt.Errorf("rate limit burst of %s must be at least 1", pattern))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func isOrigin(origin string) bool {
+	parsed, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	// An origin has no path, query or credentials
+	return (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != "" &&
+		parsed.Scheme+"://"+parsed.Host == origin
+}
+
+// isOriginPattern reports whether pattern is an origin with "*." in front of the host, which matches every subdomain.
+func isOriginPattern(pattern string) bool {
+	scheme, host, found := strings.Cut(pattern, "://*.")
+	return found && isOrigin(scheme+"://"+host)
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func durationSetter(field func(*Config) *time.Duration) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid duration %s", value)
+		}
+		*field(c) = duration
+		return nil
+	}
+}
+
+func boolSetter(field func(*Config) *bool) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %s", value)
+		}
+		*field(c) = parsed
+		return nil
+	}
+}
+
+func floatSetter(field func(*Config) *float64) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %s", value)
+		}
+		*field(c) = parsed
+		return nil
+	}
+}
+
+func intSetter(field func(*Config) *int) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid integer %s", value)
+		}
+		*field(c) = parsed
+		return nil
+	}
+}
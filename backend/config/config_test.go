@@ -0,0 +1,328 @@
+package config
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func fakeEnv(values map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, exists := values[key]
+		return value, exists
+	}
+}
+
+func writeConfigFile(t *testing.T, contents string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad_Defaults(t *testing.T) {
+	config, err := Load(nil, fakeEnv(nil))
+
+	assert.NoError(t, err)
+	assert.Equal(t, Default(), *config)
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	path := writeConfigFile(t, `
+address: localhost:7000
+allowed_origins: [http://localhost:5173]
+log_level: debug
+log_format: json
+database:
+  type: sqlite
+  path: file.db
+timeouts:
+  write: 1m
+tokens:
+  access_token_lifetime: 10m
+rate_limit:
+  requests_per_second: 5
+  writes:
+    requests_per_second: 2
+  routes:
+    POST /users/login:
+      requests_per_second: 1
+      burst: 2
+    POST /todos:
+      requests_per_second: 0.5
+      burst: 10
+`)
+
+	tests := []struct {
+		name     string
+		args     []string
+		env      map[string]string
+		expected func(config *Config)
+	}{
+		{
+			name: "Config file overrides defaults",
+			args: []string{"-config", path},
+			expected: func(c *Config) {
+				c.Address = "localhost:7000"
+				c.AllowedOrigins = []string{"http://localhost:5173"}
+				c.LogLevel = "debug"
+				c.LogFormat = "json"
+				c.Database.Type = "sqlite"
+				c.Database.Path = "file.db"
+				c.Timeouts.Write = time.Minute
+				c.Tokens.AccessTokenLifetime = 10 * time.Minute
+				c.RateLimit.RequestsPerSecond = 5
+				c.RateLimit.Writes.RequestsPerSecond = 2
+				fileRouteRateLimits(c)
+			},
+		},
+		{
+			name: "Environment overrides config file",
+			env: map[string]string{
+				"TASKS_CONFIG":                path,
+				"TASKS_ADDRESS":               "localhost:7001",
+				"TASKS_ALLOWED_ORIGINS":       "http://localhost:5173, https://*.example.com",
+				"TASKS_CORS_MAX_AGE":          "1h",
+				"TASKS_DRAIN_DELAY":           "0s",
+				"TASKS_ACCESS_TOKEN_LIFETIME": "15m",
+				"TASKS_BARE_TOKENS":           "false",
+				"TASKS_LOG_FORMAT":            "text",
+				"TASKS_ADMINS":                "jeroen, admin",
+				"TASKS_WRITE_RATE_LIMIT":      "1",
+			},
+			expected: func(c *Config) {
+				c.Address = "localhost:7001"
+				c.AllowedOrigins = []string{"http://localhost:5173", "https://*.example.com"}
+				c.CorsMaxAge = time.Hour
+				c.Timeouts.DrainDelay = 0
+				c.LogLevel = "debug"
+				c.Database.Type = "sqlite"
+				c.Database.Path = "file.db"
+				c.Timeouts.Write = time.Minute
+				c.Tokens.AccessTokenLifetime = 15 * time.Minute
+				c.Tokens.BareTokens = false
+				c.RateLimit.RequestsPerSecond = 5
+				c.RateLimit.Writes.RequestsPerSecond = 1
+				fileRouteRateLimits(c)
+				c.Admins = []string{"jeroen", "admin"}
+			},
+		},
+		{
+			name: "Flags override environment",
+			args: []string{"-config", path, "-address", "localhost:7002", "-bare-tokens", "-rate-limit", "0", "-write-rate-limit-burst", "40", "-debug"},
+			env: map[string]string{
+				"TASKS_ADDRESS":     "localhost:7001",
+				"TASKS_BARE_TOKENS": "false",
+				"TASKS_LOG_LEVEL":   "warn",
+			},
+			expected: func(c *Config) {
+				c.Address = "localhost:7002"
+				c.Debug = true
+				c.AllowedOrigins = []string{"http://localhost:5173"}
+				c.LogLevel = "warn"
+				c.LogFormat = "json"
+				c.Database.Type = "sqlite"
+				c.Database.Path = "file.db"
+				c.Timeouts.Write = time.Minute
+				c.Tokens.AccessTokenLifetime = 10 * time.Minute
+				c.RateLimit.Writes = RouteRateLimit{RequestsPerSecond: 2, Burst: 40}
+				fileRouteRateLimits(c)
+			},
+		},
+		{
+			name: "Config flag overrides environment",
+			args: []string{"-config", path},
+			env:  map[string]string{"TASKS_CONFIG": "missing.yaml"},
+			expected: func(c *Config) {
+				c.Address = "localhost:7000"
+				c.AllowedOrigins = []string{"http://localhost:5173"}
+				c.LogLevel = "debug"
+				c.LogFormat = "json"
+				c.Database.Type = "sqlite"
+				c.Database.Path = "file.db"
+				c.Timeouts.Write = time.Minute
+				c.Tokens.AccessTokenLifetime = 10 * time.Minute
+				c.RateLimit.RequestsPerSecond = 5
+				c.RateLimit.Writes.RequestsPerSecond = 2
+				fileRouteRateLimits(c)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := Load(tt.args, fakeEnv(tt.env))
+
+			expected := Default()
+			tt.expected(&expected)
+			assert.NoError(t, err)
+			assert.Equal(t, expected, *config)
+		})
+	}
+}
+
+func TestLoad_Errors(t *testing.T) {
+	tests := []struct {
+		name          string
+		args          []string
+		env           map[string]string
+		file          string
+		expectedError string
+	}{
+		{
+			name:          "Unknown flag",
+			args:          []string{"-unknown"},
+			expectedError: "flag provided but not defined: -unknown",
+		},
+		{
+			name:          "Unexpected argument",
+			args:          []string{"serve"},
+			expectedError: "unexpected argument serve",
+		},
+		{
+			name:          "Invalid duration in environment",
+			env:           map[string]string{"TASKS_ACCESS_TOKEN_LIFETIME": "an hour"},
+			expectedError: "TASKS_ACCESS_TOKEN_LIFETIME: invalid duration an hour",
+		},
+		{
+			name:          "Invalid boolean flag",
+			args:          []string{"-bare-tokens=maybe"},
+			expectedError: "-bare-tokens: invalid boolean maybe",
+		},
+		{
+			name:          "Missing config file",
+			env:           map[string]string{"TASKS_CONFIG": "missing.yaml"},
+			expectedError: "open missing.yaml: no such file or directory",
+		},
+		{
+			name:          "Unknown setting in config file",
+			file:          "adress: localhost:8080",
+			expectedError: "yaml: unmarshal errors:\n  line 1: field adress not found in type config.Config",
+		},
+		{
+			name:          "Invalid address",
+			args:          []string{"-address", "8080"},
+			expectedError: "address 8080 must be host:port",
+		},
+		{
+			name:          "Invalid origin",
+			args:          []string{"-allowed-origins", "localhost:5173"},
+			expectedError: "allowed origin localhost:5173 must be *, scheme://host[:port] or scheme://*.host[:port]",
+		},
+		{
+			name:          "Origin pattern with path",
+			args:          []string{"-allowed-origins", "https://*.example.com/app"},
+			expectedError: "allowed origin https://*.example.com/app must be *, scheme://host[:port] or scheme://*.host[:port]",
+		},
+		{
+			name:          "Negative cors max age",
+			args:          []string{"-cors-max-age", "-1s"},
+			expectedError: "cors max age can't be negative",
+		},
+		{
+			name:          "Origin with path",
+			args:          []string{"-allowed-origins", "http://localhost:5173/app"},
+			expectedError: "allowed origin http://localhost:5173/app must be *, scheme://host[:port] or scheme://*.host[:port]",
+		},
+		{
+			name:          "Missing origins",
+			args:          []string{"-allowed-origins", ""},
+			expectedError: "at least one allowed origin is required",
+		},
+		{
+			name:          "Zero timeout",
+			args:          []string{"-shutdown-timeout", "0s"},
+			expectedError: "timeouts must be positive",
+		},
+		{
+			name:          "Negative drain delay",
+			args:          []string{"-drain-delay", "-1s"},
+			expectedError: "drain delay can't be negative",
+		},
+		{
+			name:          "Unknown database",
+			args:          []string{"-database", "postgres"},
+			expectedError: "unknown database postgres, must be memory or sqlite",
+		},
+		{
+			name:          "Snapshot with sqlite",
+			args:          []string{"-database", "sqlite", "-snapshot", "tasks.json"},
+			expectedError: "snapshot and journal only apply to the memory database",
+		},
+		{
+			name:          "Compact without journal",
+			args:          []string{"-compact", "-snapshot", "tasks.json"},
+			expectedError: "compacting requires both a snapshot and a journal",
+		},
+		{
+			name:          "Signed tokens without keys",
+			args:          []string{"-tokens", "signed"},
+			expectedError: "signed tokens require token keys",
+		},
+		{
+			name:          "Refresh token lifetime too short",
+			args:          []string{"-access-token-lifetime", "2h", "-refresh-token-lifetime", "1h"},
+			expectedError: "refresh token lifetime must be at least the access token lifetime",
+		},
+		{
+			name:          "Rate limit without burst",
+			args:          []string{"-rate-limit", "10", "-rate-limit-burst", "0"},
+			expectedError: "rate limit burst must be at least 1",
+		},
+		{
+			name:          "Negative write rate limit",
+			env:           map[string]string{"TASKS_WRITE_RATE_LIMIT": "-1"},
+			expectedError: "write rate limit can't be negative",
+		},
+		{
+			name:          "Write rate limit without burst",
+			args:          []string{"-write-rate-limit-burst", "0"},
+			expectedError: "write rate limit burst must be at least 1",
+		},
+		{
+			name:          "Rate limited route without method",
+			file:          "rate_limit:\n  routes:\n    /users/login:\n      requests_per_second: 1\n      burst: 1\n",
+			expectedError: "rate limited route /users/login must be a method and path, like POST /users/login",
+		},
+		{
+			name:          "Rate limited route without burst",
+			file:          "rate_limit:\n  routes:\n    POST /todos:\n      requests_per_second: 1\n",
+			expectedError: "rate limit burst of POST /todos must be at least 1",
+		},
+		{
+			name:          "All invalid settings at once",
+			args:          []string{"-log-level", "verbose", "-log-format", "logfmt", "-tokens", "jwt", "-access-token-lifetime", "0s"},
+			expectedError: "log level verbose must be one of debug, info, warn, error\nlog format logfmt must be one of text, json\nunknown tokens jwt, must be database or signed\naccess token lifetime must be positive",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := tt.args
+			if tt.file != "" {
+				args = append(args, "-config", writeConfigFile(t, tt.file))
+			}
+
+			config, err := Load(args, fakeEnv(tt.env))
+
+			assert.Nil(t, config)
+			assert.ErrorContains(t, err, tt.expectedError)
+		})
+	}
+}
+
+// fileRouteRateLimits sets the route limits of the config file in TestLoad_Precedence, which add to the default ones.
+func fileRouteRateLimits(c *Config) {
+	c.RateLimit.Routes["POST /users/login"] = RouteRateLimit{RequestsPerSecond: 1, Burst: 2}
+	c.RateLimit.Routes["POST /todos"] = RouteRateLimit{RequestsPerSecond: 0.5, Burst: 10}
+}
+
+func TestLoad_EmptyConfigFile(t *testing.T) {
+	config, err := Load([]string{"-config", writeConfigFile(t, "")}, fakeEnv(nil))
+
+	assert.NoError(t, err)
+	assert.Equal(t, Default(), *config)
+}
@@ -2,36 +2,71 @@ package db
 
 import (
 	"backend/util"
-	"errors"
+	"maps"
+	"os"
 	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 )
 
 type Database interface {
-	CreateUser(name string) *User
+	CreateUser(name string, passwordHash string) (*User, error)
 	GetUser(userId string) (*User, error)
-	CreateAccessToken(accountNumber string) *AccessToken
+	GetUserByName(name string) (*User, error)
+	UpdateUser(user *User) (*User, error)
+	GetUsers() (*[]User, error)
+	DeleteUser(userId string) error
+	CreateAccessToken(accountNumber string, lifetime time.Duration) (*AccessToken, error)
 	GetAccessToken(token string) (*AccessToken, error)
-	CreateTodoList() *TodoList
-	CreateTodo(listId string, description string, user string) *TodoItem
+	DeleteAccessToken(token string) error
+	CreateRefreshToken(accessToken *AccessToken, lifetime time.Duration) (*RefreshToken, error)
+	GetRefreshToken(token string) (*RefreshToken, error)
+	DeleteRefreshToken(token string) error
+	DeleteUserTokens(userId string) error
+	CreateTodoList(ownerId string, title string, description string) (*TodoList, error)
+	UpdateTodoList(todoList *TodoList) (*TodoList, error)
+	GetTodoList(listId string) (*TodoList, error)
+	GetTodoLists(userId string) (*[]TodoList, error)
+	AddTodoListMember(listId string, userId string) error
+	RemoveTodoListMember(listId string, userId string) error
+	TransferTodoList(listId string, ownerId string) error
+	CreateTodo(listId string, description string, user string) (*TodoItem, error)
 	UpdateTodo(todo *TodoItem) (*TodoItem, error)
 	GetTodo(todoId string) (*TodoItem, error)
 	GetTodos(listId string) (*[]TodoItem, error)
+	DeleteTodo(todoId string) error
+	DeleteTodoList(listId string) error
+	Stats() (*Stats, error)
+	// Dump copies the entire database into an InMemoryDatabase, to inspect its contents
+	Dump() (*InMemoryDatabase, error)
+	// Ping fails when the database can't be written to
+	Ping() error
 }
 
+// InMemoryDatabase is never serialized as a whole, as it holds tokens and password hashes. Snapshots and /debug use
+// their own types instead.
 type InMemoryDatabase struct {
-	Users         map[string]User
-	AccessTokens  map[string]AccessToken
-	TodoLists     map[string]TodoList
-	TodoItems     map[string]TodoItem
-	TodoItemOrder []string
+	Users         map[string]User         `json:"-"`
+	AccessTokens  map[string]AccessToken  `json:"-"`
+	RefreshTokens map[string]RefreshToken `json:"-"`
+	TodoLists     map[string]TodoList     `json:"-"`
+	TodoItems     map[string]TodoItem     `json:"-"`
+	TodoItemOrder []string                `json:"-"`
 	currentTime   util.CurrentTime
 	generateUuid  util.GenerateUuid
+	// Handlers run concurrently, so every method must hold the mutex while touching the maps
+	mutex sync.RWMutex
+	// Optional, records every mutation so it can be replayed after a restart
+	journal *os.File
 }
 
 func CreateDatabase() Database {
 	return &InMemoryDatabase{
 		Users:         make(map[string]User),
 		AccessTokens:  make(map[string]AccessToken),
+		RefreshTokens: make(map[string]RefreshToken),
 		TodoLists:     make(map[string]TodoList),
 		TodoItems:     make(map[string]TodoItem),
 		TodoItemOrder: []string{},
@@ -40,10 +75,11 @@ func CreateDatabase() Database {
 	}
 }
 
-func TestDatabase(generateTime util.CurrentTime, generateUuid util.GenerateUuid) InMemoryDatabase {
-	return InMemoryDatabase{
+func TestDatabase(generateTime util.CurrentTime, generateUuid util.GenerateUuid) *InMemoryDatabase {
+	return &InMemoryDatabase{
 		Users:         make(map[string]User),
 		AccessTokens:  make(map[string]AccessToken),
+		RefreshTokens: make(map[string]RefreshToken),
 		TodoLists:     make(map[string]TodoList),
 		TodoItems:     make(map[string]TodoItem),
 		TodoItemOrder: make([]string, 1000),
@@ -52,100 +88,414 @@ func TestDatabase(generateTime util.CurrentTime, generateUuid util.GenerateUuid)
 	}
 }
 
+// now returns the current time in UTC, which is how SQLite returns timestamps, so both databases serialize them alike.
+func (d *InMemoryDatabase) now() time.Time {
+	return d.currentTime().UTC()
+}
+
 const accessTokenRegex = `^tkn_[23456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz]{22}$`
+const refreshTokenRegex = `^rtk_[23456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz]{22}$`
 const listIdRegex = `^lst_[23456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz]{22}$`
 const todoIdRegex = `^tdo_[23456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz]{22}$`
 
-func (d *InMemoryDatabase) CreateUser(name string) *User {
+// CreateUser fails when the name is already taken, as users log in with their name.
+func (d *InMemoryDatabase) CreateUser(name string, passwordHash string) (*User, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if _, exists := d.findUserByName(name); exists {
+		return nil, ErrUserNameTaken
+	}
+
 	user := User{
-		Id:   d.generateUuid("usr"),
-		Name: name,
+		Id:           d.generateUuid("usr"),
+		Name:         name,
+		PasswordHash: passwordHash,
+	}
+	if err := d.write(journalEntry{Operation: createUserOperation, User: &user}); err != nil {
+		return nil, err
 	}
-	d.Users[user.Id] = user
-	return &user
+	return &user, nil
 }
 
 func (d *InMemoryDatabase) GetUser(userId string) (*User, error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
 	user, exists := d.Users[userId]
 	if !exists {
-		return nil, errors.New("user not found")
+		return nil, ErrUserNotFound
 	}
 	return &user, nil
 }
 
-func (d *InMemoryDatabase) CreateAccessToken(accountNumber string) *AccessToken {
+func (d *InMemoryDatabase) GetUserByName(name string) (*User, error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	user, exists := d.findUserByName(name)
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+	return &user, nil
+}
+
+// UpdateUser fails when the user is renamed to a name that is already taken.
+func (d *InMemoryDatabase) UpdateUser(user *User) (*User, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if _, exists := d.Users[user.Id]; !exists {
+		return nil, ErrUserNotFound
+	}
+	if other, exists := d.findUserByName(user.Name); exists && other.Id != user.Id {
+		return nil, ErrUserNameTaken
+	}
+	if err := d.write(journalEntry{Operation: updateUserOperation, User: user}); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// GetUsers returns every user, sorted by name.
+func (d *InMemoryDatabase) GetUsers() (*[]User, error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	users := []User{}
+	for _, user := range d.Users {
+		users = append(users, user)
+	}
+	slices.SortFunc(users, compareUsers)
+	return &users, nil
+}
+
+// DeleteUser also deletes their tokens and memberships. Users that still own todo lists can't be deleted, transfer
+// the lists first. Their todos are kept.
+func (d *InMemoryDatabase) DeleteUser(userId string) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if _, exists := d.Users[userId]; !exists {
+		return ErrUserNotFound
+	}
+	for _, todoList := range d.TodoLists {
+		if todoList.OwnerId == userId {
+			return ErrUserOwnsTodoLists
+		}
+	}
+	return d.write(journalEntry{Operation: deleteUserOperation, UserId: userId})
+}
+
+// findUserByName expects the caller to hold the lock.
+func (d *InMemoryDatabase) findUserByName(name string) (User, bool) {
+	for _, user := range d.Users {
+		if user.Name == name {
+			return user, true
+		}
+	}
+	return User{}, false
+}
+
+func (d *InMemoryDatabase) CreateAccessToken(accountNumber string, lifetime time.Duration) (*AccessToken, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	now := d.now()
 	accessToken := AccessToken{
-		UserId: accountNumber,
-		Token:  d.generateUuid("tkn"),
+		UserId:    accountNumber,
+		Token:     d.generateUuid("tkn"),
+		IssuedAt:  now,
+		ExpiresAt: now.Add(lifetime),
 	}
-	d.AccessTokens[accessToken.Token] = accessToken
-	return &accessToken
+	if err := d.write(journalEntry{Operation: createAccessTokenOperation, AccessToken: &accessToken}); err != nil {
+		return nil, err
+	}
+	return &accessToken, nil
 }
 
+// GetAccessToken rejects expired tokens, tokens without an expiry never were valid.
 func (d *InMemoryDatabase) GetAccessToken(token string) (*AccessToken, error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
 	if !regexp.MustCompile(accessTokenRegex).MatchString(token) {
-		return nil, errors.New("invalid access token")
+		return nil, ErrInvalidAccessToken
 	}
 	accessToken, exists := d.AccessTokens[token]
 	if !exists {
-		return nil, errors.New("user not found")
+		return nil, ErrInvalidAccessToken
+	}
+	if !d.now().Before(accessToken.ExpiresAt) {
+		return nil, ErrAccessTokenExpired
 	}
 	return &accessToken, nil
 }
 
-func (d *InMemoryDatabase) CreateTodoList() *TodoList {
+// DeleteAccessToken also deletes the refresh token handed out with it, ending the session.
+// Signed access tokens aren't stored, so only their refresh token is deleted.
+func (d *InMemoryDatabase) DeleteAccessToken(token string) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	_, exists := d.AccessTokens[token]
+	for _, refreshToken := range d.RefreshTokens {
+		exists = exists || refreshToken.AccessToken == token
+	}
+	if !exists {
+		return ErrInvalidAccessToken
+	}
+	return d.write(journalEntry{Operation: deleteAccessTokenOperation, Id: token})
+}
+
+// CreateRefreshToken also deletes the expired tokens. Every session starts with a refresh token, also with signed access
+// tokens, so they don't pile up.
+func (d *InMemoryDatabase) CreateRefreshToken(accessToken *AccessToken, lifetime time.Duration) (*RefreshToken, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	now := d.now()
+	if err := d.deleteExpiredTokens(now); err != nil {
+		return nil, err
+	}
+	refreshToken := RefreshToken{
+		UserId:      accessToken.UserId,
+		Token:       d.generateUuid("rtk"),
+		AccessToken: accessToken.Token,
+		IssuedAt:    now,
+		ExpiresAt:   now.Add(lifetime),
+	}
+	if err := d.write(journalEntry{Operation: createRefreshTokenOperation, RefreshToken: &refreshToken}); err != nil {
+		return nil, err
+	}
+	return &refreshToken, nil
+}
+
+func (d *InMemoryDatabase) GetRefreshToken(token string) (*RefreshToken, error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	if !regexp.MustCompile(refreshTokenRegex).MatchString(token) {
+		return nil, ErrInvalidRefreshToken
+	}
+	refreshToken, exists := d.RefreshTokens[token]
+	if !exists {
+		return nil, ErrInvalidRefreshToken
+	}
+	if !d.now().Before(refreshToken.ExpiresAt) {
+		return nil, ErrRefreshTokenExpired
+	}
+	return &refreshToken, nil
+}
+
+func (d *InMemoryDatabase) DeleteRefreshToken(token string) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if _, exists := d.RefreshTokens[token]; !exists {
+		return ErrInvalidRefreshToken
+	}
+	return d.write(journalEntry{Operation: deleteRefreshTokenOperation, Id: token})
+}
+
+// deleteExpiredTokens expects the caller to hold the lock. It only writes to the journal when there are expired tokens.
+func (d *InMemoryDatabase) deleteExpiredTokens(now time.Time) error {
+	expired := false
+	for _, accessToken := range d.AccessTokens {
+		expired = expired || !now.Before(accessToken.ExpiresAt)
+	}
+	for _, refreshToken := range d.RefreshTokens {
+		expired = expired || !now.Before(refreshToken.ExpiresAt)
+	}
+	if !expired {
+		return nil
+	}
+	return d.write(journalEntry{Operation: deleteExpiredTokensOperation, ExpiredAt: &now})
+}
+
+// DeleteUserTokens deletes every access and refresh token of the user, ending all their sessions.
+func (d *InMemoryDatabase) DeleteUserTokens(userId string) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return d.write(journalEntry{Operation: deleteUserTokensOperation, UserId: userId})
+}
+
+func (d *InMemoryDatabase) CreateTodoList(ownerId string, title string, description string) (*TodoList, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	now := d.now()
 	todoList := TodoList{
-		Id: d.generateUuid("lst"),
+		Id:          d.generateUuid("lst"),
+		Title:       title,
+		Description: description,
+		OwnerId:     ownerId,
+		CreatedAt:   now,
+		UpdatedAt:   now,
 	}
-	d.TodoLists[todoList.Id] = todoList
-	return &todoList
+	if err := d.write(journalEntry{Operation: createTodoListOperation, TodoList: &todoList}); err != nil {
+		return nil, err
+	}
+	return &todoList, nil
 }
 
-func (d *InMemoryDatabase) CreateTodo(listId string, description string, user string) *TodoItem {
+// UpdateTodoList doesn't change the owner or the members, use TransferTodoList, AddTodoListMember and
+// RemoveTodoListMember instead.
+func (d *InMemoryDatabase) UpdateTodoList(todoList *TodoList) (*TodoList, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	stored, exists := d.TodoLists[todoList.Id]
+	if !exists {
+		return nil, ErrTodoListNotFound
+	}
+	todoList.OwnerId = stored.OwnerId
+	todoList.MemberIds = slices.Clone(stored.MemberIds)
+	todoList.UpdatedAt = d.now()
+	if err := d.write(journalEntry{Operation: updateTodoListOperation, TodoList: todoList}); err != nil {
+		return nil, err
+	}
+	return todoList, nil
+}
+
+func (d *InMemoryDatabase) GetTodoList(listId string) (*TodoList, error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	if !regexp.MustCompile(listIdRegex).MatchString(listId) {
+		return nil, ErrInvalidTodoListId
+	}
+
+	todoList, exists := d.TodoLists[listId]
+	if !exists {
+		return nil, ErrTodoListNotFound
+	}
+	// Don't share the members with the stored list
+	todoList.MemberIds = slices.Clone(todoList.MemberIds)
+	return &todoList, nil
+}
+
+// GetTodoLists returns all lists the user owns or is a member of, sorted by id.
+func (d *InMemoryDatabase) GetTodoLists(userId string) (*[]TodoList, error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	todoLists := []TodoList{}
+	for _, todoList := range d.TodoLists {
+		if todoList.IsMember(userId) {
+			todoList.MemberIds = slices.Clone(todoList.MemberIds)
+			todoLists = append(todoLists, todoList)
+		}
+	}
+	slices.SortFunc(todoLists, func(a, b TodoList) int { return strings.Compare(a.Id, b.Id) })
+	return &todoLists, nil
+}
+
+// AddTodoListMember does nothing when the user already is a member.
+func (d *InMemoryDatabase) AddTodoListMember(listId string, userId string) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if _, exists := d.TodoLists[listId]; !exists {
+		return ErrTodoListNotFound
+	}
+	return d.write(journalEntry{Operation: addTodoListMemberOperation, Id: listId, UserId: userId})
+}
+
+func (d *InMemoryDatabase) RemoveTodoListMember(listId string, userId string) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	todoList, exists := d.TodoLists[listId]
+	if !exists {
+		return ErrTodoListNotFound
+	}
+	if !slices.Contains(todoList.MemberIds, userId) {
+		return ErrNotAMember
+	}
+	return d.write(journalEntry{Operation: removeTodoListMemberOperation, Id: listId, UserId: userId})
+}
+
+// TransferTodoList makes ownerId the owner of the list, the previous owner stays a member.
+func (d *InMemoryDatabase) TransferTodoList(listId string, ownerId string) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if _, exists := d.TodoLists[listId]; !exists {
+		return ErrTodoListNotFound
+	}
+	if _, exists := d.Users[ownerId]; !exists {
+		return ErrUserNotFound
+	}
+	return d.write(journalEntry{Operation: transferTodoListOperation, Id: listId, UserId: ownerId})
+}
+
+func (d *InMemoryDatabase) CreateTodo(listId string, description string, user string) (*TodoItem, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	workflow := DefaultWorkflow()
+	if todoList, exists := d.TodoLists[listId]; exists {
+		workflow = todoList.StatusWorkflow()
+	}
+
 	item := TodoItem{
 		Id:          d.generateUuid("tdo"),
 		ListId:      listId,
 		Description: description,
-		Status:      "todo",
+		Status:      workflow.InitialStatus(),
 		UserId:      user,
-		UpdatedAt:   d.currentTime(),
+		UpdatedAt:   d.now(),
 	}
 
-	d.TodoItems[item.Id] = item
-	d.TodoItemOrder = append(d.TodoItemOrder, item.Id)
-	return &item
+	if err := d.write(journalEntry{Operation: createTodoOperation, TodoItem: &item}); err != nil {
+		return nil, err
+	}
+	return &item, nil
 }
 
 func (d *InMemoryDatabase) UpdateTodo(todo *TodoItem) (*TodoItem, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
 	_, exists := d.TodoItems[todo.Id]
 	if !exists {
-		return nil, errors.New("todo not found")
+		return nil, ErrTodoNotFound
+	}
+	todo.UpdatedAt = d.now()
+	if err := d.write(journalEntry{Operation: updateTodoOperation, TodoItem: todo}); err != nil {
+		return nil, err
 	}
-	todo.UpdatedAt = d.currentTime()
-	d.TodoItems[todo.Id] = *todo
 	return todo, nil
 }
 
 func (d *InMemoryDatabase) GetTodo(todoId string) (*TodoItem, error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
 	if !regexp.MustCompile(todoIdRegex).MatchString(todoId) {
-		return nil, errors.New("invalid todo")
+		return nil, ErrInvalidTodoId
 	}
 
 	item, exists := d.TodoItems[todoId]
 	if !exists {
-		return nil, errors.New("todo not found")
+		return nil, ErrTodoNotFound
 	}
 	return &item, nil
 }
 
 func (d *InMemoryDatabase) GetTodos(listId string) (*[]TodoItem, error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
 	if !regexp.MustCompile(listIdRegex).MatchString(listId) {
-		return nil, errors.New("invalid todo list")
+		return nil, ErrInvalidTodoListId
 	}
 
 	todoList, exists := d.TodoLists[listId]
 	if !exists {
-		return nil, errors.New("todo list not found")
+		return nil, ErrTodoListNotFound
 	}
 
 	var items []TodoItem
@@ -158,3 +508,89 @@ func (d *InMemoryDatabase) GetTodos(listId string) (*[]TodoItem, error) {
 
 	return &items, nil
 }
+
+func (d *InMemoryDatabase) DeleteTodo(todoId string) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if !regexp.MustCompile(todoIdRegex).MatchString(todoId) {
+		return ErrInvalidTodoId
+	}
+	if _, exists := d.TodoItems[todoId]; !exists {
+		return ErrTodoNotFound
+	}
+	return d.write(journalEntry{Operation: deleteTodoOperation, Id: todoId})
+}
+
+// DeleteTodoList also deletes all todos on the list.
+func (d *InMemoryDatabase) DeleteTodoList(listId string) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if !regexp.MustCompile(listIdRegex).MatchString(listId) {
+		return ErrInvalidTodoListId
+	}
+	if _, exists := d.TodoLists[listId]; !exists {
+		return ErrTodoListNotFound
+	}
+	return d.write(journalEntry{Operation: deleteTodoListOperation, Id: listId})
+}
+
+func (d *InMemoryDatabase) Stats() (*Stats, error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	now := d.now()
+	stats := Stats{
+		Users:         len(d.Users),
+		TodoLists:     len(d.TodoLists),
+		TodosByStatus: make(map[string]int),
+	}
+	for _, item := range d.TodoItems {
+		stats.TodosByStatus[item.Status]++
+	}
+	for _, accessToken := range d.AccessTokens {
+		if now.Before(accessToken.ExpiresAt) {
+			stats.AccessTokens++
+		}
+	}
+	for _, refreshToken := range d.RefreshTokens {
+		if now.Before(refreshToken.ExpiresAt) {
+			stats.RefreshTokens++
+		}
+	}
+	return &stats, nil
+}
+
+// Dump copies the maps, so the copy can be inspected while the database keeps changing.
+func (d *InMemoryDatabase) Dump() (*InMemoryDatabase, error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	dump := &InMemoryDatabase{
+		Users:         maps.Clone(d.Users),
+		AccessTokens:  maps.Clone(d.AccessTokens),
+		RefreshTokens: maps.Clone(d.RefreshTokens),
+		TodoLists:     make(map[string]TodoList, len(d.TodoLists)),
+		TodoItems:     maps.Clone(d.TodoItems),
+		TodoItemOrder: slices.Clone(d.TodoItemOrder),
+		currentTime:   d.currentTime,
+		generateUuid:  d.generateUuid,
+	}
+	for id, todoList := range d.TodoLists {
+		todoList.MemberIds = slices.Clone(todoList.MemberIds)
+		dump.TodoLists[id] = todoList
+	}
+	return dump, nil
+}
+
+// Ping only fails when the journal can't be written to, the maps are always available.
+func (d *InMemoryDatabase) Ping() error {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	if d.journal == nil {
+		return nil
+	}
+	return d.journal.Sync()
+}
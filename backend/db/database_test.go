@@ -1,18 +1,24 @@
 package db
 
 import (
+	"backend/util"
 	"github.com/stretchr/testify/assert"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestDatabase_GetAccessToken(t *testing.T) {
-	database := TestDatabase(nil, nil)
+	database := TestDatabase(func() time.Time { return util.FakeTime(2024, 6, 30) }, nil)
 
 	const validAccessToken = "tkn_aaaaaaaaaaaaaaaaaaaaaa"
 	const nonExistingAccessToken = "tkn_bbbbbbbbbbbbbbbbbbbbbb"
 
-	fakeToken := AccessToken{UserId: "valid_account", Token: validAccessToken}
+	const expiredAccessToken = "tkn_cccccccccccccccccccccc"
+
+	fakeToken := AccessToken{UserId: "valid_account", Token: validAccessToken, ExpiresAt: util.FakeTime(2024, 7, 1).UTC()}
 	database.AccessTokens[validAccessToken] = fakeToken
+	database.AccessTokens[expiredAccessToken] = AccessToken{UserId: "valid_account", Token: expiredAccessToken, ExpiresAt: util.FakeTime(2024, 6, 30).UTC()}
 
 	t.Run("valid token", func(t *testing.T) {
 		accessToken, err := database.GetAccessToken(validAccessToken)
@@ -26,9 +32,252 @@ func TestDatabase_GetAccessToken(t *testing.T) {
 		assert.Nil(t, accessToken)
 	})
 
+	t.Run("expired token", func(t *testing.T) {
+		accessToken, err := database.GetAccessToken(expiredAccessToken)
+		assert.ErrorIs(t, err, ErrAccessTokenExpired)
+		assert.Nil(t, accessToken)
+	})
+
 	t.Run("account doesnt exist", func(t *testing.T) {
 		accessToken, err := database.GetAccessToken(nonExistingAccessToken)
-		assert.NotNil(t, err)
+		assert.ErrorIs(t, err, ErrInvalidAccessToken)
 		assert.Nil(t, accessToken)
 	})
 }
+
+// Run with -race to detect unsynchronized access to the maps
+func TestDatabase_ConcurrentTodos(t *testing.T) {
+	const writers = 50
+	const todosPerWriter = 20
+
+	database := TestDatabase(util.GetCurrentTime, util.GenerateRandomUuid)
+	database.TodoItemOrder = []string{}
+	list, _ := database.CreateTodoList("usr_1", "Groceries", "")
+
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < todosPerWriter; j++ {
+				item, err := database.CreateTodo(list.Id, "concurrent todo", "fake_user")
+				assert.Nil(t, err)
+
+				item.Status = "ongoing"
+				_, err = database.UpdateTodo(item)
+				assert.Nil(t, err)
+
+				_, err = database.GetTodos(list.Id)
+				assert.Nil(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	todos, err := database.GetTodos(list.Id)
+	assert.Nil(t, err)
+	assert.Len(t, *todos, writers*todosPerWriter)
+	for _, todo := range *todos {
+		assert.Equal(t, "ongoing", todo.Status)
+	}
+}
+
+// statsSeed has tokens that expired, to check they aren't counted.
+func statsSeed() *InMemoryDatabase {
+	database := TestDatabase(func() time.Time { return util.FakeTime(2024, 6, 30) }, nil)
+	database.Users["usr_1"] = User{Id: "usr_1", Name: "first"}
+	database.Users["usr_2"] = User{Id: "usr_2", Name: "second"}
+	database.AccessTokens["tkn_valid"] = AccessToken{UserId: "usr_1", Token: "tkn_valid", ExpiresAt: util.FakeTime(2024, 7, 1).UTC()}
+	database.AccessTokens["tkn_expired"] = AccessToken{UserId: "usr_1", Token: "tkn_expired", ExpiresAt: util.FakeTime(2024, 6, 30).UTC()}
+	database.RefreshTokens["rtk_valid"] = RefreshToken{UserId: "usr_1", Token: "rtk_valid", AccessToken: "tkn_valid", ExpiresAt: util.FakeTime(2024, 8, 1).UTC()}
+	database.TodoLists["lst_1"] = TodoList{Id: "lst_1", OwnerId: "usr_1"}
+	database.TodoItems["tdo_1"] = TodoItem{Id: "tdo_1", ListId: "lst_1", UserId: "usr_1", Status: "todo"}
+	database.TodoItems["tdo_2"] = TodoItem{Id: "tdo_2", ListId: "lst_1", UserId: "usr_1", Status: "todo"}
+	database.TodoItems["tdo_3"] = TodoItem{Id: "tdo_3", ListId: "lst_1", UserId: "usr_2", Status: "done"}
+	return database
+}
+
+var expectedStats = &Stats{
+	Users:         2,
+	TodoLists:     1,
+	TodosByStatus: map[string]int{"todo": 2, "done": 1},
+	AccessTokens:  1,
+	RefreshTokens: 1,
+}
+
+// testDeleteExpiredTokens runs against every Database implementation, seeded with statsSeed.
+func testDeleteExpiredTokens(t *testing.T, database Database) {
+	accessToken := &AccessToken{UserId: "usr_1", Token: "tkn_valid", ExpiresAt: util.FakeTime(2024, 7, 1).UTC()}
+	refreshToken, err := database.CreateRefreshToken(accessToken, 24*time.Hour)
+	assert.NoError(t, err)
+
+	dump, err := database.Dump()
+	assert.NoError(t, err)
+	assert.Len(t, dump.AccessTokens, 1)
+	assert.Contains(t, dump.AccessTokens, "tkn_valid")
+	assert.Len(t, dump.RefreshTokens, 2)
+	assert.Contains(t, dump.RefreshTokens, "rtk_valid")
+	assert.Contains(t, dump.RefreshTokens, refreshToken.Token)
+}
+
+func TestDatabase_DeleteExpiredTokens(t *testing.T) {
+	database := statsSeed()
+	database.generateUuid = func(prefix string) string { return prefix + "_new" }
+	testDeleteExpiredTokens(t, database)
+}
+
+func TestDatabase_Stats(t *testing.T) {
+	stats, err := statsSeed().Stats()
+
+	assert.NoError(t, err)
+	assert.Equal(t, expectedStats, stats)
+}
+
+// testUpdateUser runs against every Database implementation, seeded with the users first and second.
+func testUpdateUser(t *testing.T, database Database) {
+	first, err := database.GetUserByName("first")
+	assert.NoError(t, err)
+
+	first.Admin = true
+	updated, err := database.UpdateUser(first)
+	assert.NoError(t, err)
+	assert.Equal(t, first, updated)
+	stored, err := database.GetUser(first.Id)
+	assert.NoError(t, err)
+	assert.True(t, stored.Admin)
+
+	_, err = database.UpdateUser(&User{Id: first.Id, Name: "second", PasswordHash: "$2a$10$hash"})
+	assert.ErrorIs(t, err, ErrUserNameTaken)
+
+	_, err = database.UpdateUser(&User{Id: "usr_unknown", Name: "unknown"})
+	assert.ErrorIs(t, err, ErrUserNotFound)
+}
+
+func TestDatabase_UpdateUser(t *testing.T) {
+	testUpdateUser(t, statsSeed())
+}
+
+// testCreateUserConcurrently runs against every Database implementation, registering the same name at once.
+func testCreateUserConcurrently(t *testing.T, database Database) {
+	const registrations = 20
+
+	errs := make([]error, registrations)
+	var wg sync.WaitGroup
+	for i := 0; i < registrations; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = database.CreateUser("taken", "$2a$10$hash")
+		}()
+	}
+	wg.Wait()
+
+	created := 0
+	for _, err := range errs {
+		if err == nil {
+			created++
+		} else {
+			assert.ErrorIs(t, err, ErrUserNameTaken)
+		}
+	}
+	assert.Equal(t, 1, created)
+}
+
+func TestDatabase_CreateUserConcurrently(t *testing.T) {
+	testCreateUserConcurrently(t, TestDatabase(util.GetCurrentTime, util.GenerateRandomUuid))
+}
+
+const (
+	ownerId    = "usr_aaaaaaaaaaaaaaaaaaaaaa"
+	memberId   = "usr_bbbbbbbbbbbbbbbbbbbbbb"
+	ownedList  = "lst_aaaaaaaaaaaaaaaaaaaaaa"
+	sharedList = "lst_bbbbbbbbbbbbbbbbbbbbbb"
+)
+
+// usersSeed has a list owned by ownerId and one owned by memberId but shared with ownerId, both users have a session.
+func usersSeed() *InMemoryDatabase {
+	database := TestDatabase(func() time.Time { return util.FakeTime(2024, 6, 30) }, nil)
+	database.Users[ownerId] = User{Id: ownerId, Name: "owner"}
+	database.Users[memberId] = User{Id: memberId, Name: "member"}
+	for _, userId := range []string{ownerId, memberId} {
+		token := "tkn_" + userId[4:]
+		database.AccessTokens[token] = AccessToken{UserId: userId, Token: token, ExpiresAt: util.FakeTime(2024, 7, 1).UTC()}
+		database.RefreshTokens["rtk_"+userId[4:]] = RefreshToken{UserId: userId, Token: "rtk_" + userId[4:], AccessToken: token, ExpiresAt: util.FakeTime(2024, 8, 1).UTC()}
+	}
+	database.TodoLists[ownedList] = TodoList{Id: ownedList, OwnerId: ownerId}
+	database.TodoLists[sharedList] = TodoList{Id: sharedList, OwnerId: memberId, MemberIds: []string{ownerId}}
+	database.TodoItems["tdo_aaaaaaaaaaaaaaaaaaaaaa"] = TodoItem{Id: "tdo_aaaaaaaaaaaaaaaaaaaaaa", ListId: ownedList, UserId: memberId, Status: "todo"}
+	database.TodoItemOrder = []string{"tdo_aaaaaaaaaaaaaaaaaaaaaa"}
+	return database
+}
+
+// testUsers runs against every Database implementation, seeded with usersSeed.
+func testUsers(t *testing.T, database Database) {
+	users, err := database.GetUsers()
+	assert.NoError(t, err)
+	assert.Equal(t, []User{{Id: memberId, Name: "member"}, {Id: ownerId, Name: "owner"}}, *users)
+
+	t.Run("delete user", func(t *testing.T) {
+		assert.ErrorIs(t, database.DeleteUser(ownerId), ErrUserOwnsTodoLists)
+		assert.ErrorIs(t, database.DeleteUser("usr_unknown"), ErrUserNotFound)
+
+		// Makes ownerId a member of both lists
+		assert.NoError(t, database.TransferTodoList(ownedList, memberId))
+		assert.NoError(t, database.DeleteUser(ownerId))
+
+		_, err := database.GetUser(ownerId)
+		assert.ErrorIs(t, err, ErrUserNotFound)
+		for _, listId := range []string{ownedList, sharedList} {
+			todoList, err := database.GetTodoList(listId)
+			assert.NoError(t, err)
+			assert.Empty(t, todoList.MemberIds)
+		}
+		stats, err := database.Stats()
+		assert.NoError(t, err)
+		assert.Equal(t, 1, stats.Users)
+		assert.Equal(t, 1, stats.AccessTokens)
+		assert.Equal(t, 1, stats.RefreshTokens)
+		// The lists they were a member of and the todos they created elsewhere are kept
+		assert.Equal(t, 2, stats.TodoLists)
+		assert.Equal(t, map[string]int{"todo": 1}, stats.TodosByStatus)
+	})
+}
+
+// testTransferTodoList runs against every Database implementation, seeded with usersSeed.
+func testTransferTodoList(t *testing.T, database Database) {
+	assert.ErrorIs(t, database.TransferTodoList("lst_cccccccccccccccccccccc", memberId), ErrTodoListNotFound)
+	assert.ErrorIs(t, database.TransferTodoList(ownedList, "usr_unknown"), ErrUserNotFound)
+
+	stale, err := database.GetTodoList(ownedList)
+	assert.NoError(t, err)
+	assert.NoError(t, database.TransferTodoList(ownedList, memberId))
+	assert.NoError(t, database.TransferTodoList(sharedList, ownerId))
+
+	owned, err := database.GetTodoList(ownedList)
+	assert.NoError(t, err)
+	assert.Equal(t, memberId, owned.OwnerId)
+	assert.Equal(t, []string{ownerId}, owned.MemberIds)
+	shared, err := database.GetTodoList(sharedList)
+	assert.NoError(t, err)
+	assert.Equal(t, ownerId, shared.OwnerId)
+	assert.Equal(t, []string{memberId}, shared.MemberIds)
+
+	// Updating a copy from before the transfer doesn't give the list back to the previous owner
+	stale.Title = "Renamed"
+	updated, err := database.UpdateTodoList(stale)
+	assert.NoError(t, err)
+	assert.Equal(t, memberId, updated.OwnerId)
+	owned, err = database.GetTodoList(ownedList)
+	assert.NoError(t, err)
+	assert.Equal(t, "Renamed", owned.Title)
+	assert.Equal(t, memberId, owned.OwnerId)
+	assert.Equal(t, []string{ownerId}, owned.MemberIds)
+}
+
+func TestDatabase_Users(t *testing.T) {
+	testUsers(t, usersSeed())
+}
+
+func TestDatabase_TransferTodoList(t *testing.T) {
+	testTransferTodoList(t, usersSeed())
+}
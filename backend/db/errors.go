@@ -0,0 +1,28 @@
+package db
+
+import "errors"
+
+// Errors every Database implementation returns, so callers can tell them apart with errors.Is regardless of the
+// implementation. Their messages are shown to users.
+var (
+	ErrUserNotFound      = errors.New("user not found")
+	ErrUserNameTaken     = errors.New("user name already taken")
+	ErrUserOwnsTodoLists = errors.New("user still owns todo lists")
+	ErrNotAMember        = errors.New("user is not a member")
+
+	ErrInvalidAccessToken  = errors.New("invalid access token")
+	ErrAccessTokenExpired  = errors.New("access token expired")
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenExpired = errors.New("refresh token expired")
+
+	// Ids that aren't well-formed can't exist, but are reported separately
+	ErrInvalidTodoListId = errors.New("invalid todo list")
+	ErrTodoListNotFound  = errors.New("todo list not found")
+	ErrInvalidTodoId     = errors.New("invalid todo")
+	ErrTodoNotFound      = errors.New("todo not found")
+
+	// Wrapped with the statuses, like "invalid status transition from todo to done"
+	ErrInvalidTransition = errors.New("invalid status transition")
+	// Wrapped with what's wrong, like "invalid workflow: duplicate status todo"
+	ErrInvalidWorkflow = errors.New("invalid workflow")
+)
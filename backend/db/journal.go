@@ -0,0 +1,325 @@
+package db
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"time"
+)
+
+const (
+	createUserOperation        = "create_user"
+	updateUserOperation        = "update_user"
+	deleteUserOperation        = "delete_user"
+	createAccessTokenOperation = "create_access_token"
+	deleteAccessTokenOperation = "delete_access_token"
+	createTodoListOperation    = "create_todo_list"
+	updateTodoListOperation    = "update_todo_list"
+	createTodoOperation        = "create_todo"
+	updateTodoOperation        = "update_todo"
+	deleteTodoOperation        = "delete_todo"
+	deleteTodoListOperation    = "delete_todo_list"
+
+	createRefreshTokenOperation  = "create_refresh_token"
+	deleteRefreshTokenOperation  = "delete_refresh_token"
+	deleteUserTokensOperation    = "delete_user_tokens"
+	deleteExpiredTokensOperation = "delete_expired_tokens"
+
+	addTodoListMemberOperation    = "add_todo_list_member"
+	removeTodoListMemberOperation = "remove_todo_list_member"
+	transferTodoListOperation     = "transfer_todo_list"
+)
+
+// journalEntry is a single mutation of the database, stored as one JSON line in the journal.
+type journalEntry struct {
+	Operation    string        `json:"op"`
+	Id           string        `json:"id,omitempty"`
+	UserId       string        `json:"user_id,omitempty"`
+	User         *User         `json:"user,omitempty"`
+	AccessToken  *AccessToken  `json:"access_token,omitempty"`
+	RefreshToken *RefreshToken `json:"refresh_token,omitempty"`
+	TodoList     *TodoList     `json:"todo_list,omitempty"`
+	TodoItem     *TodoItem     `json:"todo_item,omitempty"`
+	// Tokens that expired at this time are deleted, rather than listing every token
+	ExpiredAt *time.Time `json:"expired_at,omitempty"`
+}
+
+// OpenJournal replays all entries in the journal at path, and records every following mutation to it.
+// Load the snapshot before opening the journal, as the journal only contains the changes made after it.
+func (d *InMemoryDatabase) OpenJournal(path string) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	if err = d.replay(file); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("corrupt journal %s: %w", path, err)
+	}
+
+	d.journal = file
+	return nil
+}
+
+func (d *InMemoryDatabase) CloseJournal() error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.journal == nil {
+		return nil
+	}
+	err := d.journal.Close()
+	d.journal = nil
+	return err
+}
+
+// Compact saves a snapshot to path and empties the journal, as all its entries are now part of the snapshot.
+func (d *InMemoryDatabase) Compact(snapshotPath string) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if err := d.saveSnapshot(snapshotPath); err != nil {
+		return err
+	}
+	if d.journal == nil {
+		return nil
+	}
+	if err := d.journal.Truncate(0); err != nil {
+		return err
+	}
+	return d.journal.Sync()
+}
+
+// replay applies every entry in file, and drops an incomplete last entry left behind by a crash.
+func (d *InMemoryDatabase) replay(file *os.File) error {
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	line := 0
+	var complete int64
+	var incomplete error
+	for scanner.Scan() {
+		line++
+		// Only the last line can be incomplete, it's the write the server crashed on
+		if incomplete != nil {
+			return incomplete
+		}
+
+		var entry journalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			incomplete = fmt.Errorf("line %d: %w", line, err)
+			continue
+		}
+		if err := d.apply(entry); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		complete += int64(len(scanner.Bytes())) + 1
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if incomplete != nil {
+		slog.Warn("Dropping incomplete journal entry", "path", file.Name(), "error", incomplete)
+		return file.Truncate(complete)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if complete > info.Size() {
+		// The last entry is complete, but the newline separating it from the next one is missing
+		_, err = file.Write([]byte{'\n'})
+	}
+	return err
+}
+
+// write records entry in the journal before applying it, so a mutation is never lost once it's visible.
+// Callers must hold the write lock.
+func (d *InMemoryDatabase) write(entry journalEntry) error {
+	if d.journal != nil {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		if _, err = d.journal.Write(append(line, '\n')); err != nil {
+			return err
+		}
+		if err = d.journal.Sync(); err != nil {
+			return err
+		}
+	}
+	return d.apply(entry)
+}
+
+// apply must be idempotent, entries already contained in the snapshot are replayed when compaction was interrupted.
+func (d *InMemoryDatabase) apply(entry journalEntry) error {
+	switch entry.Operation {
+	case createUserOperation:
+		if entry.User == nil {
+			return errors.New("missing user")
+		}
+		d.Users[entry.User.Id] = *entry.User
+	case updateUserOperation:
+		if entry.User == nil {
+			return errors.New("missing user")
+		}
+		// The user was deleted later on, when the snapshot already contains the delete
+		if _, exists := d.Users[entry.User.Id]; exists {
+			d.Users[entry.User.Id] = *entry.User
+		}
+	case createAccessTokenOperation:
+		if entry.AccessToken == nil {
+			return errors.New("missing access token")
+		}
+		d.AccessTokens[entry.AccessToken.Token] = *entry.AccessToken
+	case deleteAccessTokenOperation:
+		delete(d.AccessTokens, entry.Id)
+		for token, refreshToken := range d.RefreshTokens {
+			if refreshToken.AccessToken == entry.Id {
+				delete(d.RefreshTokens, token)
+			}
+		}
+	case createRefreshTokenOperation:
+		if entry.RefreshToken == nil {
+			return errors.New("missing refresh token")
+		}
+		d.RefreshTokens[entry.RefreshToken.Token] = *entry.RefreshToken
+	case deleteRefreshTokenOperation:
+		delete(d.RefreshTokens, entry.Id)
+	case deleteUserOperation:
+		delete(d.Users, entry.UserId)
+		d.deleteUserTokens(entry.UserId)
+		for listId, todoList := range d.TodoLists {
+			if slices.Contains(todoList.MemberIds, entry.UserId) {
+				todoList.MemberIds = withoutMember(todoList.MemberIds, entry.UserId)
+				d.TodoLists[listId] = todoList
+			}
+		}
+	case deleteUserTokensOperation:
+		d.deleteUserTokens(entry.UserId)
+	case deleteExpiredTokensOperation:
+		if entry.ExpiredAt == nil {
+			return errors.New("missing expiry")
+		}
+		for token, accessToken := range d.AccessTokens {
+			if !entry.ExpiredAt.Before(accessToken.ExpiresAt) {
+				delete(d.AccessTokens, token)
+			}
+		}
+		for token, refreshToken := range d.RefreshTokens {
+			if !entry.ExpiredAt.Before(refreshToken.ExpiresAt) {
+				delete(d.RefreshTokens, token)
+			}
+		}
+	case createTodoListOperation:
+		if entry.TodoList == nil {
+			return errors.New("missing todo list")
+		}
+		d.TodoLists[entry.TodoList.Id] = *entry.TodoList
+	case updateTodoListOperation:
+		if entry.TodoList == nil {
+			return errors.New("missing todo list")
+		}
+		// The todo list was deleted later on, when the snapshot already contains the delete
+		stored, exists := d.TodoLists[entry.TodoList.Id]
+		if !exists {
+			break
+		}
+		todoList := *entry.TodoList
+		// The owner and members are only changed by their own operations
+		todoList.OwnerId = stored.OwnerId
+		todoList.MemberIds = stored.MemberIds
+		d.TodoLists[todoList.Id] = todoList
+	case createTodoOperation:
+		if entry.TodoItem == nil {
+			return errors.New("missing todo")
+		}
+		if _, exists := d.TodoItems[entry.TodoItem.Id]; !exists {
+			d.TodoItemOrder = append(d.TodoItemOrder, entry.TodoItem.Id)
+		}
+		d.TodoItems[entry.TodoItem.Id] = *entry.TodoItem
+	case updateTodoOperation:
+		if entry.TodoItem == nil {
+			return errors.New("missing todo")
+		}
+		d.TodoItems[entry.TodoItem.Id] = *entry.TodoItem
+	case deleteTodoOperation:
+		delete(d.TodoItems, entry.Id)
+		d.TodoItemOrder = slices.DeleteFunc(d.TodoItemOrder, func(todoId string) bool { return todoId == entry.Id })
+	case deleteTodoListOperation:
+		delete(d.TodoLists, entry.Id)
+		for todoId, item := range d.TodoItems {
+			if item.ListId == entry.Id {
+				delete(d.TodoItems, todoId)
+			}
+		}
+		d.TodoItemOrder = slices.DeleteFunc(d.TodoItemOrder, func(todoId string) bool {
+			_, exists := d.TodoItems[todoId]
+			return !exists
+		})
+	case addTodoListMemberOperation:
+		// Like updates, member changes of a todo list that was deleted later on are skipped
+		todoList, exists := d.TodoLists[entry.Id]
+		if !exists {
+			break
+		}
+		if !slices.Contains(todoList.MemberIds, entry.UserId) {
+			// Never append to the stored slice, it might be shared with a copy handed out before
+			todoList.MemberIds = append(slices.Clone(todoList.MemberIds), entry.UserId)
+		}
+		d.TodoLists[entry.Id] = todoList
+	case removeTodoListMemberOperation:
+		todoList, exists := d.TodoLists[entry.Id]
+		if !exists {
+			break
+		}
+		todoList.MemberIds = withoutMember(todoList.MemberIds, entry.UserId)
+		d.TodoLists[entry.Id] = todoList
+	case transferTodoListOperation:
+		todoList, exists := d.TodoLists[entry.Id]
+		if !exists {
+			break
+		}
+		// The previous owner stays a member, the new owner doesn't have to be one anymore
+		if !slices.Contains(todoList.MemberIds, todoList.OwnerId) {
+			todoList.MemberIds = append(slices.Clone(todoList.MemberIds), todoList.OwnerId)
+		}
+		todoList.MemberIds = withoutMember(todoList.MemberIds, entry.UserId)
+		todoList.OwnerId = entry.UserId
+		d.TodoLists[entry.Id] = todoList
+	default:
+		return fmt.Errorf("unknown operation %s", entry.Operation)
+	}
+	return nil
+}
+
+func (d *InMemoryDatabase) deleteUserTokens(userId string) {
+	for token, accessToken := range d.AccessTokens {
+		if accessToken.UserId == userId {
+			delete(d.AccessTokens, token)
+		}
+	}
+	for token, refreshToken := range d.RefreshTokens {
+		if refreshToken.UserId == userId {
+			delete(d.RefreshTokens, token)
+		}
+	}
+}
+
+// withoutMember returns a copy of memberIds without userId, nil when no members are left.
+func withoutMember(memberIds []string, userId string) []string {
+	memberIds = slices.DeleteFunc(slices.Clone(memberIds), func(memberId string) bool { return memberId == userId })
+	if len(memberIds) == 0 {
+		return nil
+	}
+	return memberIds
+}
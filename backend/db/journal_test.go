@@ -0,0 +1,292 @@
+package db
+
+import (
+	"backend/util"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func journaledTestDatabase(t *testing.T, path string) *InMemoryDatabase {
+	ids := 0
+	database := TestDatabase(
+		func() time.Time { return util.FakeTime(2024, 6, 30) },
+		func(prefix string) string {
+			ids++
+			return prefix + "_" + strings.Repeat(string(rune('a'+ids)), 22)
+		},
+	)
+	database.TodoItemOrder = []string{}
+	assert.Nil(t, database.OpenJournal(path))
+	t.Cleanup(func() { _ = database.CloseJournal() })
+	return database
+}
+
+func TestInMemoryDatabase_ReplayJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+
+	database := journaledTestDatabase(t, path)
+	user, _ := database.CreateUser("test user", "$2a$10$hash")
+	user.Admin = true
+	_, _ = database.UpdateUser(user)
+	accessToken, _ := database.CreateAccessToken(user.Id, time.Hour)
+	_, _ = database.CreateRefreshToken(accessToken, 24*time.Hour)
+	list, _ := database.CreateTodoList(user.Id, "Groceries", "")
+	assert.Nil(t, database.AddTodoListMember(list.Id, "usr_2"))
+	assert.Nil(t, database.AddTodoListMember(list.Id, "usr_3"))
+	_, _ = database.UpdateTodoList(&TodoList{Id: list.Id, Title: "Weekend groceries", OwnerId: user.Id, CreatedAt: list.CreatedAt})
+	assert.Nil(t, database.RemoveTodoListMember(list.Id, "usr_2"))
+	item, _ := database.CreateTodo(list.Id, "first todo", user.Id)
+	item.Status = "ongoing"
+	_, _ = database.UpdateTodo(item)
+	assert.Nil(t, database.CloseJournal())
+
+	restored := journaledTestDatabase(t, path)
+
+	assert.Equal(t, database.Users, restored.Users)
+	assert.True(t, restored.Users[user.Id].Admin)
+	assert.Equal(t, database.AccessTokens, restored.AccessTokens)
+	assert.Equal(t, database.RefreshTokens, restored.RefreshTokens)
+	assert.Equal(t, database.TodoLists, restored.TodoLists)
+	assert.Equal(t, []string{"usr_3"}, restored.TodoLists[list.Id].MemberIds)
+	assert.Equal(t, "Weekend groceries", restored.TodoLists[list.Id].Title)
+	assert.Equal(t, database.TodoItems, restored.TodoItems)
+	assert.Equal(t, []string{item.Id}, restored.TodoItemOrder)
+}
+
+func TestInMemoryDatabase_ReplayDeletes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+
+	database := journaledTestDatabase(t, path)
+	list, _ := database.CreateTodoList("usr_1", "Groceries", "")
+	otherList, _ := database.CreateTodoList("usr_1", "Groceries", "")
+	deletedItem, _ := database.CreateTodo(list.Id, "deleted todo", "usr_1")
+	item, _ := database.CreateTodo(list.Id, "remaining todo", "usr_1")
+	_, _ = database.CreateTodo(otherList.Id, "other todo", "usr_1")
+	assert.Nil(t, database.DeleteTodo(deletedItem.Id))
+	assert.Nil(t, database.DeleteTodoList(otherList.Id))
+	assert.Nil(t, database.CloseJournal())
+
+	restored := journaledTestDatabase(t, path)
+
+	assert.Equal(t, map[string]TodoList{list.Id: *list}, restored.TodoLists)
+	assert.Equal(t, map[string]TodoItem{item.Id: *item}, restored.TodoItems)
+	assert.Equal(t, []string{item.Id}, restored.TodoItemOrder)
+}
+
+func TestInMemoryDatabase_ReplayTokenDeletes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+
+	database := journaledTestDatabase(t, path)
+	loggedOut, _ := database.CreateAccessToken("usr_1", time.Hour)
+	_, _ = database.CreateRefreshToken(loggedOut, 24*time.Hour)
+	accessToken, _ := database.CreateAccessToken("usr_1", time.Hour)
+	refreshToken, _ := database.CreateRefreshToken(accessToken, 24*time.Hour)
+	otherUser, _ := database.CreateAccessToken("usr_2", time.Hour)
+	_, _ = database.CreateRefreshToken(otherUser, 24*time.Hour)
+	assert.Nil(t, database.DeleteAccessToken(loggedOut.Token))
+	assert.Nil(t, database.DeleteUserTokens("usr_2"))
+	assert.Nil(t, database.CloseJournal())
+
+	restored := journaledTestDatabase(t, path)
+
+	assert.Equal(t, map[string]AccessToken{accessToken.Token: *accessToken}, restored.AccessTokens)
+	assert.Equal(t, map[string]RefreshToken{refreshToken.Token: *refreshToken}, restored.RefreshTokens)
+}
+
+func TestInMemoryDatabase_ReplayExpiredTokenDeletes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+
+	database := journaledTestDatabase(t, path)
+	expired, _ := database.CreateAccessToken("usr_1", 0)
+	accessToken, _ := database.CreateAccessToken("usr_1", time.Hour)
+	refreshToken, _ := database.CreateRefreshToken(accessToken, 24*time.Hour)
+	assert.Nil(t, database.CloseJournal())
+
+	restored := journaledTestDatabase(t, path)
+
+	assert.NotContains(t, restored.AccessTokens, expired.Token)
+	assert.Equal(t, map[string]AccessToken{accessToken.Token: *accessToken}, restored.AccessTokens)
+	assert.Equal(t, map[string]RefreshToken{refreshToken.Token: *refreshToken}, restored.RefreshTokens)
+}
+
+func TestInMemoryDatabase_ReplayUserDeletes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+
+	database := journaledTestDatabase(t, path)
+	owner, _ := database.CreateUser("owner", "$2a$10$hash")
+	deleted, _ := database.CreateUser("deleted", "$2a$10$hash")
+	accessToken, _ := database.CreateAccessToken(deleted.Id, time.Hour)
+	_, _ = database.CreateRefreshToken(accessToken, 24*time.Hour)
+	list, _ := database.CreateTodoList(deleted.Id, "Groceries", "")
+	assert.Nil(t, database.TransferTodoList(list.Id, owner.Id))
+	assert.Nil(t, database.DeleteUser(deleted.Id))
+	assert.Nil(t, database.CloseJournal())
+
+	restored := journaledTestDatabase(t, path)
+
+	assert.Equal(t, database.Users, restored.Users)
+	assert.Empty(t, restored.AccessTokens)
+	assert.Empty(t, restored.RefreshTokens)
+	assert.Equal(t, database.TodoLists, restored.TodoLists)
+	assert.Equal(t, owner.Id, restored.TodoLists[list.Id].OwnerId)
+	assert.Empty(t, restored.TodoLists[list.Id].MemberIds)
+}
+
+func TestInMemoryDatabase_ReplayIncompleteJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	journal := `{"op":"create_user","user":{"Id":"usr_1","Name":"first"}}` + "\n" + `{"op":"create_user","user":{"Id":"usr_2",`
+	assert.Nil(t, os.WriteFile(path, []byte(journal), 0600))
+
+	database := journaledTestDatabase(t, path)
+	assert.Equal(t, map[string]User{"usr_1": {Id: "usr_1", Name: "first"}}, database.Users)
+
+	// New entries must not be appended to the dropped entry
+	user, _ := database.CreateUser("second", "")
+	assert.Nil(t, database.CloseJournal())
+
+	restored := journaledTestDatabase(t, path)
+	assert.Len(t, restored.Users, 2)
+	assert.Equal(t, "second", restored.Users[user.Id].Name)
+}
+
+func TestInMemoryDatabase_ReplayCorruptJournal(t *testing.T) {
+	tests := []struct {
+		description string
+		journal     string
+		err         string
+	}{
+		{
+			description: "Corrupt entry followed by other entries",
+			journal:     "{broken\n" + `{"op":"create_user","user":{"Id":"usr_1"}}` + "\n",
+			err:         "line 1: invalid character 'b' looking for beginning of object key string",
+		},
+		{
+			description: "Unknown operation",
+			journal:     `{"op":"drop_database"}` + "\n",
+			err:         "line 1: unknown operation drop_database",
+		},
+		{
+			description: "Missing data",
+			journal:     `{"op":"create_todo"}` + "\n",
+			err:         "line 1: missing todo",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.description, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "journal.jsonl")
+			assert.Nil(t, os.WriteFile(path, []byte(tt.journal), 0600))
+
+			database := TestDatabase(nil, nil)
+			err := database.OpenJournal(path)
+
+			assert.EqualError(t, err, "corrupt journal "+path+": "+tt.err)
+		})
+	}
+}
+
+func TestInMemoryDatabase_Compact(t *testing.T) {
+	directory := t.TempDir()
+	journalPath := filepath.Join(directory, "journal.jsonl")
+	snapshotPath := filepath.Join(directory, "snapshot.json")
+
+	database := journaledTestDatabase(t, journalPath)
+	list, _ := database.CreateTodoList("usr_1", "Groceries", "")
+	first, _ := database.CreateTodo(list.Id, "first todo", "usr_1")
+	assert.Nil(t, database.Compact(snapshotPath))
+
+	journal, _ := os.ReadFile(journalPath)
+	assert.Empty(t, journal)
+
+	second, _ := database.CreateTodo(list.Id, "second todo", "usr_1")
+	assert.Nil(t, database.CloseJournal())
+
+	restored := TestDatabase(nil, nil)
+	assert.Nil(t, restored.LoadSnapshot(snapshotPath))
+	assert.Nil(t, restored.OpenJournal(journalPath))
+	defer restored.CloseJournal()
+
+	assert.Equal(t, database.TodoItems, restored.TodoItems)
+	assert.Equal(t, []string{first.Id, second.Id}, restored.TodoItemOrder)
+}
+
+func TestInMemoryDatabase_Ping(t *testing.T) {
+	assert.NoError(t, TestDatabase(util.GetCurrentTime, util.GenerateRandomUuid).Ping())
+
+	database := journaledTestDatabase(t, filepath.Join(t.TempDir(), "journal.jsonl"))
+	assert.NoError(t, database.Ping())
+
+	// Changes can't be recorded anymore once the journal is gone
+	assert.NoError(t, database.journal.Close())
+	assert.ErrorIs(t, database.Ping(), os.ErrClosed)
+}
+
+func TestInMemoryDatabase_ReplayAfterInterruptedCompaction(t *testing.T) {
+	// Every change targets a user or todo list that no longer exists when replayed on top of the snapshot
+	tests := []struct {
+		name   string
+		change func(t *testing.T, database *InMemoryDatabase, member *User, list *TodoList)
+	}{
+		{
+			name: "Update deleted todo list",
+			change: func(t *testing.T, database *InMemoryDatabase, member *User, list *TodoList) {
+				_, _ = database.UpdateTodoList(&TodoList{Id: list.Id, Title: "Weekend groceries", CreatedAt: list.CreatedAt})
+				assert.Nil(t, database.DeleteTodoList(list.Id))
+			},
+		},
+		{
+			name: "Update deleted user",
+			change: func(t *testing.T, database *InMemoryDatabase, member *User, list *TodoList) {
+				member.Admin = true
+				_, _ = database.UpdateUser(member)
+				assert.Nil(t, database.DeleteUser(member.Id))
+			},
+		},
+		{
+			name: "Add and remove member of deleted todo list",
+			change: func(t *testing.T, database *InMemoryDatabase, member *User, list *TodoList) {
+				assert.Nil(t, database.AddTodoListMember(list.Id, member.Id))
+				assert.Nil(t, database.RemoveTodoListMember(list.Id, member.Id))
+				assert.Nil(t, database.DeleteTodoList(list.Id))
+			},
+		},
+		{
+			name: "Transfer deleted todo list",
+			change: func(t *testing.T, database *InMemoryDatabase, member *User, list *TodoList) {
+				assert.Nil(t, database.TransferTodoList(list.Id, member.Id))
+				assert.Nil(t, database.DeleteTodoList(list.Id))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			directory := t.TempDir()
+			journalPath := filepath.Join(directory, "journal.jsonl")
+			snapshotPath := filepath.Join(directory, "snapshot.json")
+
+			database := journaledTestDatabase(t, journalPath)
+			owner, _ := database.CreateUser("owner", "$2a$10$hash")
+			member, _ := database.CreateUser("member", "$2a$10$hash")
+			list, _ := database.CreateTodoList(owner.Id, "Groceries", "")
+			assert.Nil(t, database.Compact(snapshotPath))
+
+			tt.change(t, database, member, list)
+			// Crash after the snapshot was saved, but before the journal was truncated
+			assert.Nil(t, database.SaveSnapshot(snapshotPath))
+			assert.Nil(t, database.CloseJournal())
+
+			restored := TestDatabase(nil, nil)
+			assert.Nil(t, restored.LoadSnapshot(snapshotPath))
+			assert.Nil(t, restored.OpenJournal(journalPath))
+			defer restored.CloseJournal()
+
+			assert.Equal(t, database.Users, restored.Users)
+			assert.Equal(t, database.TodoLists, restored.TodoLists)
+		})
+	}
+}
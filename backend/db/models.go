@@ -1,23 +1,136 @@
 package db
 
 import (
-	"errors"
+	"cmp"
 	"fmt"
+	"slices"
+	"strings"
 	"time"
 )
 
 type User struct {
 	Id   string
 	Name string
+	// bcrypt hash, empty for users that registered before passwords were required and can't log in
+	PasswordHash string
+	// Admins can manage users and use the debug endpoint
+	Admin bool
+	// Disabled users can't log in, and their tokens are rejected
+	Disabled bool
+}
+
+// compareUsers sorts users by name, and users with the same name by id.
+func compareUsers(a, b User) int {
+	return cmp.Or(strings.Compare(a.Name, b.Name), strings.Compare(a.Id, b.Id))
 }
 
 type AccessToken struct {
-	UserId string
-	Token  string
+	UserId    string
+	Token     string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+// RefreshToken is handed out together with AccessToken, to get a new access token once it expired.
+type RefreshToken struct {
+	UserId      string
+	Token       string
+	AccessToken string
+	IssuedAt    time.Time
+	ExpiresAt   time.Time
+}
+
+// Stats counts the stored data, to monitor how the backend is used.
+type Stats struct {
+	Users     int
+	TodoLists int
+	// Todos per status, across the workflows of all lists
+	TodosByStatus map[string]int
+	// Tokens that haven't expired yet
+	AccessTokens  int
+	RefreshTokens int
 }
 
 type TodoList struct {
-	Id string
+	Id          string
+	Title       string
+	Description string
+	OwnerId     string
+	MemberIds   []string
+	// Nil for lists that use the default workflow. Replace it rather than changing it, as copies share it
+	Workflow  *Workflow
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// IsMember is true for the owner and every invited member.
+func (l *TodoList) IsMember(userId string) bool {
+	return l.OwnerId == userId || slices.Contains(l.MemberIds, userId)
+}
+
+// StatusWorkflow returns the workflow the todos of this list follow.
+func (l *TodoList) StatusWorkflow() *Workflow {
+	if l.Workflow == nil {
+		return DefaultWorkflow()
+	}
+	return l.Workflow
+}
+
+// Workflow is the set of statuses a todo can have, and the status changes that are allowed between them.
+type Workflow struct {
+	// New todos start in the first status
+	Statuses    []string
+	Transitions map[string][]string
+}
+
+// DefaultWorkflow lets todos go from todo to ongoing, and from ongoing to done or back to todo.
+func DefaultWorkflow() *Workflow {
+	return &Workflow{
+		Statuses: []string{"todo", "ongoing", "done"},
+		Transitions: map[string][]string{
+			"todo":    {"ongoing"},
+			"ongoing": {"done", "todo"},
+			"done":    {"ongoing"},
+		},
+	}
+}
+
+func (w *Workflow) InitialStatus() string {
+	return w.Statuses[0]
+}
+
+func (w *Workflow) HasStatus(status string) bool {
+	return slices.Contains(w.Statuses, status)
+}
+
+func (w *Workflow) CanTransition(from string, to string) bool {
+	return slices.Contains(w.Transitions[from], to)
+}
+
+// Validate checks the workflow is consistent, every transition has to be between known statuses.
+func (w *Workflow) Validate() error {
+	if len(w.Statuses) == 0 {
+		return fmt.Errorf("%w: no statuses", ErrInvalidWorkflow)
+	}
+	for i, status := range w.Statuses {
+		if slices.Contains(w.Statuses[:i], status) {
+			return fmt.Errorf("%w: duplicate status %s", ErrInvalidWorkflow, status)
+		}
+	}
+	for from, targets := range w.Transitions {
+		if !w.HasStatus(from) {
+			return fmt.Errorf("%w: transition from unknown status %s", ErrInvalidWorkflow, from)
+		}
+		for _, to := range targets {
+			if !w.HasStatus(to) {
+				return fmt.Errorf("%w: transition to unknown status %s", ErrInvalidWorkflow, to)
+			}
+			if to == from {
+				return fmt.Errorf("%w: transition from %s to itself", ErrInvalidWorkflow, from)
+			}
+		}
+	}
+	return nil
 }
 
 type TodoItem struct {
@@ -29,19 +142,11 @@ type TodoItem struct {
 	Status      string
 }
 
-func (t *TodoItem) ChangeStatus(newStatus string) error {
-	if t.Status == "todo" || t.Status == "done" {
-		if newStatus == "ongoing" {
-			t.Status = newStatus
-			return nil
-		}
-		return errors.New(fmt.Sprintf("invalid status transition from %s to %s", t.Status, newStatus))
-	} else if t.Status == "ongoing" {
-		if newStatus == "done" || newStatus == "todo" {
-			t.Status = newStatus
-			return nil
-		}
-		return errors.New(fmt.Sprintf("invalid status transition from %s to %s", t.Status, newStatus))
+// ChangeStatus only allows the status changes of workflow, the workflow of the list the todo belongs to.
+func (t *TodoItem) ChangeStatus(newStatus string, workflow *Workflow) error {
+	if !workflow.CanTransition(t.Status, newStatus) {
+		return fmt.Errorf("%w from %s to %s", ErrInvalidTransition, t.Status, newStatus)
 	}
-	return errors.New(fmt.Sprintf("invalid status transition from %s to %s", t.Status, newStatus))
+	t.Status = newStatus
+	return nil
 }
@@ -9,6 +9,7 @@ import (
 
 func TestTodoItem_ChangeStatus(t *testing.T) {
 	tests := []struct {
+		workflow  *Workflow
 		oldStatus string
 		newStatus string
 		error     bool
@@ -50,22 +51,58 @@ func TestTodoItem_ChangeStatus(t *testing.T) {
 			newStatus: "invalid",
 			error:     true,
 		},
+		{
+			oldStatus: "ongoing",
+			newStatus: "ongoing",
+			error:     true,
+		},
+		// Custom workflow
+		{
+			workflow:  reviewWorkflow(),
+			oldStatus: "todo",
+			newStatus: "done",
+			error:     false,
+		},
+		{
+			workflow:  reviewWorkflow(),
+			oldStatus: "ongoing",
+			newStatus: "in review",
+			error:     false,
+		},
+		{
+			workflow:  reviewWorkflow(),
+			oldStatus: "ongoing",
+			newStatus: "done",
+			error:     true,
+		},
+		{
+			workflow:  reviewWorkflow(),
+			oldStatus: "done",
+			newStatus: "ongoing",
+			error:     true,
+		},
 	}
 
 	for _, tt := range tests {
+		workflow := tt.workflow
+		if workflow == nil {
+			workflow = DefaultWorkflow()
+		}
+
 		t.Run(fmt.Sprintf("from %s to %s", tt.oldStatus, tt.newStatus), func(t *testing.T) {
 			item := TodoItem{
 				Id:          "fake_id",
-				UpdatedAt:   util.FakeTime(2021, 1, 1),
+				UpdatedAt:   util.FakeTime(2021, 1, 1).UTC(),
 				Description: "fake description",
 				Status:      tt.oldStatus,
 				UserId:      "fake_user",
 			}
 
-			err := item.ChangeStatus(tt.newStatus)
+			err := item.ChangeStatus(tt.newStatus, workflow)
 			if err != nil || tt.error {
 				expected := fmt.Sprintf("invalid status transition from %s to %s", tt.oldStatus, tt.newStatus)
 				assert.Equal(t, tt.error, true)
+				assert.ErrorIs(t, err, ErrInvalidTransition)
 				assert.Equal(t, expected, err.Error())
 			} else {
 				assert.Equal(t, tt.newStatus, item.Status)
@@ -73,3 +110,77 @@ func TestTodoItem_ChangeStatus(t *testing.T) {
 		})
 	}
 }
+
+func TestWorkflow_Validate(t *testing.T) {
+	tests := []struct {
+		description string
+		workflow    Workflow
+		error       string
+	}{
+		{
+			description: "Default workflow",
+			workflow:    *DefaultWorkflow(),
+		},
+		{
+			description: "Custom workflow",
+			workflow:    *reviewWorkflow(),
+		},
+		{
+			description: "Without transitions",
+			workflow:    Workflow{Statuses: []string{"todo"}},
+		},
+		{
+			description: "No statuses",
+			workflow:    Workflow{Statuses: []string{}},
+			error:       "invalid workflow: no statuses",
+		},
+		{
+			description: "Duplicate status",
+			workflow:    Workflow{Statuses: []string{"todo", "done", "todo"}},
+			error:       "invalid workflow: duplicate status todo",
+		},
+		{
+			description: "Transition from unknown status",
+			workflow:    Workflow{Statuses: []string{"todo"}, Transitions: map[string][]string{"done": {"todo"}}},
+			error:       "invalid workflow: transition from unknown status done",
+		},
+		{
+			description: "Transition to unknown status",
+			workflow:    Workflow{Statuses: []string{"todo"}, Transitions: map[string][]string{"todo": {"done"}}},
+			error:       "invalid workflow: transition to unknown status done",
+		},
+		{
+			description: "Transition to itself",
+			workflow:    Workflow{Statuses: []string{"todo"}, Transitions: map[string][]string{"todo": {"todo"}}},
+			error:       "invalid workflow: transition from todo to itself",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.description, func(t *testing.T) {
+			err := tt.workflow.Validate()
+			if tt.error == "" {
+				assert.Nil(t, err)
+			} else {
+				assert.ErrorIs(t, err, ErrInvalidWorkflow)
+				assert.EqualError(t, err, tt.error)
+			}
+		})
+	}
+}
+
+func TestTodoList_StatusWorkflow(t *testing.T) {
+	assert.Equal(t, DefaultWorkflow(), (&TodoList{}).StatusWorkflow())
+	assert.Equal(t, reviewWorkflow(), (&TodoList{Workflow: reviewWorkflow()}).StatusWorkflow())
+}
+
+func reviewWorkflow() *Workflow {
+	return &Workflow{
+		Statuses: []string{"todo", "ongoing", "in review", "done"},
+		Transitions: map[string][]string{
+			"todo":      {"ongoing", "done"},
+			"ongoing":   {"in review"},
+			"in review": {"ongoing", "done"},
+		},
+	}
+}
@@ -0,0 +1,144 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Bump when the snapshot format changes in a backwards incompatible way
+const snapshotVersion = 1
+
+type snapshot struct {
+	Version       int                     `json:"version"`
+	Users         map[string]User         `json:"users"`
+	AccessTokens  map[string]AccessToken  `json:"access_tokens"`
+	RefreshTokens map[string]RefreshToken `json:"refresh_tokens"`
+	TodoLists     map[string]TodoList     `json:"todo_lists"`
+	TodoItems     map[string]TodoItem     `json:"todo_items"`
+	TodoItemOrder []string                `json:"todo_item_order"`
+}
+
+// SaveSnapshot writes the entire database to path. The snapshot is written to a temporary file first,
+// so a crash halfway never corrupts the previous snapshot.
+func (d *InMemoryDatabase) SaveSnapshot(path string) error {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	return d.saveSnapshot(path)
+}
+
+// saveSnapshot expects the caller to hold the lock.
+func (d *InMemoryDatabase) saveSnapshot(path string) error {
+	data, err := json.Marshal(snapshot{
+		Version:       snapshotVersion,
+		Users:         d.Users,
+		AccessTokens:  d.AccessTokens,
+		RefreshTokens: d.RefreshTokens,
+		TodoLists:     d.TodoLists,
+		TodoItems:     d.TodoItems,
+		TodoItemOrder: d.TodoItemOrder,
+	})
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err = file.Write(data); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err = file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// LoadSnapshot replaces the contents of the database with the snapshot stored at path.
+// A missing snapshot is not an error and leaves the database untouched.
+func (d *InMemoryDatabase) LoadSnapshot(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var contents snapshot
+	if err = json.Unmarshal(data, &contents); err != nil {
+		return fmt.Errorf("corrupt snapshot %s: %w", path, err)
+	}
+	if err = contents.validate(); err != nil {
+		return fmt.Errorf("corrupt snapshot %s: %w", path, err)
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.Users = contents.Users
+	d.AccessTokens = contents.AccessTokens
+	d.RefreshTokens = contents.RefreshTokens
+	d.TodoLists = contents.TodoLists
+	d.TodoItems = contents.TodoItems
+	d.TodoItemOrder = contents.TodoItemOrder
+	return nil
+}
+
+func (s *snapshot) validate() error {
+	if s.Version != snapshotVersion {
+		return fmt.Errorf("unsupported version %d, expected %d", s.Version, snapshotVersion)
+	}
+	// Snapshots saved before refresh tokens existed don't have them
+	if s.RefreshTokens == nil {
+		s.RefreshTokens = make(map[string]RefreshToken)
+	}
+	if s.Users == nil || s.AccessTokens == nil || s.TodoLists == nil || s.TodoItems == nil || s.TodoItemOrder == nil {
+		return errors.New("missing tables")
+	}
+
+	for id, user := range s.Users {
+		if id != user.Id {
+			return fmt.Errorf("user %s stored as %s", user.Id, id)
+		}
+	}
+	for token, accessToken := range s.AccessTokens {
+		if token != accessToken.Token {
+			// Don't leak the token in the error message
+			return fmt.Errorf("access token of user %s stored under wrong key", accessToken.UserId)
+		}
+	}
+	for token, refreshToken := range s.RefreshTokens {
+		if token != refreshToken.Token {
+			return fmt.Errorf("refresh token of user %s stored under wrong key", refreshToken.UserId)
+		}
+	}
+	for id, list := range s.TodoLists {
+		if id != list.Id {
+			return fmt.Errorf("todo list %s stored as %s", list.Id, id)
+		}
+	}
+	ordered := make(map[string]bool, len(s.TodoItemOrder))
+	for _, id := range s.TodoItemOrder {
+		ordered[id] = true
+	}
+	for id, item := range s.TodoItems {
+		if id != item.Id {
+			return fmt.Errorf("todo %s stored as %s", item.Id, id)
+		}
+		if !ordered[id] {
+			return fmt.Errorf("todo %s missing from todo item order", id)
+		}
+	}
+	return nil
+}
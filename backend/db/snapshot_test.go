@@ -0,0 +1,93 @@
+package db
+
+import (
+	"backend/util"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInMemoryDatabase_SaveAndLoadSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+
+	database := TestDatabase(nil, nil)
+	database.Users["usr_1"] = User{Id: "usr_1", Name: "test user"}
+	database.AccessTokens["tkn_1"] = AccessToken{UserId: "usr_1", Token: "tkn_1"}
+	database.TodoLists["lst_1"] = TodoList{Id: "lst_1"}
+	database.TodoItems["tdo_1"] = TodoItem{Id: "tdo_1", ListId: "lst_1", UserId: "usr_1", Description: "first todo", Status: "todo", UpdatedAt: util.FakeTime(2024, 1, 1).UTC()}
+	database.TodoItemOrder = []string{"tdo_1"}
+
+	assert.Nil(t, database.SaveSnapshot(path))
+
+	restored := TestDatabase(nil, nil)
+	assert.Nil(t, restored.LoadSnapshot(path))
+
+	assert.Equal(t, database.Users, restored.Users)
+	assert.Equal(t, database.AccessTokens, restored.AccessTokens)
+	assert.Equal(t, database.TodoLists, restored.TodoLists)
+	assert.Equal(t, database.TodoItems, restored.TodoItems)
+	assert.Equal(t, database.TodoItemOrder, restored.TodoItemOrder)
+}
+
+func TestInMemoryDatabase_LoadMissingSnapshot(t *testing.T) {
+	database := TestDatabase(nil, nil)
+	database.Users["usr_1"] = User{Id: "usr_1", Name: "test user"}
+
+	err := database.LoadSnapshot(filepath.Join(t.TempDir(), "missing.json"))
+
+	assert.Nil(t, err)
+	assert.Len(t, database.Users, 1)
+}
+
+func TestInMemoryDatabase_LoadCorruptSnapshot(t *testing.T) {
+	tests := []struct {
+		description string
+		contents    string
+		err         string
+	}{
+		{
+			description: "Not json",
+			contents:    `not json`,
+			err:         "invalid character 'o' in literal null (expecting 'u')",
+		},
+		{
+			description: "Truncated",
+			contents:    `{"version":1,"users":{`,
+			err:         "unexpected end of JSON input",
+		},
+		{
+			description: "Unsupported version",
+			contents:    `{"version":2,"users":{},"access_tokens":{},"todo_lists":{},"todo_items":{},"todo_item_order":[]}`,
+			err:         "unsupported version 2, expected 1",
+		},
+		{
+			description: "Missing tables",
+			contents:    `{"version":1,"users":{}}`,
+			err:         "missing tables",
+		},
+		{
+			description: "Mismatching key",
+			contents:    `{"version":1,"users":{"usr_1":{"Id":"usr_2"}},"access_tokens":{},"todo_lists":{},"todo_items":{},"todo_item_order":[]}`,
+			err:         "user usr_2 stored as usr_1",
+		},
+		{
+			description: "Unordered todo",
+			contents:    `{"version":1,"users":{},"access_tokens":{},"todo_lists":{},"todo_items":{"tdo_1":{"Id":"tdo_1"}},"todo_item_order":[]}`,
+			err:         "todo tdo_1 missing from todo item order",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.description, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "snapshot.json")
+			assert.Nil(t, os.WriteFile(path, []byte(tt.contents), 0600))
+
+			database := TestDatabase(nil, nil)
+			err := database.LoadSnapshot(path)
+
+			assert.EqualError(t, err, "corrupt snapshot "+path+": "+tt.err)
+			assert.Empty(t, database.Users)
+		})
+	}
+}
@@ -0,0 +1,1039 @@
+package db
+
+import (
+	"backend/util"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteMigrations are applied in order, PRAGMA user_version tracks how many already ran.
+// Never edit an existing migration, append a new one instead.
+var sqliteMigrations = []string{
+	`CREATE TABLE users (
+		id   TEXT PRIMARY KEY,
+		name TEXT NOT NULL
+	);
+	CREATE TABLE access_tokens (
+		token   TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL REFERENCES users (id)
+	);
+	CREATE TABLE todo_lists (
+		id TEXT PRIMARY KEY
+	);
+	CREATE TABLE todo_items (
+		position    INTEGER PRIMARY KEY AUTOINCREMENT,
+		id          TEXT NOT NULL UNIQUE,
+		list_id     TEXT NOT NULL REFERENCES todo_lists (id),
+		user_id     TEXT NOT NULL REFERENCES users (id),
+		description TEXT NOT NULL,
+		status      TEXT NOT NULL,
+		updated_at  INTEGER NOT NULL
+	);
+	CREATE INDEX todo_items_list_id ON todo_items (list_id);`,
+	// Lists created before ownership existed have no owner, so nobody can access them
+	`ALTER TABLE todo_lists ADD COLUMN owner_id TEXT NOT NULL DEFAULT '';
+	CREATE TABLE todo_list_members (
+		list_id TEXT NOT NULL REFERENCES todo_lists (id),
+		user_id TEXT NOT NULL REFERENCES users (id),
+		UNIQUE (list_id, user_id)
+	);`,
+	`ALTER TABLE todo_lists ADD COLUMN title TEXT NOT NULL DEFAULT '';
+	ALTER TABLE todo_lists ADD COLUMN description TEXT NOT NULL DEFAULT '';
+	ALTER TABLE todo_lists ADD COLUMN created_at INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE todo_lists ADD COLUMN updated_at INTEGER NOT NULL DEFAULT 0;`,
+	// JSON encoded, empty for lists that use the default workflow
+	`ALTER TABLE todo_lists ADD COLUMN workflow TEXT NOT NULL DEFAULT '';`,
+	// Users without a password can't log in, so their names don't have to be unique
+	`ALTER TABLE users ADD COLUMN password_hash TEXT NOT NULL DEFAULT '';
+	CREATE UNIQUE INDEX users_name ON users (name) WHERE password_hash != '';`,
+	// Tokens created before tokens could expire get an expiry of 0, so they are rejected
+	`ALTER TABLE access_tokens ADD COLUMN issued_at INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE access_tokens ADD COLUMN expires_at INTEGER NOT NULL DEFAULT 0;
+	CREATE TABLE refresh_tokens (
+		token        TEXT PRIMARY KEY,
+		user_id      TEXT NOT NULL,
+		access_token TEXT NOT NULL,
+		issued_at    INTEGER NOT NULL,
+		expires_at   INTEGER NOT NULL
+	);`,
+	`ALTER TABLE users ADD COLUMN admin INTEGER NOT NULL DEFAULT 0;`,
+	`ALTER TABLE users ADD COLUMN disabled INTEGER NOT NULL DEFAULT 0;`,
+	// Expired tokens are deleted whenever a session starts
+	`CREATE INDEX access_tokens_expires_at ON access_tokens (expires_at);
+	CREATE INDEX refresh_tokens_expires_at ON refresh_tokens (expires_at);`,
+}
+
+type SqliteDatabase struct {
+	db           *sql.DB
+	currentTime  util.CurrentTime
+	generateUuid util.GenerateUuid
+}
+
+func CreateSqliteDatabase(path string) (*SqliteDatabase, error) {
+	return openSqliteDatabase(path, util.GetCurrentTime, util.GenerateRandomUuid)
+}
+
+func openSqliteDatabase(path string, currentTime util.CurrentTime, generateUuid util.GenerateUuid) (*SqliteDatabase, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite only allows a single writer, and every connection to ":memory:" would get its own database
+	db.SetMaxOpenConns(1)
+
+	if err = migrateSqlite(db); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return &SqliteDatabase{
+		db:           db,
+		currentTime:  currentTime,
+		generateUuid: generateUuid,
+	}, nil
+}
+
+func migrateSqlite(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+
+	for i := version; i < len(sqliteMigrations); i++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err = tx.Exec(sqliteMigrations[i]); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+		// PRAGMA doesn't support bind parameters
+		if _, err = tx.Exec("PRAGMA user_version = " + strconv.Itoa(i+1)); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TestSqliteDatabase creates an in-memory SQLite database containing the same data as seed.
+func TestSqliteDatabase(seed *InMemoryDatabase) (*SqliteDatabase, error) {
+	database, err := openSqliteDatabase(":memory:", seed.currentTime, seed.generateUuid)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = database.insertSeed(seed); err != nil {
+		_ = database.Close()
+		return nil, err
+	}
+	return database, nil
+}
+
+// Dump reads the entire database into an InMemoryDatabase.
+func (d *SqliteDatabase) Dump() (*InMemoryDatabase, error) {
+	dump := TestDatabase(d.currentTime, d.generateUuid)
+	dump.TodoItemOrder = []string{}
+
+	rows, err := d.db.Query("SELECT " + userColumns + " FROM users")
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var user User
+		if err = rows.Scan(&user.Id, &user.Name, &user.PasswordHash, &user.Admin, &user.Disabled); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		dump.Users[user.Id] = user
+	}
+	_ = rows.Close()
+
+	rows, err = d.db.Query("SELECT token, user_id, issued_at, expires_at FROM access_tokens")
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var token AccessToken
+		var issuedAt, expiresAt int64
+		if err = rows.Scan(&token.Token, &token.UserId, &issuedAt, &expiresAt); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		token.IssuedAt = fromUnixNano(issuedAt)
+		token.ExpiresAt = fromUnixNano(expiresAt)
+		dump.AccessTokens[token.Token] = token
+	}
+	_ = rows.Close()
+
+	rows, err = d.db.Query("SELECT token, user_id, access_token, issued_at, expires_at FROM refresh_tokens")
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var token RefreshToken
+		var issuedAt, expiresAt int64
+		if err = rows.Scan(&token.Token, &token.UserId, &token.AccessToken, &issuedAt, &expiresAt); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		token.IssuedAt = fromUnixNano(issuedAt)
+		token.ExpiresAt = fromUnixNano(expiresAt)
+		dump.RefreshTokens[token.Token] = token
+	}
+	_ = rows.Close()
+
+	rows, err = d.db.Query("SELECT id FROM todo_lists")
+	if err != nil {
+		return nil, err
+	}
+	var listIds []string
+	for rows.Next() {
+		var listId string
+		if err = rows.Scan(&listId); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		listIds = append(listIds, listId)
+	}
+	_ = rows.Close()
+	for _, listId := range listIds {
+		list, err := d.queryTodoList(listId)
+		if err != nil {
+			return nil, err
+		}
+		dump.TodoLists[list.Id] = *list
+	}
+
+	items, err := d.queryTodos("SELECT " + todoColumns + " FROM todo_items ORDER BY position")
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		dump.TodoItems[item.Id] = item
+		dump.TodoItemOrder = append(dump.TodoItemOrder, item.Id)
+	}
+
+	return dump, nil
+}
+
+func (d *SqliteDatabase) Close() error {
+	return d.db.Close()
+}
+
+// Ping takes the write lock without changing anything, which fails when the file became read-only or is locked by
+// another process.
+func (d *SqliteDatabase) Ping() error {
+	ctx := context.Background()
+	conn, err := d.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err = conn.ExecContext(ctx, "BEGIN IMMEDIATE"); err != nil {
+		return err
+	}
+	_, err = conn.ExecContext(ctx, "ROLLBACK")
+	return err
+}
+
+// CreateUser fails when the name is already taken, as users log in with their name.
+func (d *SqliteDatabase) CreateUser(name string, passwordHash string) (*User, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	user := User{
+		Id:           d.generateUuid("usr"),
+		Name:         name,
+		PasswordHash: passwordHash,
+	}
+	if err = checkUserName(tx, user); err != nil {
+		return nil, err
+	}
+	if _, err = tx.Exec("INSERT INTO users ("+userColumns+") VALUES (?, ?, ?, ?, ?)",
+		user.Id, user.Name, user.PasswordHash, user.Admin, user.Disabled); err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+const userColumns = "id, name, password_hash, admin, disabled"
+
+func (d *SqliteDatabase) GetUser(userId string) (*User, error) {
+	return d.queryUser("SELECT "+userColumns+" FROM users WHERE id = ?", userId)
+}
+
+func (d *SqliteDatabase) GetUserByName(name string) (*User, error) {
+	return d.queryUser("SELECT "+userColumns+" FROM users WHERE name = ? LIMIT 1", name)
+}
+
+// UpdateUser fails when the user is renamed to a name that is already taken.
+func (d *SqliteDatabase) UpdateUser(user *User) (*User, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err = checkUserName(tx, *user); err != nil {
+		return nil, err
+	}
+	result, err := tx.Exec("UPDATE users SET name = ?, password_hash = ?, admin = ?, disabled = ? WHERE id = ?",
+		user.Name, user.PasswordHash, user.Admin, user.Disabled, user.Id)
+	if err != nil {
+		return nil, err
+	}
+	if updated, err := result.RowsAffected(); err != nil {
+		return nil, err
+	} else if updated == 0 {
+		return nil, ErrUserNotFound
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// checkUserName fails when another user already has the name of user. Run it in the transaction that writes the name,
+// so a concurrent request can't take the name in between.
+func checkUserName(tx *sql.Tx, user User) error {
+	var taken bool
+	err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM users WHERE name = ? AND id != ?)", user.Name, user.Id).Scan(&taken)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrUserNameTaken
+	}
+	return nil
+}
+
+// GetUsers returns every user, sorted by name.
+func (d *SqliteDatabase) GetUsers() (*[]User, error) {
+	rows, err := d.db.Query("SELECT " + userColumns + " FROM users ORDER BY name, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		var user User
+		if err = rows.Scan(&user.Id, &user.Name, &user.PasswordHash, &user.Admin, &user.Disabled); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return &users, rows.Err()
+}
+
+// DeleteUser also deletes their tokens and memberships. Users that still own todo lists can't be deleted, transfer
+// the lists first. Their todos are kept.
+func (d *SqliteDatabase) DeleteUser(userId string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var ownsLists bool
+	if err = tx.QueryRow("SELECT EXISTS (SELECT 1 FROM todo_lists WHERE owner_id = ?)", userId).Scan(&ownsLists); err != nil {
+		return err
+	}
+
+	result, err := tx.Exec("DELETE FROM users WHERE id = ?", userId)
+	if err != nil {
+		return err
+	}
+	if deleted, err := result.RowsAffected(); err != nil {
+		return err
+	} else if deleted == 0 {
+		return ErrUserNotFound
+	}
+	if ownsLists {
+		return ErrUserOwnsTodoLists
+	}
+
+	for _, query := range []string{
+		"DELETE FROM access_tokens WHERE user_id = ?",
+		"DELETE FROM refresh_tokens WHERE user_id = ?",
+		"DELETE FROM todo_list_members WHERE user_id = ?",
+	} {
+		if _, err = tx.Exec(query, userId); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (d *SqliteDatabase) queryUser(query string, args ...any) (*User, error) {
+	var user User
+	err := d.db.QueryRow(query, args...).Scan(&user.Id, &user.Name, &user.PasswordHash, &user.Admin, &user.Disabled)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (d *SqliteDatabase) insertUser(user User) error {
+	_, err := d.db.Exec("INSERT INTO users ("+userColumns+") VALUES (?, ?, ?, ?, ?)",
+		user.Id, user.Name, user.PasswordHash, user.Admin, user.Disabled)
+	return err
+}
+
+func (d *SqliteDatabase) CreateAccessToken(accountNumber string, lifetime time.Duration) (*AccessToken, error) {
+	now := d.now()
+	accessToken := AccessToken{
+		UserId:    accountNumber,
+		Token:     d.generateUuid("tkn"),
+		IssuedAt:  now,
+		ExpiresAt: now.Add(lifetime),
+	}
+	if err := d.insertAccessToken(accessToken); err != nil {
+		return nil, err
+	}
+	return &accessToken, nil
+}
+
+// GetAccessToken rejects expired tokens, tokens without an expiry never were valid.
+func (d *SqliteDatabase) GetAccessToken(token string) (*AccessToken, error) {
+	if !regexp.MustCompile(accessTokenRegex).MatchString(token) {
+		return nil, ErrInvalidAccessToken
+	}
+
+	var accessToken AccessToken
+	var issuedAt, expiresAt int64
+	err := d.db.QueryRow("SELECT token, user_id, issued_at, expires_at FROM access_tokens WHERE token = ?", token).
+		Scan(&accessToken.Token, &accessToken.UserId, &issuedAt, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidAccessToken
+	} else if err != nil {
+		return nil, err
+	}
+	accessToken.IssuedAt = fromUnixNano(issuedAt)
+	accessToken.ExpiresAt = fromUnixNano(expiresAt)
+	if !d.now().Before(accessToken.ExpiresAt) {
+		return nil, ErrAccessTokenExpired
+	}
+	return &accessToken, nil
+}
+
+// DeleteAccessToken also deletes the refresh token handed out with it, ending the session.
+// Signed access tokens aren't stored, so only their refresh token is deleted.
+func (d *SqliteDatabase) DeleteAccessToken(token string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var deleted int64
+	for _, query := range []string{"DELETE FROM access_tokens WHERE token = ?", "DELETE FROM refresh_tokens WHERE access_token = ?"} {
+		result, err := tx.Exec(query, token)
+		if err != nil {
+			return err
+		}
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		deleted += rows
+	}
+	if deleted == 0 {
+		return ErrInvalidAccessToken
+	}
+	return tx.Commit()
+}
+
+// CreateRefreshToken also deletes the expired tokens. Every session starts with a refresh token, also with signed access
+// tokens, so they don't pile up.
+func (d *SqliteDatabase) CreateRefreshToken(accessToken *AccessToken, lifetime time.Duration) (*RefreshToken, error) {
+	now := d.now()
+	for _, query := range []string{"DELETE FROM access_tokens WHERE expires_at <= ?", "DELETE FROM refresh_tokens WHERE expires_at <= ?"} {
+		if _, err := d.db.Exec(query, toUnixNano(now)); err != nil {
+			return nil, err
+		}
+	}
+	refreshToken := RefreshToken{
+		UserId:      accessToken.UserId,
+		Token:       d.generateUuid("rtk"),
+		AccessToken: accessToken.Token,
+		IssuedAt:    now,
+		ExpiresAt:   now.Add(lifetime),
+	}
+	if err := d.insertRefreshToken(refreshToken); err != nil {
+		return nil, err
+	}
+	return &refreshToken, nil
+}
+
+func (d *SqliteDatabase) GetRefreshToken(token string) (*RefreshToken, error) {
+	if !regexp.MustCompile(refreshTokenRegex).MatchString(token) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	var refreshToken RefreshToken
+	var issuedAt, expiresAt int64
+	err := d.db.QueryRow("SELECT token, user_id, access_token, issued_at, expires_at FROM refresh_tokens WHERE token = ?", token).
+		Scan(&refreshToken.Token, &refreshToken.UserId, &refreshToken.AccessToken, &issuedAt, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidRefreshToken
+	} else if err != nil {
+		return nil, err
+	}
+	refreshToken.IssuedAt = fromUnixNano(issuedAt)
+	refreshToken.ExpiresAt = fromUnixNano(expiresAt)
+	if !d.now().Before(refreshToken.ExpiresAt) {
+		return nil, ErrRefreshTokenExpired
+	}
+	return &refreshToken, nil
+}
+
+func (d *SqliteDatabase) DeleteRefreshToken(token string) error {
+	result, err := d.db.Exec("DELETE FROM refresh_tokens WHERE token = ?", token)
+	if err != nil {
+		return err
+	}
+	if deleted, err := result.RowsAffected(); err != nil {
+		return err
+	} else if deleted == 0 {
+		return ErrInvalidRefreshToken
+	}
+	return nil
+}
+
+// DeleteUserTokens deletes every access and refresh token of the user, ending all their sessions.
+func (d *SqliteDatabase) DeleteUserTokens(userId string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec("DELETE FROM access_tokens WHERE user_id = ?", userId); err != nil {
+		return err
+	}
+	if _, err = tx.Exec("DELETE FROM refresh_tokens WHERE user_id = ?", userId); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (d *SqliteDatabase) insertAccessToken(token AccessToken) error {
+	_, err := d.db.Exec(
+		"INSERT INTO access_tokens (token, user_id, issued_at, expires_at) VALUES (?, ?, ?, ?)",
+		token.Token, token.UserId, toUnixNano(token.IssuedAt), toUnixNano(token.ExpiresAt),
+	)
+	return err
+}
+
+func (d *SqliteDatabase) insertRefreshToken(token RefreshToken) error {
+	_, err := d.db.Exec(
+		"INSERT INTO refresh_tokens (token, user_id, access_token, issued_at, expires_at) VALUES (?, ?, ?, ?, ?)",
+		token.Token, token.UserId, token.AccessToken, toUnixNano(token.IssuedAt), toUnixNano(token.ExpiresAt),
+	)
+	return err
+}
+
+func (d *SqliteDatabase) CreateTodoList(ownerId string, title string, description string) (*TodoList, error) {
+	now := d.now()
+	todoList := TodoList{
+		Id:          d.generateUuid("lst"),
+		Title:       title,
+		Description: description,
+		OwnerId:     ownerId,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := d.insertTodoList(todoList); err != nil {
+		return nil, err
+	}
+	return &todoList, nil
+}
+
+// UpdateTodoList doesn't change the owner or the members, use TransferTodoList, AddTodoListMember and
+// RemoveTodoListMember instead.
+func (d *SqliteDatabase) UpdateTodoList(todoList *TodoList) (*TodoList, error) {
+	stored, err := d.queryTodoList(todoList.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	workflow, err := encodeWorkflow(todoList.Workflow)
+	if err != nil {
+		return nil, err
+	}
+
+	todoList.OwnerId = stored.OwnerId
+	todoList.MemberIds = stored.MemberIds
+	todoList.UpdatedAt = d.now()
+	_, err = d.db.Exec(
+		"UPDATE todo_lists SET title = ?, description = ?, workflow = ?, created_at = ?, updated_at = ? WHERE id = ?",
+		todoList.Title, todoList.Description, workflow, toUnixNano(todoList.CreatedAt), toUnixNano(todoList.UpdatedAt), todoList.Id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return todoList, nil
+}
+
+func (d *SqliteDatabase) GetTodoList(listId string) (*TodoList, error) {
+	if !regexp.MustCompile(listIdRegex).MatchString(listId) {
+		return nil, ErrInvalidTodoListId
+	}
+	return d.queryTodoList(listId)
+}
+
+func (d *SqliteDatabase) queryTodoList(listId string) (*TodoList, error) {
+	var todoList TodoList
+	var workflow string
+	var createdAt, updatedAt int64
+	err := d.db.QueryRow("SELECT id, title, description, owner_id, workflow, created_at, updated_at FROM todo_lists WHERE id = ?", listId).
+		Scan(&todoList.Id, &todoList.Title, &todoList.Description, &todoList.OwnerId, &workflow, &createdAt, &updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTodoListNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	if todoList.Workflow, err = decodeWorkflow(workflow); err != nil {
+		return nil, err
+	}
+	todoList.CreatedAt = fromUnixNano(createdAt)
+	todoList.UpdatedAt = fromUnixNano(updatedAt)
+
+	rows, err := d.db.Query("SELECT user_id FROM todo_list_members WHERE list_id = ? ORDER BY rowid", listId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var userId string
+		if err = rows.Scan(&userId); err != nil {
+			return nil, err
+		}
+		todoList.MemberIds = append(todoList.MemberIds, userId)
+	}
+	return &todoList, rows.Err()
+}
+
+// GetTodoLists returns all lists the user owns or is a member of, sorted by id.
+func (d *SqliteDatabase) GetTodoLists(userId string) (*[]TodoList, error) {
+	rows, err := d.db.Query(
+		`SELECT id FROM todo_lists
+		WHERE owner_id = ? OR id IN (SELECT list_id FROM todo_list_members WHERE user_id = ?)
+		ORDER BY id`,
+		userId, userId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	var listIds []string
+	for rows.Next() {
+		var listId string
+		if err = rows.Scan(&listId); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		listIds = append(listIds, listId)
+	}
+	_ = rows.Close()
+
+	todoLists := []TodoList{}
+	for _, listId := range listIds {
+		todoList, err := d.queryTodoList(listId)
+		if err != nil {
+			return nil, err
+		}
+		todoLists = append(todoLists, *todoList)
+	}
+	return &todoLists, nil
+}
+
+// AddTodoListMember does nothing when the user already is a member.
+func (d *SqliteDatabase) AddTodoListMember(listId string, userId string) error {
+	if err := d.ensureTodoListExists(listId); err != nil {
+		return err
+	}
+	_, err := d.db.Exec("INSERT OR IGNORE INTO todo_list_members (list_id, user_id) VALUES (?, ?)", listId, userId)
+	return err
+}
+
+func (d *SqliteDatabase) RemoveTodoListMember(listId string, userId string) error {
+	if err := d.ensureTodoListExists(listId); err != nil {
+		return err
+	}
+
+	result, err := d.db.Exec("DELETE FROM todo_list_members WHERE list_id = ? AND user_id = ?", listId, userId)
+	if err != nil {
+		return err
+	}
+	if deleted, err := result.RowsAffected(); err != nil {
+		return err
+	} else if deleted == 0 {
+		return ErrNotAMember
+	}
+	return nil
+}
+
+// TransferTodoList makes ownerId the owner of the list, the previous owner stays a member.
+func (d *SqliteDatabase) TransferTodoList(listId string, ownerId string) error {
+	todoList, err := d.queryTodoList(listId)
+	if err != nil {
+		return err
+	}
+	if _, err = d.GetUser(ownerId); err != nil {
+		return err
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec("INSERT OR IGNORE INTO todo_list_members (list_id, user_id) VALUES (?, ?)", listId, todoList.OwnerId); err != nil {
+		return err
+	}
+	if _, err = tx.Exec("DELETE FROM todo_list_members WHERE list_id = ? AND user_id = ?", listId, ownerId); err != nil {
+		return err
+	}
+	if _, err = tx.Exec("UPDATE todo_lists SET owner_id = ? WHERE id = ?", ownerId, listId); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (d *SqliteDatabase) CreateTodo(listId string, description string, user string) (*TodoItem, error) {
+	status, err := d.initialStatus(listId)
+	if err != nil {
+		return nil, err
+	}
+
+	item := TodoItem{
+		Id:          d.generateUuid("tdo"),
+		ListId:      listId,
+		Description: description,
+		Status:      status,
+		UserId:      user,
+		UpdatedAt:   d.now(),
+	}
+	if err := d.insertTodo(item); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (d *SqliteDatabase) UpdateTodo(todo *TodoItem) (*TodoItem, error) {
+	todo.UpdatedAt = d.now()
+	result, err := d.db.Exec(
+		"UPDATE todo_items SET list_id = ?, user_id = ?, description = ?, status = ?, updated_at = ? WHERE id = ?",
+		todo.ListId, todo.UserId, todo.Description, todo.Status, toUnixNano(todo.UpdatedAt), todo.Id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if updated, err := result.RowsAffected(); err != nil {
+		return nil, err
+	} else if updated == 0 {
+		return nil, ErrTodoNotFound
+	}
+	return todo, nil
+}
+
+func (d *SqliteDatabase) GetTodo(todoId string) (*TodoItem, error) {
+	if !regexp.MustCompile(todoIdRegex).MatchString(todoId) {
+		return nil, ErrInvalidTodoId
+	}
+
+	items, err := d.queryTodos("SELECT "+todoColumns+" FROM todo_items WHERE id = ?", todoId)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, ErrTodoNotFound
+	}
+	return &items[0], nil
+}
+
+func (d *SqliteDatabase) GetTodos(listId string) (*[]TodoItem, error) {
+	if !regexp.MustCompile(listIdRegex).MatchString(listId) {
+		return nil, ErrInvalidTodoListId
+	}
+
+	if err := d.ensureTodoListExists(listId); err != nil {
+		return nil, err
+	}
+
+	items, err := d.queryTodos("SELECT "+todoColumns+" FROM todo_items WHERE list_id = ? ORDER BY position", listId)
+	if err != nil {
+		return nil, err
+	}
+	return &items, nil
+}
+
+func (d *SqliteDatabase) DeleteTodo(todoId string) error {
+	if !regexp.MustCompile(todoIdRegex).MatchString(todoId) {
+		return ErrInvalidTodoId
+	}
+
+	result, err := d.db.Exec("DELETE FROM todo_items WHERE id = ?", todoId)
+	if err != nil {
+		return err
+	}
+	if deleted, err := result.RowsAffected(); err != nil {
+		return err
+	} else if deleted == 0 {
+		return ErrTodoNotFound
+	}
+	return nil
+}
+
+// DeleteTodoList also deletes all todos on the list.
+func (d *SqliteDatabase) DeleteTodoList(listId string) error {
+	if !regexp.MustCompile(listIdRegex).MatchString(listId) {
+		return ErrInvalidTodoListId
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("DELETE FROM todo_lists WHERE id = ?", listId)
+	if err != nil {
+		return err
+	}
+	if deleted, err := result.RowsAffected(); err != nil {
+		return err
+	} else if deleted == 0 {
+		return ErrTodoListNotFound
+	}
+	if _, err = tx.Exec("DELETE FROM todo_items WHERE list_id = ?", listId); err != nil {
+		return err
+	}
+	if _, err = tx.Exec("DELETE FROM todo_list_members WHERE list_id = ?", listId); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (d *SqliteDatabase) Stats() (*Stats, error) {
+	now := toUnixNano(d.now())
+	stats := Stats{TodosByStatus: make(map[string]int)}
+	counts := []struct {
+		query string
+		args  []any
+		count *int
+	}{
+		{"SELECT COUNT(*) FROM users", nil, &stats.Users},
+		{"SELECT COUNT(*) FROM todo_lists", nil, &stats.TodoLists},
+		{"SELECT COUNT(*) FROM access_tokens WHERE expires_at > ?", []any{now}, &stats.AccessTokens},
+		{"SELECT COUNT(*) FROM refresh_tokens WHERE expires_at > ?", []any{now}, &stats.RefreshTokens},
+	}
+	for _, c := range counts {
+		if err := d.db.QueryRow(c.query, c.args...).Scan(c.count); err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err := d.db.Query("SELECT status, COUNT(*) FROM todo_items GROUP BY status")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, err
+		}
+		stats.TodosByStatus[status] = count
+	}
+	return &stats, rows.Err()
+}
+
+func (d *SqliteDatabase) ensureTodoListExists(listId string) error {
+	var exists bool
+	err := d.db.QueryRow("SELECT EXISTS (SELECT 1 FROM todo_lists WHERE id = ?)", listId).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrTodoListNotFound
+	}
+	return nil
+}
+
+const todoColumns = "id, list_id, user_id, description, status, updated_at"
+
+func (d *SqliteDatabase) queryTodos(query string, args ...any) ([]TodoItem, error) {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []TodoItem
+	for rows.Next() {
+		var item TodoItem
+		var updatedAt int64
+		if err = rows.Scan(&item.Id, &item.ListId, &item.UserId, &item.Description, &item.Status, &updatedAt); err != nil {
+			return nil, err
+		}
+		item.UpdatedAt = fromUnixNano(updatedAt)
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func (d *SqliteDatabase) insertSeed(seed *InMemoryDatabase) error {
+	for _, user := range seed.Users {
+		if err := d.insertUser(user); err != nil {
+			return err
+		}
+	}
+	for _, token := range seed.AccessTokens {
+		if err := d.insertAccessToken(token); err != nil {
+			return err
+		}
+	}
+	for _, token := range seed.RefreshTokens {
+		if err := d.insertRefreshToken(token); err != nil {
+			return err
+		}
+	}
+	for _, list := range seed.TodoLists {
+		if err := d.insertTodoList(list); err != nil {
+			return err
+		}
+		for _, userId := range list.MemberIds {
+			if err := d.AddTodoListMember(list.Id, userId); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Items keep the seed order, items missing from TodoItemOrder are appended sorted by id
+	var itemIds []string
+	for _, itemId := range seed.TodoItemOrder {
+		if _, exists := seed.TodoItems[itemId]; exists {
+			itemIds = append(itemIds, itemId)
+		}
+	}
+	var unorderedIds []string
+	for itemId := range seed.TodoItems {
+		if !slices.Contains(itemIds, itemId) {
+			unorderedIds = append(unorderedIds, itemId)
+		}
+	}
+	sort.Strings(unorderedIds)
+	for _, itemId := range append(itemIds, unorderedIds...) {
+		if err := d.insertTodo(seed.TodoItems[itemId]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *SqliteDatabase) insertTodo(item TodoItem) error {
+	_, err := d.db.Exec(
+		"INSERT INTO todo_items (id, list_id, user_id, description, status, updated_at) VALUES (?, ?, ?, ?, ?, ?)",
+		item.Id, item.ListId, item.UserId, item.Description, item.Status, toUnixNano(item.UpdatedAt),
+	)
+	return err
+}
+
+func (d *SqliteDatabase) insertTodoList(todoList TodoList) error {
+	workflow, err := encodeWorkflow(todoList.Workflow)
+	if err != nil {
+		return err
+	}
+	_, err = d.db.Exec(
+		"INSERT INTO todo_lists (id, title, description, owner_id, workflow, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		todoList.Id, todoList.Title, todoList.Description, todoList.OwnerId, workflow, toUnixNano(todoList.CreatedAt), toUnixNano(todoList.UpdatedAt),
+	)
+	return err
+}
+
+// initialStatus falls back to the default workflow when the list doesn't exist, like the in memory database.
+func (d *SqliteDatabase) initialStatus(listId string) (string, error) {
+	var encoded string
+	err := d.db.QueryRow("SELECT workflow FROM todo_lists WHERE id = ?", listId).Scan(&encoded)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+
+	workflow, err := decodeWorkflow(encoded)
+	if err != nil {
+		return "", err
+	}
+	if workflow == nil {
+		workflow = DefaultWorkflow()
+	}
+	return workflow.InitialStatus(), nil
+}
+
+func encodeWorkflow(workflow *Workflow) (string, error) {
+	if workflow == nil {
+		return "", nil
+	}
+	encoded, err := json.Marshal(workflow)
+	return string(encoded), err
+}
+
+func decodeWorkflow(encoded string) (*Workflow, error) {
+	if encoded == "" {
+		return nil, nil
+	}
+	var workflow Workflow
+	if err := json.Unmarshal([]byte(encoded), &workflow); err != nil {
+		return nil, err
+	}
+	return &workflow, nil
+}
+
+// toUnixNano stores the zero time as 0, as it's outside the range of UnixNano.
+func toUnixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// fromUnixNano returns times in UTC, the original time zone is not preserved.
+func fromUnixNano(nanoseconds int64) time.Time {
+	if nanoseconds == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanoseconds).UTC()
+}
+
+// now returns the current time in UTC, like the timestamps read by fromUnixNano.
+func (d *SqliteDatabase) now() time.Time {
+	return d.currentTime().UTC()
+}
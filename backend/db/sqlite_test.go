@@ -0,0 +1,141 @@
+package db
+
+import (
+	"backend/util"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSqliteDatabase_GetAccessToken(t *testing.T) {
+	seed := TestDatabase(func() time.Time { return util.FakeTime(2024, 6, 30) }, nil)
+
+	const validAccessToken = "tkn_aaaaaaaaaaaaaaaaaaaaaa"
+	const nonExistingAccessToken = "tkn_bbbbbbbbbbbbbbbbbbbbbb"
+
+	const expiredAccessToken = "tkn_cccccccccccccccccccccc"
+
+	fakeToken := AccessToken{UserId: "valid_account", Token: validAccessToken, ExpiresAt: util.FakeTime(2024, 7, 1).UTC()}
+	seed.AccessTokens[validAccessToken] = fakeToken
+	seed.AccessTokens[expiredAccessToken] = AccessToken{UserId: "valid_account", Token: expiredAccessToken, ExpiresAt: util.FakeTime(2024, 6, 30).UTC()}
+
+	database, err := TestSqliteDatabase(seed)
+	assert.Nil(t, err)
+	defer database.Close()
+
+	t.Run("valid token", func(t *testing.T) {
+		accessToken, err := database.GetAccessToken(validAccessToken)
+		assert.Nil(t, err)
+		assert.Equal(t, &fakeToken, accessToken)
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		accessToken, err := database.GetAccessToken("not-a-uuid")
+		assert.NotNil(t, err)
+		assert.Nil(t, accessToken)
+	})
+
+	t.Run("expired token", func(t *testing.T) {
+		accessToken, err := database.GetAccessToken(expiredAccessToken)
+		assert.ErrorIs(t, err, ErrAccessTokenExpired)
+		assert.Nil(t, accessToken)
+	})
+
+	t.Run("account doesnt exist", func(t *testing.T) {
+		accessToken, err := database.GetAccessToken(nonExistingAccessToken)
+		assert.ErrorIs(t, err, ErrInvalidAccessToken)
+		assert.Nil(t, accessToken)
+	})
+}
+
+func TestSqliteDatabase_Reopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tasks.db")
+
+	database, err := CreateSqliteDatabase(path)
+	assert.Nil(t, err)
+	user, err := database.CreateUser("test user", "$2a$10$hash")
+	assert.Nil(t, err)
+	assert.Nil(t, database.Close())
+
+	// Migrations must not run twice, and the data must survive a restart
+	database, err = CreateSqliteDatabase(path)
+	assert.Nil(t, err)
+	defer database.Close()
+
+	stored, err := database.GetUser(user.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, user, stored)
+}
+
+func TestSqliteDatabase_Stats(t *testing.T) {
+	database, err := TestSqliteDatabase(statsSeed())
+	assert.NoError(t, err)
+	defer database.Close()
+
+	stats, err := database.Stats()
+
+	assert.NoError(t, err)
+	assert.Equal(t, expectedStats, stats)
+}
+
+func TestSqliteDatabase_Ping(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tasks.db")
+	database, err := CreateSqliteDatabase(path)
+	assert.NoError(t, err)
+	assert.NoError(t, database.Ping())
+
+	// Another process holding the write lock makes the database unavailable
+	other, err := CreateSqliteDatabase(path)
+	assert.NoError(t, err)
+	_, err = other.db.Exec("BEGIN IMMEDIATE")
+	assert.NoError(t, err)
+	assert.ErrorContains(t, database.Ping(), "database is locked")
+	assert.NoError(t, other.Close())
+	assert.NoError(t, database.Ping())
+
+	assert.NoError(t, database.Close())
+	assert.EqualError(t, database.Ping(), "sql: database is closed")
+}
+
+func TestSqliteDatabase_UpdateUser(t *testing.T) {
+	database, err := TestSqliteDatabase(statsSeed())
+	assert.NoError(t, err)
+	defer database.Close()
+
+	testUpdateUser(t, database)
+}
+
+func TestSqliteDatabase_CreateUserConcurrently(t *testing.T) {
+	database, err := TestSqliteDatabase(TestDatabase(util.GetCurrentTime, util.GenerateRandomUuid))
+	assert.NoError(t, err)
+	defer database.Close()
+
+	testCreateUserConcurrently(t, database)
+}
+
+func TestSqliteDatabase_Users(t *testing.T) {
+	database, err := TestSqliteDatabase(usersSeed())
+	assert.NoError(t, err)
+	defer database.Close()
+
+	testUsers(t, database)
+}
+
+func TestSqliteDatabase_DeleteExpiredTokens(t *testing.T) {
+	seed := statsSeed()
+	seed.generateUuid = func(prefix string) string { return prefix + "_new" }
+	database, err := TestSqliteDatabase(seed)
+	assert.NoError(t, err)
+	defer database.Close()
+
+	testDeleteExpiredTokens(t, database)
+}
+
+func TestSqliteDatabase_TransferTodoList(t *testing.T) {
+	database, err := TestSqliteDatabase(usersSeed())
+	assert.NoError(t, err)
+	defer database.Close()
+
+	testTransferTodoList(t, database)
+}
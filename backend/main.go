@@ -1,41 +1,299 @@
 package main
 
 import (
+	"backend/config"
 	"backend/db"
 	"backend/net"
 	"backend/routes"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 )
 
 func main() {
+	cfg, err := config.Load(os.Args[1:], os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	} else if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+
+	logger, err := net.NewLogger(os.Stderr, cfg.LogFormat, cfg.LogLevel)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	slog.SetDefault(logger)
+
+	database, err := createDatabase(cfg.Database.Type, cfg.Database.Path)
+	if err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+
+	var shutdownHooks []net.ShutdownHook
+	if inMemory, ok := database.(*db.InMemoryDatabase); ok {
+		if cfg.Compact {
+			err = compactDatabase(inMemory, cfg.Database.Snapshot, cfg.Database.Journal)
+			if err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+			slog.Info("Compacted journal into snapshot", "journal", cfg.Database.Journal, "snapshot", cfg.Database.Snapshot)
+			return
+		}
+
+		flush, err := persistDatabase(inMemory, cfg.Database.Snapshot, cfg.Database.Journal, cfg.Database.SnapshotInterval)
+		if err != nil {
+			slog.Error(err.Error())
+			os.Exit(1)
+		}
+		shutdownHooks = append(shutdownHooks, flush)
+	}
+	if sqlite, ok := database.(*db.SqliteDatabase); ok {
+		shutdownHooks = append(shutdownHooks, sqlite.Close)
+	}
+
+	if err = promoteAdmins(database, cfg.Admins); err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+
+	tokens, err := createTokens(cfg.Tokens.Type, cfg.Tokens.Keys, database)
+	if err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+
 	mux := http.NewServeMux()
-	database := db.CreateDatabase()
 
-	users := routes.CreateUsers(database)
+	users := routes.CreateUsers(database, tokens, cfg.Tokens.AccessTokenLifetime, cfg.Tokens.RefreshTokenLifetime)
 	todoLists := routes.CreateTodoLists(database)
 	todos := routes.CreateTodos(database)
 
 	mux.HandleFunc("POST /users/register", users.Register)
 	mux.HandleFunc("POST /users/login", users.Login)
+	mux.HandleFunc("POST /users/refresh", users.Refresh)
+	mux.HandleFunc("POST /users/logout", users.Logout)
+	mux.HandleFunc("POST /users/logout/all", users.LogoutAll)
 
 	mux.HandleFunc("POST /todolists", todoLists.Create)
+	mux.HandleFunc("GET /todolists", todoLists.GetAll)
 	mux.HandleFunc("GET /todolists/{list_id}", todoLists.Get)
+	mux.HandleFunc("PATCH /todolists/{list_id}", todoLists.Patch)
+	mux.HandleFunc("DELETE /todolists/{list_id}", todoLists.Delete)
+	mux.HandleFunc("GET /todolists/{list_id}/workflow", todoLists.GetWorkflow)
+	mux.HandleFunc("PUT /todolists/{list_id}/workflow", todoLists.UpdateWorkflow)
+	mux.HandleFunc("GET /todolists/{list_id}/members", todoLists.GetMembers)
+	mux.HandleFunc("POST /todolists/{list_id}/members", todoLists.AddMember)
+	mux.HandleFunc("DELETE /todolists/{list_id}/members/{user_id}", todoLists.RemoveMember)
 
 	mux.HandleFunc("POST /todos", todos.Create)
 	mux.HandleFunc("PUT /todos/{todo_id}", todos.Update)
+	mux.HandleFunc("PATCH /todos/{todo_id}", todos.Patch)
+	mux.HandleFunc("DELETE /todos/{todo_id}", todos.Delete)
 
-	// Debug route
-	debug := routes.CreateDebug(&database)
-	mux.HandleFunc("GET /debug", debug.Debug)
+	// Every admin route checks the role, instead of every handler
+	admin := routes.CreateAdmin(database)
+	for pattern, handler := range map[string]http.HandlerFunc{
+		"GET /admin/users":                     admin.GetUsers,
+		"PATCH /admin/users/{user_id}":         admin.PatchUser,
+		"DELETE /admin/users/{user_id}":        admin.DeleteUser,
+		"DELETE /admin/users/{user_id}/tokens": admin.RevokeTokens,
+		"PUT /admin/todolists/{list_id}/owner": admin.TransferTodoList,
+	} {
+		mux.Handle(pattern, net.AdminMiddleware(handler))
+	}
 
-	authentication := net.AuthenticationMiddleware(mux, database)
-	logging := net.LoggingMiddleware(authentication)
-	handler := net.CorsMiddleware(logging, "*")
+	// Exposes the whole database, so only served in debug mode and only to admins
+	if cfg.Debug {
+		debug := routes.CreateDebug(database, time.Now())
+		mux.Handle("GET /debug", net.AdminMiddleware(http.HandlerFunc(debug.Debug)))
+		slog.Warn("Debug mode enabled, admins can read the whole database at /debug")
+	}
 
-	fmt.Println("Listening on localhost:8080")
-	err := http.ListenAndServe("localhost:8080", handler)
-	if err != nil {
-		fmt.Println(err.Error())
+	// Probes don't have an access token
+	health := net.CreateHealth(database)
+	mux.HandleFunc("GET /healthz", health.Live)
+	mux.HandleFunc("GET /readyz", health.Ready)
+
+	// Prometheus scrapes metrics without credentials
+	metrics := net.CreateMetrics(database)
+	mux.Handle("GET /metrics", metrics)
+
+	rateLimited := net.RateLimitMiddleware(mux, mux, createRateLimiter(cfg.RateLimit))
+	authentication := net.AuthenticationMiddleware(rateLimited, tokens, database, cfg.Tokens.BareTokens)
+	instrumented := net.MetricsMiddleware(authentication, mux, metrics)
+	cors := net.CorsMiddleware(instrumented, mux, cfg.AllowedOrigins, cfg.CorsMaxAge)
+	handler := net.LoggingMiddleware(cors, mux, logger)
+
+	server := &http.Server{
+		Addr:              cfg.Address,
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.Timeouts.Read,
+		ReadTimeout:       cfg.Timeouts.Read,
+		WriteTimeout:      cfg.Timeouts.Write,
+		IdleTimeout:       cfg.Timeouts.Idle,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		slog.Info("Shutting down, press Ctrl+C again to force")
+		// A second Ctrl+C stops the server right away, without waiting for requests to drain
+		stop()
+	}()
+
+	slog.Info("Listening", "address", cfg.Address)
+	if err = net.Serve(ctx, server, health, cfg.Timeouts.DrainDelay, cfg.Timeouts.Shutdown, shutdownHooks...); err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+	slog.Info("Server stopped")
+}
+
+func createDatabase(databaseType string, path string) (db.Database, error) {
+	switch databaseType {
+	case "memory":
+		return db.CreateDatabase(), nil
+	case "sqlite":
+		slog.Info("Using SQLite database", "path", path)
+		return db.CreateSqliteDatabase(path)
+	default:
+		return nil, errors.New("unknown database " + databaseType)
+	}
+}
+
+func createTokens(tokenType string, keys string, database db.Database) (net.Tokens, error) {
+	switch tokenType {
+	case "database":
+		return net.CreateDatabaseTokens(database), nil
+	case "signed":
+		signingKeys, err := net.ParseSigningKeys(keys)
+		if err != nil {
+			return nil, err
+		}
+		slog.Info("Using signed tokens", "key_id", signingKeys[0].Id)
+		return net.CreateSignedTokens(signingKeys)
+	default:
+		return nil, errors.New("unknown tokens " + tokenType)
+	}
+}
+
+// promoteAdmins makes the users with these names admin. Users that don't exist are skipped, they can be promoted on a
+// later start once they registered.
+func promoteAdmins(database db.Database, names []string) error {
+	for _, name := range names {
+		user, err := database.GetUserByName(name)
+		if err != nil {
+			slog.Warn("Admin not registered yet", "name", name)
+			continue
+		}
+		if user.Admin {
+			continue
+		}
+		user.Admin = true
+		if _, err = database.UpdateUser(user); err != nil {
+			return fmt.Errorf("failed to make %s admin: %w", name, err)
+		}
+		slog.Info("Made user admin", "user_id", user.Id)
+	}
+	return nil
+}
+
+func createRateLimiter(rateLimit config.RateLimit) *net.RateLimiter {
+	routeLimits := make(map[string]net.RateLimit)
+	for pattern, limit := range rateLimit.Routes {
+		routeLimits[pattern] = net.RateLimit{RequestsPerSecond: limit.RequestsPerSecond, Burst: limit.Burst}
+	}
+	return net.CreateRateLimiter(net.RateLimit{RequestsPerSecond: rateLimit.RequestsPerSecond, Burst: rateLimit.Burst},
+		net.RateLimit{RequestsPerSecond: rateLimit.Writes.RequestsPerSecond, Burst: rateLimit.Writes.Burst}, routeLimits)
+}
+
+// persistDatabase restores the database from the snapshot and journal, records every change in the journal,
+// and saves the snapshot every interval. Both paths are optional. The returned hook saves the snapshot a last time
+// and closes the journal, run it once the server stopped handling requests.
+func persistDatabase(database *db.InMemoryDatabase, snapshotPath string, journalPath string, interval time.Duration) (net.ShutdownHook, error) {
+	if snapshotPath == "" && journalPath == "" {
+		return func() error { return nil }, nil
+	}
+	if err := openPersistence(database, snapshotPath, journalPath); err != nil {
+		return nil, err
+	}
+
+	// Saving a snapshot includes all changes in the journal, so compacting also empties it
+	save := func() error {
+		if snapshotPath == "" {
+			return nil
+		}
+		return database.Compact(snapshotPath)
+	}
+
+	// The interval is only validated together with the snapshot path, so there's no ticker without a snapshot
+	done := make(chan struct{})
+	var saving sync.WaitGroup
+	if snapshotPath != "" {
+		ticker := time.NewTicker(interval)
+		saving.Add(1)
+		go func() {
+			defer saving.Done()
+			defer ticker.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+					if err := save(); err != nil {
+						slog.Error("Failed to save snapshot", "error", err)
+					}
+				}
+			}
+		}()
+	}
+
+	return func() error {
+		// Wait for a periodic save in progress, so nothing is saved after the last snapshot
+		close(done)
+		saving.Wait()
+		if err := save(); err != nil {
+			return fmt.Errorf("failed to save snapshot: %w", err)
+		}
+		return database.CloseJournal()
+	}, nil
+}
+
+// compactDatabase collapses the journal into the snapshot, so it doesn't have to be replayed on the next start.
+func compactDatabase(database *db.InMemoryDatabase, snapshotPath string, journalPath string) error {
+	if err := openPersistence(database, snapshotPath, journalPath); err != nil {
+		return err
+	}
+	if err := database.Compact(snapshotPath); err != nil {
+		return err
+	}
+	return database.CloseJournal()
+}
+
+func openPersistence(database *db.InMemoryDatabase, snapshotPath string, journalPath string) error {
+	if snapshotPath != "" {
+		if err := database.LoadSnapshot(snapshotPath); err != nil {
+			return err
+		}
+		slog.Info("Using snapshot", "path", snapshotPath)
+	}
+	if journalPath != "" {
+		if err := database.OpenJournal(journalPath); err != nil {
+			return err
+		}
+		slog.Info("Using journal", "path", journalPath)
 	}
+	return nil
 }
@@ -2,23 +2,127 @@ package net
 
 import (
 	"backend/db"
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"slices"
+	"strings"
 )
 
-var nonAuthenticatedEndpoints = []string{"/users/register", "/users/login", "/debug"}
+// Refreshing works without a valid access token, as it's used once the access token expired
+var nonAuthenticatedEndpoints = []string{"/users/register", "/users/login", "/users/refresh", "/metrics", "/healthz", "/readyz"}
 
-func AuthenticationMiddleware(next http.Handler, database db.Database) http.Handler {
+const authenticationRealm = "tasks"
+
+// Unexported, so only ContextWithUser and ContextWithAccessToken can store values under them
+type userContextKey struct{}
+type accessTokenContextKey struct{}
+
+// AuthenticationMiddleware halts requests without a valid "Authorization: Bearer <token>" header, and stores the user
+// that sent it and its access token in the request context. Clients from before the Bearer scheme send the token as
+// the whole header, which is only accepted when allowBareTokens is set.
+func AuthenticationMiddleware(next http.Handler, tokens Tokens, database db.Database, allowBareTokens bool) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if slices.Contains(nonAuthenticatedEndpoints, r.URL.Path) {
 			next.ServeHTTP(w, r)
 			return
 		}
 
-		if _, err := database.GetAccessToken(r.Header.Get("Authorization")); err != nil {
-			HaltUnauthorized(w, err.Error())
+		header := r.Header.Get("Authorization")
+		if header == "" {
+			// Without credentials the challenge has no error code, RFC 6750 section 3.1
+			HaltUnauthorized(w, "missing_token", "missing access token")
+			return
+		}
+		token, err := bearerToken(header, allowBareTokens)
+		if err != nil {
+			haltChallenge(w, "invalid_request", err.Error())
+			return
+		}
+
+		accessToken, err := tokens.Verify(token)
+		if err != nil {
+			haltChallenge(w, "invalid_token", err.Error())
+			return
+		}
+		// Signed tokens remain valid after their user is deleted
+		user, err := database.GetUser(accessToken.UserId)
+		if err != nil {
+			haltChallenge(w, "invalid_token", err.Error())
+			return
+		}
+		// Disabling revokes the stored tokens, but signed tokens can't be revoked
+		if user.Disabled {
+			haltChallenge(w, "invalid_token", "user disabled")
+			return
+		}
+
+		setRequestUser(r.Context(), user.Id)
+		ctx := ContextWithAccessToken(ContextWithUser(r.Context(), user), accessToken)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// AdminMiddleware halts requests of users that aren't admin, wrap it around the handlers of admin routes. The user must
+// already be authenticated by AuthenticationMiddleware.
+func AdminMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			HaltUnauthorized(w, "not_authenticated", "not authenticated")
+			return
+		}
+		if !user.Admin {
+			HaltForbidden(w, "admin_required", "admin role required")
 			return
 		}
 		next.ServeHTTP(w, r)
 	})
 }
+
+// bearerToken returns the token of an Authorization header, the scheme is case-insensitive.
+func bearerToken(header string, allowBareTokens bool) (string, error) {
+	scheme, token, found := strings.Cut(header, " ")
+	if found && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token), nil
+	}
+	if !found && allowBareTokens {
+		return header, nil
+	}
+	return "", errors.New("authorization header must use the Bearer scheme")
+}
+
+// haltChallenge halts the request with an RFC 6750 error code, which is also the code of the problem.
+func haltChallenge(w http.ResponseWriter, code string, detail string) {
+	w.Header().Set("WWW-Authenticate", bearerChallenge(code, detail))
+	haltProblem(w, http.StatusUnauthorized, code, detail)
+}
+
+func bearerChallenge(code string, description string) string {
+	challenge := fmt.Sprintf(`Bearer realm="%s"`, authenticationRealm)
+	if code != "" {
+		challenge += fmt.Sprintf(`, error="%s", error_description="%s"`, code, description)
+	}
+	return challenge
+}
+
+func ContextWithUser(ctx context.Context, user *db.User) context.Context {
+	return context.WithValue(ctx, userContextKey{}, user)
+}
+
+// UserFromContext returns the user stored by AuthenticationMiddleware, which is missing on non authenticated endpoints.
+func UserFromContext(ctx context.Context) (*db.User, bool) {
+	user, ok := ctx.Value(userContextKey{}).(*db.User)
+	return user, ok && user != nil
+}
+
+func ContextWithAccessToken(ctx context.Context, accessToken *db.AccessToken) context.Context {
+	return context.WithValue(ctx, accessTokenContextKey{}, accessToken)
+}
+
+// AccessTokenFromContext returns the access token the request was authenticated with.
+func AccessTokenFromContext(ctx context.Context) (*db.AccessToken, bool) {
+	accessToken, ok := ctx.Value(accessTokenContextKey{}).(*db.AccessToken)
+	return accessToken, ok && accessToken != nil
+}
@@ -1,21 +1,88 @@
 package net
 
-import "net/http"
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
 
-func CorsMiddleware(next http.Handler, origin string) http.Handler {
+// Preflight requests ask for these methods, the ones the path has a route for are allowed
+var corsMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// Headers that scripts on allowed origins can read from responses
+var corsExposedHeaders = []string{"WWW-Authenticate", requestIdHeader, "Retry-After", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset"}
+
+// CorsMiddleware lets browsers call the API from the given origins, which are either exact origins like
+// "https://tasks.example.com", patterns like "https://*.example.com" that match every subdomain, or "*" for all origins.
+// Requests from other origins are rejected. Preflight requests are answered here, with the methods mux has a route for
+// on the path, and browsers cache the answer for maxAge.
+//
+// Access tokens are sent in the Authorization header rather than in cookies, so credentials are never allowed.
+func CorsMiddleware(next http.Handler, mux *http.ServeMux, origins []string, maxAge time.Duration) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The response depends on the origin, so caches must not share it between origins
+		w.Header().Add("Vary", "Origin")
+
+		// Browsers send the origin on every cross-origin request, requests without one aren't affected by CORS
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !originAllowed(origins, origin) {
+			Logger(r.Context()).Warn("Origin not allowed", "origin", origin)
+			HaltForbidden(w, "origin_not_allowed", "origin not allowed")
+			return
+		}
 		w.Header().Set("Access-Control-Allow-Origin", origin)
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT")
-		w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
-		w.Header().Set("Access-Control-Allow-Credentials", "true")
-		w.Header().Set("Content-Type", "application/json")
 
-		// Handle preflight request
-		if r.Method == http.MethodOptions {
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+			if methods := routeMethods(mux, r); len(methods) > 0 {
+				w.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+			}
+			w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, "+requestIdHeader)
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(maxAge.Seconds())))
 			w.WriteHeader(http.StatusNoContent)
 			return
 		}
 
+		w.Header().Set("Access-Control-Expose-Headers", strings.Join(corsExposedHeaders, ", "))
 		next.ServeHTTP(w, r)
 	})
 }
+
+// originAllowed reports whether origin is on the list, or is a subdomain of a pattern on it.
+func originAllowed(origins []string, origin string) bool {
+	for _, allowed := range origins {
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+		scheme, domain, isPattern := strings.Cut(allowed, "://*.")
+		if !isPattern {
+			continue
+		}
+		host, sameScheme := strings.CutPrefix(origin, scheme+"://")
+		subdomain, isSubdomain := strings.CutSuffix(host, "."+domain)
+		// The subdomain is a hostname, so it can't smuggle in a path or credentials
+		if sameScheme && isSubdomain && subdomain != "" && !strings.ContainsAny(subdomain, "/@:") {
+			return true
+		}
+	}
+	return false
+}
+
+// routeMethods returns the methods mux has a route for on the path of the request.
+func routeMethods(mux *http.ServeMux, r *http.Request) []string {
+	var methods []string
+	for _, method := range corsMethods {
+		probe := r.Clone(r.Context())
+		probe.Method = method
+		if _, pattern := mux.Handler(probe); pattern != "" {
+			methods = append(methods, method)
+		}
+	}
+	return methods
+}
@@ -5,41 +5,205 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
+func fakeCorsMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	for _, pattern := range []string{"GET /todolists/{list_id}", "PATCH /todolists/{list_id}", "DELETE /todolists/{list_id}", "POST /todos"} {
+		mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) { Success(w, "ok") })
+	}
+	return mux
+}
+
 func TestCorsMiddleware(t *testing.T) {
+	exposedHeaders := "WWW-Authenticate, X-Request-ID, Retry-After, RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset"
 	tests := []struct {
-		origin string
+		name           string
+		allowedOrigins []string
+		origin         string
+		expectedStatus int
+		expectedHeader http.Header
 	}{
-		{"*"},
-		{"http://localhost:3000"},
+		{
+			name:           "All origins allowed",
+			allowedOrigins: []string{"*"},
+			origin:         "http://localhost:3000",
+			expectedStatus: http.StatusOK,
+			expectedHeader: http.Header{
+				"Access-Control-Allow-Origin":   {"http://localhost:3000"},
+				"Access-Control-Expose-Headers": {exposedHeaders},
+			},
+		},
+		{
+			name:           "Allowed origin",
+			allowedOrigins: []string{"http://localhost:5173", "http://localhost:3000"},
+			origin:         "http://localhost:3000",
+			expectedStatus: http.StatusOK,
+			expectedHeader: http.Header{
+				"Access-Control-Allow-Origin":   {"http://localhost:3000"},
+				"Access-Control-Expose-Headers": {exposedHeaders},
+			},
+		},
+		{
+			name:           "Subdomain of allowed pattern",
+			allowedOrigins: []string{"https://*.example.com"},
+			origin:         "https://tasks.eu.example.com",
+			expectedStatus: http.StatusOK,
+			expectedHeader: http.Header{
+				"Access-Control-Allow-Origin":   {"https://tasks.eu.example.com"},
+				"Access-Control-Expose-Headers": {exposedHeaders},
+			},
+		},
+		{
+			name:           "Other origin",
+			allowedOrigins: []string{"http://localhost:5173"},
+			origin:         "http://localhost:3000",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "Domain of allowed pattern",
+			allowedOrigins: []string{"https://*.example.com"},
+			origin:         "https://example.com",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "Other scheme than allowed pattern",
+			allowedOrigins: []string{"https://*.example.com"},
+			origin:         "http://tasks.example.com",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "Other port than allowed pattern",
+			allowedOrigins: []string{"https://*.example.com"},
+			origin:         "https://tasks.example.com:8443",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "Other domain ending like allowed pattern",
+			allowedOrigins: []string{"https://*.example.com"},
+			origin:         "https://evil.com/.example.com",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "Without origin",
+			allowedOrigins: []string{"http://localhost:5173"},
+			expectedStatus: http.StatusOK,
+			expectedHeader: http.Header{},
+		},
 	}
 
 	for _, tt := range tests {
-		t.Run("Origin "+tt.origin, func(t *testing.T) {
+		t.Run(tt.name, func(t *testing.T) {
 			w := httptest.NewRecorder()
-			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r := httptest.NewRequest(http.MethodGet, "/todolists/lst_1", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
 
-			CorsMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), tt.origin).ServeHTTP(w, r)
+			mux := fakeCorsMux()
+			CorsMiddleware(mux, mux, tt.allowedOrigins, time.Minute).ServeHTTP(w, r)
 
-			assert.Equal(t, http.Header{
-				"Access-Control-Allow-Credentials": []string{"true"},
-				"Access-Control-Allow-Headers":     []string{"Authorization, Content-Type"},
-				"Access-Control-Allow-Methods":     []string{"GET, POST, PUT"},
-				"Access-Control-Allow-Origin":      []string{tt.origin},
-				"Content-Type":                     []string{"application/json"},
-			}, w.Result().Header)
+			assert.Equal(t, tt.expectedStatus, w.Result().StatusCode)
+			if tt.expectedStatus == http.StatusForbidden {
+				assert.JSONEq(t, `{"type":"about:blank","title":"Forbidden","status":403,"detail":"origin not allowed","code":"origin_not_allowed"}`, w.Body.String())
+				assert.Empty(t, w.Result().Header.Get("Access-Control-Allow-Origin"))
+				return
+			}
+			expected := tt.expectedHeader
+			expected["Vary"] = []string{"Origin"}
+			expected["Content-Type"] = []string{"application/json"}
+			assert.Equal(t, expected, w.Result().Header)
+			// Access tokens aren't cookies, and browsers reject credentials together with "*"
+			assert.Empty(t, w.Result().Header.Get("Access-Control-Allow-Credentials"))
 		})
 	}
 }
 
 func TestCorsMiddleware_Preflight(t *testing.T) {
+	tests := []struct {
+		name           string
+		url            string
+		origin         string
+		expectedStatus int
+		expectedHeader http.Header
+	}{
+		{
+			name:           "Methods of the route",
+			url:            "/todolists/lst_1",
+			origin:         "http://localhost:5173",
+			expectedStatus: http.StatusNoContent,
+			expectedHeader: http.Header{
+				"Access-Control-Allow-Origin":  {"http://localhost:5173"},
+				"Access-Control-Allow-Methods": {"GET, PATCH, DELETE"},
+				"Access-Control-Allow-Headers": {"Authorization, Content-Type, X-Request-ID"},
+				"Access-Control-Max-Age":       {"600"},
+				"Vary":                         {"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"},
+			},
+		},
+		{
+			name:           "Other route",
+			url:            "/todos",
+			origin:         "http://localhost:5173",
+			expectedStatus: http.StatusNoContent,
+			expectedHeader: http.Header{
+				"Access-Control-Allow-Origin":  {"http://localhost:5173"},
+				"Access-Control-Allow-Methods": {"POST"},
+				"Access-Control-Allow-Headers": {"Authorization, Content-Type, X-Request-ID"},
+				"Access-Control-Max-Age":       {"600"},
+				"Vary":                         {"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"},
+			},
+		},
+		{
+			name:           "Unknown route",
+			url:            "/unknown",
+			origin:         "http://localhost:5173",
+			expectedStatus: http.StatusNoContent,
+			expectedHeader: http.Header{
+				"Access-Control-Allow-Origin":  {"http://localhost:5173"},
+				"Access-Control-Allow-Headers": {"Authorization, Content-Type, X-Request-ID"},
+				"Access-Control-Max-Age":       {"600"},
+				"Vary":                         {"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"},
+			},
+		},
+		{
+			name:           "Other origin",
+			url:            "/todolists/lst_1",
+			origin:         "http://localhost:3000",
+			expectedStatus: http.StatusForbidden,
+			expectedHeader: http.Header{
+				"Content-Type": {"application/problem+json"},
+				"Vary":         {"Origin"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodOptions, tt.url, nil)
+			r.Header.Set("Origin", tt.origin)
+			r.Header.Set("Access-Control-Request-Method", http.MethodPatch)
+
+			mux := fakeCorsMux()
+			handlerCalled := false
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { handlerCalled = true })
+			CorsMiddleware(next, mux, []string{"http://localhost:5173"}, 10*time.Minute).ServeHTTP(w, r)
+
+			assert.Equal(t, tt.expectedStatus, w.Result().StatusCode)
+			assert.Equal(t, tt.expectedHeader, w.Result().Header)
+			assert.False(t, handlerCalled)
+		})
+	}
+}
+
+func TestCorsMiddleware_OptionsWithoutPreflight(t *testing.T) {
 	w := httptest.NewRecorder()
-	r := httptest.NewRequest(http.MethodOptions, "/", nil)
-	r.Method = http.MethodOptions
+	r := httptest.NewRequest(http.MethodOptions, "/todos", nil)
+	r.Header.Set("Origin", "http://localhost:5173")
 
-	fakeHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
-	CorsMiddleware(fakeHandler, "*").ServeHTTP(w, r)
+	mux := fakeCorsMux()
+	CorsMiddleware(mux, mux, []string{"*"}, time.Minute).ServeHTTP(w, r)
 
-	assert.Equal(t, http.StatusNoContent, w.Result().StatusCode)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Result().StatusCode)
 }
@@ -0,0 +1,45 @@
+package net
+
+import (
+	"backend/db"
+	"net/http"
+	"sync/atomic"
+)
+
+type healthResponse struct {
+	Status string `json:"status"`
+}
+
+// Health answers the probes of supervisors and load balancers. Liveness only checks the server handles requests,
+// readiness also checks the database and fails once the server is shutting down, so no new traffic is sent its way.
+type Health struct {
+	database     db.Database
+	shuttingDown atomic.Bool
+}
+
+func CreateHealth(database db.Database) *Health {
+	return &Health{database: database}
+}
+
+func (h *Health) Live(w http.ResponseWriter, _ *http.Request) {
+	Success(w, healthResponse{Status: "ok"})
+}
+
+func (h *Health) Ready(w http.ResponseWriter, r *http.Request) {
+	if h.shuttingDown.Load() {
+		haltProblem(w, http.StatusServiceUnavailable, "shutting_down", "shutting down")
+		return
+	}
+	if err := h.database.Ping(); err != nil {
+		// The probe doesn't need an access token, so don't tell anyone that can reach it what went wrong
+		Logger(r.Context()).Error("Database unavailable", "error", err)
+		haltProblem(w, http.StatusServiceUnavailable, "database_unavailable", "database unavailable")
+		return
+	}
+	Success(w, healthResponse{Status: "ok"})
+}
+
+// ShutDown makes readiness fail from now on, Serve calls it as soon as the server starts stopping.
+func (h *Health) ShutDown() {
+	h.shuttingDown.Store(true)
+}
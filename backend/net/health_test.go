@@ -0,0 +1,126 @@
+package net
+
+import (
+	"backend/db"
+	"backend/util"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHealth(t *testing.T) {
+	closedDatabase, err := db.TestSqliteDatabase(db.TestDatabase(util.GetCurrentTime, util.GenerateRandomUuid))
+	assert.NoError(t, err)
+	assert.NoError(t, closedDatabase.Close())
+
+	tests := []struct {
+		name           string
+		database       db.Database
+		shuttingDown   bool
+		probe          func(h *Health) http.HandlerFunc
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Live",
+			database:       db.CreateDatabase(),
+			probe:          func(h *Health) http.HandlerFunc { return h.Live },
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"status":"ok"}`,
+		},
+		{
+			name:           "Live when database is unavailable",
+			database:       closedDatabase,
+			probe:          func(h *Health) http.HandlerFunc { return h.Live },
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"status":"ok"}`,
+		},
+		{
+			name:           "Live when shutting down",
+			database:       db.CreateDatabase(),
+			shuttingDown:   true,
+			probe:          func(h *Health) http.HandlerFunc { return h.Live },
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"status":"ok"}`,
+		},
+		{
+			name:           "Ready",
+			database:       db.CreateDatabase(),
+			probe:          func(h *Health) http.HandlerFunc { return h.Ready },
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"status":"ok"}`,
+		},
+		{
+			name:           "Not ready when database is unavailable",
+			database:       closedDatabase,
+			probe:          func(h *Health) http.HandlerFunc { return h.Ready },
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody:   `{"type":"about:blank","title":"Service Unavailable","status":503,"detail":"database unavailable","code":"database_unavailable"}`,
+		},
+		{
+			name:           "Not ready when shutting down",
+			database:       db.CreateDatabase(),
+			shuttingDown:   true,
+			probe:          func(h *Health) http.HandlerFunc { return h.Ready },
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody:   `{"type":"about:blank","title":"Service Unavailable","status":503,"detail":"shutting down","code":"shutting_down"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			health := CreateHealth(tt.database)
+			if tt.shuttingDown {
+				health.ShutDown()
+			}
+
+			w := httptest.NewRecorder()
+			tt.probe(health)(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			assert.Equal(t, tt.expectedStatus, w.Result().StatusCode)
+			assert.JSONEq(t, tt.expectedBody, w.Body.String())
+		})
+	}
+}
+
+func TestHealth_NotReadyWhileDraining(t *testing.T) {
+	address := freeAddress(t)
+	health := CreateHealth(db.CreateDatabase())
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /readyz", health.Ready)
+	server := &http.Server{Addr: address, Handler: mux}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- Serve(ctx, server, health, 500*time.Millisecond, time.Second) }()
+	waitUntilListening(t, address)
+
+	probe := func() (int, string) {
+		resp, err := http.Get("http://" + address + "/readyz")
+		if err != nil {
+			return 0, err.Error()
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+	status, _ := probe()
+	assert.Equal(t, http.StatusOK, status)
+
+	// Supervisors probe while the server still accepts connections, so they stop sending traffic before it's gone
+	cancel()
+	assert.Eventually(t, func() bool {
+		status, _ := probe()
+		return status == http.StatusServiceUnavailable
+	}, 400*time.Millisecond, 10*time.Millisecond)
+	_, body := probe()
+	assert.Equal(t, `{"type":"about:blank","title":"Service Unavailable","status":503,"detail":"shutting down","code":"shutting_down"}`, body)
+
+	assert.NoError(t, <-done)
+	status, _ = probe()
+	assert.Equal(t, 0, status)
+}
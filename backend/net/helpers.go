@@ -5,22 +5,49 @@ import (
 	"errors"
 	"github.com/go-playground/validator/v10"
 	"net/http"
+	"reflect"
+	"strings"
 )
 
-type Error struct {
-	Error string `json:"error,omitempty"`
-}
-
 func Success[K any](w http.ResponseWriter, result K) {
 	writeResponse(w, http.StatusOK, result)
 }
 
-func HaltBadRequest(w http.ResponseWriter, error string) {
-	writeResponse(w, http.StatusBadRequest, Error{Error: error})
+func NoContent(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func HaltBadRequest(w http.ResponseWriter, code string, detail string) {
+	haltProblem(w, http.StatusBadRequest, code, detail)
+}
+
+func HaltUnauthorized(w http.ResponseWriter, code string, detail string) {
+	// Every 401 must tell the client how to authenticate
+	w.Header().Set("WWW-Authenticate", bearerChallenge("", ""))
+	haltProblem(w, http.StatusUnauthorized, code, detail)
+}
+
+func HaltForbidden(w http.ResponseWriter, code string, detail string) {
+	haltProblem(w, http.StatusForbidden, code, detail)
+}
+
+func HaltNotFound(w http.ResponseWriter, code string, detail string) {
+	haltProblem(w, http.StatusNotFound, code, detail)
+}
+
+func HaltConflict(w http.ResponseWriter, code string, detail string) {
+	haltProblem(w, http.StatusConflict, code, detail)
+}
+
+// HaltInvalidField halts a request with a body that is well-formed, but has a field that isn't valid.
+func HaltInvalidField(w http.ResponseWriter, field string, detail string) {
+	haltProblem(w, http.StatusUnprocessableEntity, "validation_failed", detail, InvalidParam{Name: field, Reason: detail})
 }
 
-func HaltUnauthorized(w http.ResponseWriter, error string) {
-	writeResponse(w, http.StatusUnauthorized, Error{Error: error})
+// HaltInternalServerError logs err, but doesn't send it to the client as it can reveal internals like SQL queries.
+func HaltInternalServerError(w http.ResponseWriter, r *http.Request, err error) {
+	Logger(r.Context()).Error("Internal server error", "error", err)
+	haltProblem(w, http.StatusInternalServerError, "internal_error", "internal error")
 }
 
 func ParseBody[K any](r *http.Request) (*K, error) {
@@ -29,23 +56,36 @@ func ParseBody[K any](r *http.Request) (*K, error) {
 	decoder.DisallowUnknownFields()
 	err := decoder.Decode(&result)
 	if err != nil {
-		if err.Error() == "unexpected EOF" {
-			return nil, errors.New("validation error")
-		} else {
-			return nil, errors.New("body not valid")
-		}
+		// Also truncated JSON, which is malformed rather than missing fields
+		return nil, ErrInvalidBody
 	}
 
 	validate := validator.New(validator.WithRequiredStructEnabled())
+	// Report fields by the name clients send them as
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		return name
+	})
 	err = validate.Struct(result)
-	if err != nil {
-		return nil, errors.New("validation error")
+	var fieldErrors validator.ValidationErrors
+	if errors.As(err, &fieldErrors) {
+		validationError := &ValidationError{}
+		for _, fieldError := range fieldErrors {
+			validationError.InvalidParams = append(validationError.InvalidParams, InvalidParam{Name: fieldError.Field(), Reason: fieldError.Tag()})
+		}
+		return nil, validationError
+	} else if err != nil {
+		return nil, err
 	}
 
 	return &result, nil
 }
 
 func writeResponse[K any](w http.ResponseWriter, status int, result K) {
+	// Problems have their own content type
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json")
+	}
 	w.WriteHeader(status)
 	response, _ := json.Marshal(result)
 	_, _ = w.Write(response)
@@ -1,6 +1,8 @@
 package net
 
 import (
+	"backend/db"
+	"errors"
 	"fmt"
 	"github.com/stretchr/testify/assert"
 	"net/http"
@@ -34,49 +36,71 @@ func TestSuccess(t *testing.T) {
 	}
 }
 
-func TestHaltBadRequest(t *testing.T) {
-	tests := []struct {
-		input  string
-		output string
-	}{
-		{"body validation error", "{\"error\":\"body validation error\"}"},
-		{"", "{}"},
-	}
+func TestNoContent(t *testing.T) {
+	w := httptest.NewRecorder()
+	NoContent(w)
+	assert.Equal(t, 204, w.Result().StatusCode)
+	assert.Equal(t, "", w.Body.String())
+}
 
-	for i, tt := range tests {
-		t.Run(fmt.Sprintf("Scenario %d", i), func(t *testing.T) {
-			w := httptest.NewRecorder()
-			HaltBadRequest(w, tt.input)
-			assert.Equal(t, 400, w.Result().StatusCode)
-			assert.Equal(t, tt.output, w.Body.String())
-		})
-	}
+func TestHaltBadRequest(t *testing.T) {
+	w := httptest.NewRecorder()
+	HaltBadRequest(w, "invalid_body", "body not valid")
+	assert.Equal(t, 400, w.Result().StatusCode)
+	assert.Equal(t, problemContentType, w.Result().Header.Get("Content-Type"))
+	assert.Equal(t, `{"type":"about:blank","title":"Bad Request","status":400,"detail":"body not valid","code":"invalid_body"}`, w.Body.String())
 }
 
 func TestHaltUnauthorized(t *testing.T) {
-	tests := []struct {
-		input  string
-		output string
-	}{
-		{"body validation error", "{\"error\":\"body validation error\"}"},
-		{"", "{}"},
-	}
+	w := httptest.NewRecorder()
+	HaltUnauthorized(w, "not_authenticated", "not authenticated")
+	assert.Equal(t, 401, w.Result().StatusCode)
+	assert.Equal(t, `Bearer realm="tasks"`, w.Result().Header.Get("WWW-Authenticate"))
+	assert.Equal(t, `{"type":"about:blank","title":"Unauthorized","status":401,"detail":"not authenticated","code":"not_authenticated"}`, w.Body.String())
+}
 
-	for i, tt := range tests {
-		t.Run(fmt.Sprintf("Scenario %d", i), func(t *testing.T) {
-			w := httptest.NewRecorder()
-			HaltUnauthorized(w, tt.input)
-			assert.Equal(t, 401, w.Result().StatusCode)
-			assert.Equal(t, tt.output, w.Body.String())
-		})
-	}
+func TestHaltForbidden(t *testing.T) {
+	w := httptest.NewRecorder()
+	HaltForbidden(w, "owner_only", "only the owner can delete a todo list")
+	assert.Equal(t, 403, w.Result().StatusCode)
+	assert.Equal(t, `{"type":"about:blank","title":"Forbidden","status":403,"detail":"only the owner can delete a todo list","code":"owner_only"}`, w.Body.String())
+}
+
+func TestHaltNotFound(t *testing.T) {
+	w := httptest.NewRecorder()
+	HaltNotFound(w, "user_not_found", "user not found")
+	assert.Equal(t, 404, w.Result().StatusCode)
+	assert.Equal(t, `{"type":"about:blank","title":"Not Found","status":404,"detail":"user not found","code":"user_not_found"}`, w.Body.String())
+}
+
+func TestHaltConflict(t *testing.T) {
+	w := httptest.NewRecorder()
+	HaltConflict(w, "status_in_use", "status todo is still used by todo tdo_1")
+	assert.Equal(t, 409, w.Result().StatusCode)
+	assert.Equal(t, `{"type":"about:blank","title":"Conflict","status":409,"detail":"status todo is still used by todo tdo_1","code":"status_in_use"}`, w.Body.String())
+}
+
+func TestHaltInvalidField(t *testing.T) {
+	w := httptest.NewRecorder()
+	HaltInvalidField(w, "title", "title not valid")
+	assert.Equal(t, 422, w.Result().StatusCode)
+	assert.Equal(t, `{"type":"about:blank","title":"Unprocessable Entity","status":422,"detail":"title not valid","code":"validation_failed","invalid_params":[{"name":"title","reason":"title not valid"}]}`, w.Body.String())
+}
+
+func TestHaltInternalServerError(t *testing.T) {
+	w := httptest.NewRecorder()
+	HaltInternalServerError(w, httptest.NewRequest(http.MethodGet, "/", nil), errors.New("database is locked"))
+	assert.Equal(t, 500, w.Result().StatusCode)
+	assert.Equal(t, `{"type":"about:blank","title":"Internal Server Error","status":500,"detail":"internal error","code":"internal_error"}`, w.Body.String())
 }
 
 type parseBodyTestCase struct {
 	description string
 	body        string
 	output      *testData
-	err         string
+	err         error
+	// Only for validation errors
+	invalidParams []InvalidParam
 }
 
 func TestParseBody(t *testing.T) {
@@ -85,37 +109,45 @@ func TestParseBody(t *testing.T) {
 			description: "Missing body",
 			body:        "",
 			output:      nil,
-			err:         "body not valid",
+			err:         ErrInvalidBody,
 		},
 		{
 			description: "Invalid body",
 			body:        `body not valid`,
 			output:      nil,
-			err:         "body not valid",
+			err:         ErrInvalidBody,
 		},
 		{
-			description: "Empty body",
-			body:        "{}",
-			output:      nil,
-			err:         "validation error",
+			description:   "Empty body",
+			body:          "{}",
+			output:        nil,
+			err:           &ValidationError{},
+			invalidParams: []InvalidParam{{Name: "name", Reason: "required"}, {Name: "age", Reason: "required"}},
 		},
 		{
-			description: "Missing attribute",
-			body:        `{"name":"test"}`,
+			description:   "Missing attribute",
+			body:          `{"name":"test"}`,
+			output:        nil,
+			err:           &ValidationError{},
+			invalidParams: []InvalidParam{{Name: "age", Reason: "required"}},
+		},
+		{
+			description: "Truncated body",
+			body:        `{"name":"test", "age": 30, "invalid":"attribute}`,
 			output:      nil,
-			err:         "validation error",
+			err:         ErrInvalidBody,
 		},
 		{
 			description: "Additional attribute",
-			body:        `{"name":"test", "age": 30, "invalid":"attribute}`,
+			body:        `{"name":"test", "age": 30, "invalid":"attribute"}`,
 			output:      nil,
-			err:         "validation error",
+			err:         ErrInvalidBody,
 		},
 		{
 			description: "Valid body",
 			body:        `{"name":"test", "age": 30}`,
 			output:      &testData{Name: "test", Age: 30},
-			err:         "",
+			err:         nil,
 		},
 	}
 
@@ -124,8 +156,12 @@ func TestParseBody(t *testing.T) {
 			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
 			result, err := ParseBody[testData](r)
 
-			if tt.err != "" {
-				assert.EqualError(t, err, tt.err)
+			var validationError *ValidationError
+			if errors.As(tt.err, &validationError) {
+				assert.ErrorAs(t, err, &validationError)
+				assert.Equal(t, tt.invalidParams, validationError.InvalidParams)
+			} else if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
 			} else {
 				assert.Equal(t, err, nil)
 			}
@@ -134,3 +170,33 @@ func TestParseBody(t *testing.T) {
 		})
 	}
 }
+
+func TestHaltError(t *testing.T) {
+	tests := []struct {
+		err            error
+		expectedStatus int
+		expectedBody   string
+	}{
+		{db.ErrUserNotFound, 404, `{"type":"about:blank","title":"Not Found","status":404,"detail":"user not found","code":"user_not_found"}`},
+		{db.ErrInvalidTodoListId, 404, `{"type":"about:blank","title":"Not Found","status":404,"detail":"invalid todo list","code":"todo_list_not_found"}`},
+		{db.ErrTodoNotFound, 404, `{"type":"about:blank","title":"Not Found","status":404,"detail":"todo not found","code":"todo_not_found"}`},
+		{db.ErrNotAMember, 404, `{"type":"about:blank","title":"Not Found","status":404,"detail":"user is not a member","code":"member_not_found"}`},
+		{db.ErrUserNameTaken, 409, `{"type":"about:blank","title":"Conflict","status":409,"detail":"user name already taken","code":"user_name_taken"}`},
+		{db.ErrUserOwnsTodoLists, 409, `{"type":"about:blank","title":"Conflict","status":409,"detail":"user still owns todo lists","code":"user_owns_todo_lists"}`},
+		{fmt.Errorf("%w from todo to done", db.ErrInvalidTransition), 422, `{"type":"about:blank","title":"Unprocessable Entity","status":422,"detail":"invalid status transition from todo to done","code":"invalid_status_transition"}`},
+		{fmt.Errorf("%w: duplicate status todo", db.ErrInvalidWorkflow), 422, `{"type":"about:blank","title":"Unprocessable Entity","status":422,"detail":"invalid workflow: duplicate status todo","code":"invalid_workflow"}`},
+		{ErrInvalidBody, 400, `{"type":"about:blank","title":"Bad Request","status":400,"detail":"body not valid","code":"invalid_body"}`},
+		{&ValidationError{InvalidParams: []InvalidParam{{Name: "age", Reason: "required"}}}, 422, `{"type":"about:blank","title":"Unprocessable Entity","status":422,"detail":"validation error","code":"validation_failed","invalid_params":[{"name":"age","reason":"required"}]}`},
+		{errors.New("database is locked"), 500, `{"type":"about:blank","title":"Internal Server Error","status":500,"detail":"internal error","code":"internal_error"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			w := httptest.NewRecorder()
+			HaltError(w, httptest.NewRequest(http.MethodGet, "/", nil), tt.err)
+			assert.Equal(t, tt.expectedStatus, w.Result().StatusCode)
+			assert.Equal(t, problemContentType, w.Result().Header.Get("Content-Type"))
+			assert.Equal(t, tt.expectedBody, w.Body.String())
+		})
+	}
+}
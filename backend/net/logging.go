@@ -1,13 +1,143 @@
 package net
 
 import (
-	"fmt"
+	"backend/util"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
 	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
 )
 
-func LoggingMiddleware(next http.Handler) http.Handler {
+const requestIdHeader = "X-Request-ID"
+
+// Incoming request IDs end up in the logs, so only accept ones that can't forge log lines
+var requestIdRegex = regexp.MustCompile(`^[a-zA-Z0-9._-]{1,64}$`)
+
+// Attributes with these keys are never written to the logs, whatever their value
+var secretKeys = []string{"authorization", "password", "password_hash", "secret", "token", "access_token", "refresh_token"}
+
+// Redacted replaces secrets that must not leave the server
+const Redacted = "[REDACTED]"
+
+type requestLogContextKey struct{}
+
+// requestLog is shared by all middlewares handling a request, so the user resolved by AuthenticationMiddleware also
+// ends up in the request log written by LoggingMiddleware.
+type requestLog struct {
+	logger *slog.Logger
+	userId string
+}
+
+// NewLogger creates a logger writing in the text or json format, which redacts secrets.
+func NewLogger(w io.Writer, format string, level string) (*slog.Logger, error) {
+	var logLevel slog.Level
+	if err := logLevel.UnmarshalText([]byte(level)); err != nil {
+		return nil, err
+	}
+	options := &slog.HandlerOptions{Level: logLevel, ReplaceAttr: RedactSecrets}
+
+	switch format {
+	case "text":
+		return slog.New(slog.NewTextHandler(w, options)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, options)), nil
+	default:
+		return nil, errors.New("unknown log format " + format)
+	}
+}
+
+// RedactSecrets replaces the value of secret attributes, so a careless log line can't leak them.
+func RedactSecrets(_ []string, attr slog.Attr) slog.Attr {
+	if slices.Contains(secretKeys, strings.ToLower(attr.Key)) {
+		return slog.String(attr.Key, Redacted)
+	}
+	return attr
+}
+
+// LoggingMiddleware logs every request once it's handled, and tags it with a request ID that is returned in the
+// X-Request-ID header. Handlers log with Logger, so their lines carry the same request ID.
+func LoggingMiddleware(next http.Handler, mux *http.ServeMux, logger *slog.Logger) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		fmt.Println("Route", r.URL.Path)
-		next.ServeHTTP(w, r)
+		start := time.Now()
+
+		requestId := r.Header.Get(requestIdHeader)
+		if !requestIdRegex.MatchString(requestId) {
+			requestId = util.GenerateRandomUuid("req")
+		}
+		w.Header().Set(requestIdHeader, requestId)
+
+		log := &requestLog{logger: logger.With("request_id", requestId)}
+		recorder := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r.WithContext(context.WithValue(r.Context(), requestLogContextKey{}, log)))
+
+		// Log the route rather than the path, so requests to the same endpoint can be grouped
+		_, pattern := mux.Handler(r)
+		level := slog.LevelInfo
+		if recorder.Status() >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		log.logger.LogAttrs(r.Context(), level, "request",
+			slog.String("method", r.Method),
+			slog.String("pattern", pattern),
+			slog.Int("status", recorder.Status()),
+			slog.Int("bytes", recorder.bytes),
+			slog.Duration("latency", time.Since(start)),
+		)
 	})
 }
+
+// Logger returns the logger of the request, or the default logger outside LoggingMiddleware.
+func Logger(ctx context.Context) *slog.Logger {
+	if log, ok := ctx.Value(requestLogContextKey{}).(*requestLog); ok {
+		return log.logger
+	}
+	return slog.Default()
+}
+
+// setRequestUser adds the user to all following log lines of the request.
+func setRequestUser(ctx context.Context, userId string) {
+	if log, ok := ctx.Value(requestLogContextKey{}).(*requestLog); ok && log.userId == "" {
+		log.userId = userId
+		log.logger = log.logger.With("user_id", userId)
+	}
+}
+
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(data)
+	r.bytes += n
+	return n, err
+}
+
+func (r *responseRecorder) Status() int {
+	if r.status == 0 {
+		// Handlers that don't write anything respond with 200
+		return http.StatusOK
+	}
+	return r.status
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
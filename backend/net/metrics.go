@@ -0,0 +1,168 @@
+package net
+
+import (
+	"backend/db"
+	"cmp"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Upper bounds of the latency histogram in seconds, the same as the Prometheus client libraries use by default
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Requests that don't match a route are counted together, so random paths can't create new series
+const unmatchedRoute = "unmatched"
+
+// Metrics counts the handled requests per route and status, and reports them together with the database stats in the
+// Prometheus text format.
+type Metrics struct {
+	database db.Database
+	// Requests are recorded concurrently, so the mutex must be held while touching the routes
+	mutex  sync.Mutex
+	routes map[routeStatus]*routeMetrics
+}
+
+type routeStatus struct {
+	route  string
+	status int
+}
+
+type routeMetrics struct {
+	count int
+	// Cumulative, every bucket counts the requests that took at most its upper bound
+	buckets []int
+	seconds float64
+}
+
+func CreateMetrics(database db.Database) *Metrics {
+	return &Metrics{
+		database: database,
+		routes:   make(map[routeStatus]*routeMetrics),
+	}
+}
+
+// MetricsMiddleware records every request in metrics, wrap it around AuthenticationMiddleware to also count rejected
+// requests.
+func MetricsMiddleware(next http.Handler, mux *http.ServeMux, metrics *Metrics) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+
+		route := unmatchedRoute
+		if _, pattern := mux.Handler(r); pattern != "" {
+			route = pattern
+		}
+		metrics.record(route, recorder.Status(), time.Since(start))
+	})
+}
+
+func (m *Metrics) record(route string, status int, latency time.Duration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	key := routeStatus{route: route, status: status}
+	metrics, exists := m.routes[key]
+	if !exists {
+		metrics = &routeMetrics{buckets: make([]int, len(latencyBuckets))}
+		m.routes[key] = metrics
+	}
+	metrics.count++
+	metrics.seconds += latency.Seconds()
+	for i, bound := range latencyBuckets {
+		if latency.Seconds() <= bound {
+			metrics.buckets[i]++
+		}
+	}
+}
+
+// ServeHTTP writes all metrics in the Prometheus text format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	stats, err := m.database.Stats()
+	if err != nil {
+		HaltInternalServerError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	m.writeRequests(w)
+	writeStats(w, stats)
+}
+
+func (m *Metrics) writeRequests(w io.Writer) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	// Sorted, so the output is stable between scrapes
+	keys := make([]routeStatus, 0, len(m.routes))
+	for key := range m.routes {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b routeStatus) int {
+		return cmp.Or(strings.Compare(a.route, b.route), cmp.Compare(a.status, b.status))
+	})
+
+	writeHeader(w, "tasks_http_requests_total", "counter", "Requests handled, per route and status code.")
+	for _, key := range keys {
+		fmt.Fprintf(w, "tasks_http_requests_total{%s} %d\n", key.labels(), m.routes[key].count)
+	}
+
+	writeHeader(w, "tasks_http_request_duration_seconds", "histogram", "Time to handle a request, per route and status code.")
+	for _, key := range keys {
+		metrics := m.routes[key]
+		for i, bound := range latencyBuckets {
+			fmt.Fprintf(w, "tasks_http_request_duration_seconds_bucket{%s,le=\"%s\"} %d\n", key.labels(), formatFloat(bound), metrics.buckets[i])
+		}
+		fmt.Fprintf(w, "tasks_http_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", key.labels(), metrics.count)
+		fmt.Fprintf(w, "tasks_http_request_duration_seconds_sum{%s} %s\n", key.labels(), formatFloat(metrics.seconds))
+		fmt.Fprintf(w, "tasks_http_request_duration_seconds_count{%s} %d\n", key.labels(), metrics.count)
+	}
+}
+
+func writeStats(w io.Writer, stats *db.Stats) {
+	writeHeader(w, "tasks_users", "gauge", "Registered users.")
+	fmt.Fprintf(w, "tasks_users %d\n", stats.Users)
+	writeHeader(w, "tasks_todo_lists", "gauge", "Todo lists.")
+	fmt.Fprintf(w, "tasks_todo_lists %d\n", stats.TodoLists)
+
+	writeHeader(w, "tasks_todos", "gauge", "Todos, per status.")
+	statuses := make([]string, 0, len(stats.TodosByStatus))
+	for status := range stats.TodosByStatus {
+		statuses = append(statuses, status)
+	}
+	slices.Sort(statuses)
+	for _, status := range statuses {
+		fmt.Fprintf(w, "tasks_todos{status=\"%s\"} %d\n", escapeLabel(status), stats.TodosByStatus[status])
+	}
+
+	writeHeader(w, "tasks_access_tokens", "gauge", "Access tokens that haven't expired, signed tokens aren't stored.")
+	fmt.Fprintf(w, "tasks_access_tokens %d\n", stats.AccessTokens)
+	writeHeader(w, "tasks_refresh_tokens", "gauge", "Refresh tokens that haven't expired.")
+	fmt.Fprintf(w, "tasks_refresh_tokens %d\n", stats.RefreshTokens)
+}
+
+func writeHeader(w io.Writer, name string, metricType string, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+func (k routeStatus) labels() string {
+	return fmt.Sprintf("route=\"%s\",status=\"%d\"", escapeLabel(k.route), k.status)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escapeLabel escapes a label value, statuses are chosen by users so they can contain anything.
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
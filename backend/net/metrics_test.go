@@ -0,0 +1,96 @@
+package net
+
+import (
+	"backend/db"
+	"backend/util"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func fakeMetricsDatabase() *db.InMemoryDatabase {
+	database := db.TestDatabase(func() time.Time { return util.FakeTime(2024, 6, 30) }, nil)
+	database.Users["valid_user_id"] = db.User{Id: "valid_user_id", Name: "valid"}
+	database.AccessTokens["tkn_aaaaaaaaaaaaaaaaaaaaaa"] = db.AccessToken{UserId: "valid_user_id", Token: "tkn_aaaaaaaaaaaaaaaaaaaaaa", ExpiresAt: util.FakeTime(2024, 7, 1)}
+	database.TodoLists["lst_1"] = db.TodoList{Id: "lst_1", OwnerId: "valid_user_id"}
+	database.TodoItems["tdo_1"] = db.TodoItem{Id: "tdo_1", ListId: "lst_1", Status: "todo"}
+	database.TodoItems["tdo_2"] = db.TodoItem{Id: "tdo_2", ListId: "lst_1", Status: `in "review"`}
+	return database
+}
+
+func scrape(t *testing.T, handler http.Handler) string {
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", w.Result().Header.Get("Content-Type"))
+	return w.Body.String()
+}
+
+func TestMetricsMiddleware(t *testing.T) {
+	database := fakeMetricsDatabase()
+	metrics := CreateMetrics(database)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /todolists/{list_id}", func(w http.ResponseWriter, r *http.Request) {
+		Success(w, map[string]string{"id": r.PathValue("list_id")})
+	})
+	mux.Handle("GET /metrics", metrics)
+	handler := MetricsMiddleware(AuthenticationMiddleware(mux, CreateDatabaseTokens(database), database, false), mux, metrics)
+
+	for _, request := range []struct {
+		url   string
+		token string
+	}{
+		{url: "/todolists/lst_1", token: "Bearer tkn_aaaaaaaaaaaaaaaaaaaaaa"},
+		{url: "/todolists/lst_2", token: "Bearer tkn_aaaaaaaaaaaaaaaaaaaaaa"},
+		{url: "/todolists/lst_1"},
+		{url: "/unknown/path", token: "Bearer tkn_aaaaaaaaaaaaaaaaaaaaaa"},
+		{url: "/other/unknown/path", token: "Bearer tkn_aaaaaaaaaaaaaaaaaaaaaa"},
+	} {
+		r := httptest.NewRequest(http.MethodGet, request.url, nil)
+		r.Header.Set("Authorization", request.token)
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	output := scrape(t, handler)
+
+	assert.Contains(t, output, "# TYPE tasks_http_requests_total counter\n"+
+		"tasks_http_requests_total{route=\"GET /todolists/{list_id}\",status=\"200\"} 2\n"+
+		"tasks_http_requests_total{route=\"GET /todolists/{list_id}\",status=\"401\"} 1\n"+
+		"tasks_http_requests_total{route=\"unmatched\",status=\"404\"} 2\n")
+	assert.Contains(t, output, "tasks_http_request_duration_seconds_count{route=\"GET /todolists/{list_id}\",status=\"200\"} 2\n")
+	assert.Contains(t, output, "# TYPE tasks_users gauge\ntasks_users 1\n")
+	assert.Contains(t, output, "tasks_todo_lists 1\n")
+	assert.Contains(t, output, "tasks_todos{status=\"in \\\"review\\\"\"} 1\ntasks_todos{status=\"todo\"} 1\n")
+	assert.Contains(t, output, "tasks_access_tokens 1\n")
+	assert.Contains(t, output, "tasks_refresh_tokens 0\n")
+	assert.NotContains(t, output, "/unknown/path")
+}
+
+func TestMetrics_Histogram(t *testing.T) {
+	metrics := CreateMetrics(fakeMetricsDatabase())
+	metrics.record("GET /todolists", http.StatusOK, 20*time.Millisecond)
+	metrics.record("GET /todolists", http.StatusOK, 300*time.Millisecond)
+	metrics.record("GET /todolists", http.StatusOK, 20*time.Second)
+
+	output := scrape(t, metrics)
+
+	const labels = `route="GET /todolists",status="200"`
+	assert.Contains(t, output, "# TYPE tasks_http_request_duration_seconds histogram\n"+
+		"tasks_http_request_duration_seconds_bucket{"+labels+",le=\"0.005\"} 0\n"+
+		"tasks_http_request_duration_seconds_bucket{"+labels+",le=\"0.01\"} 0\n"+
+		"tasks_http_request_duration_seconds_bucket{"+labels+",le=\"0.025\"} 1\n"+
+		"tasks_http_request_duration_seconds_bucket{"+labels+",le=\"0.05\"} 1\n"+
+		"tasks_http_request_duration_seconds_bucket{"+labels+",le=\"0.1\"} 1\n"+
+		"tasks_http_request_duration_seconds_bucket{"+labels+",le=\"0.25\"} 1\n"+
+		"tasks_http_request_duration_seconds_bucket{"+labels+",le=\"0.5\"} 2\n"+
+		"tasks_http_request_duration_seconds_bucket{"+labels+",le=\"1\"} 2\n"+
+		"tasks_http_request_duration_seconds_bucket{"+labels+",le=\"2.5\"} 2\n"+
+		"tasks_http_request_duration_seconds_bucket{"+labels+",le=\"5\"} 2\n"+
+		"tasks_http_request_duration_seconds_bucket{"+labels+",le=\"10\"} 2\n"+
+		"tasks_http_request_duration_seconds_bucket{"+labels+",le=\"+Inf\"} 3\n"+
+		"tasks_http_request_duration_seconds_sum{"+labels+"} 20.32\n"+
+		"tasks_http_request_duration_seconds_count{"+labels+"} 3\n")
+}
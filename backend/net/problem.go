@@ -0,0 +1,88 @@
+package net
+
+import (
+	"backend/db"
+	"errors"
+	"net/http"
+)
+
+const problemContentType = "application/problem+json"
+
+// Problem is the body of every error response, following RFC 7807. Clients tell errors apart by Code, Detail is meant
+// for people and can change.
+type Problem struct {
+	// Always "about:blank", so Title is the reason phrase of the status code
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Code   string `json:"code"`
+	// Only on validation errors, the fields of the body that aren't valid
+	InvalidParams []InvalidParam `json:"invalid_params,omitempty"`
+}
+
+type InvalidParam struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// ErrInvalidBody is returned by ParseBody when the body isn't JSON of the expected shape.
+var ErrInvalidBody = errors.New("body not valid")
+
+// ValidationError is returned by ParseBody when the body is well-formed, but its fields aren't valid.
+type ValidationError struct {
+	InvalidParams []InvalidParam
+}
+
+func (e *ValidationError) Error() string {
+	return "validation error"
+}
+
+// errorProblem maps an error to its status code and machine-readable code, errors that aren't expected are a 500.
+type errorProblem struct {
+	err    error
+	status int
+	code   string
+}
+
+var errorProblems = []errorProblem{
+	{err: db.ErrUserNotFound, status: http.StatusNotFound, code: "user_not_found"},
+	{err: db.ErrInvalidTodoListId, status: http.StatusNotFound, code: "todo_list_not_found"},
+	{err: db.ErrTodoListNotFound, status: http.StatusNotFound, code: "todo_list_not_found"},
+	{err: db.ErrInvalidTodoId, status: http.StatusNotFound, code: "todo_not_found"},
+	{err: db.ErrTodoNotFound, status: http.StatusNotFound, code: "todo_not_found"},
+	{err: db.ErrNotAMember, status: http.StatusNotFound, code: "member_not_found"},
+	{err: db.ErrUserNameTaken, status: http.StatusConflict, code: "user_name_taken"},
+	{err: db.ErrUserOwnsTodoLists, status: http.StatusConflict, code: "user_owns_todo_lists"},
+	{err: db.ErrInvalidTransition, status: http.StatusUnprocessableEntity, code: "invalid_status_transition"},
+	{err: db.ErrInvalidWorkflow, status: http.StatusUnprocessableEntity, code: "invalid_workflow"},
+	{err: ErrInvalidBody, status: http.StatusBadRequest, code: "invalid_body"},
+}
+
+// HaltError halts the request with the problem err maps to, see errorProblems.
+func HaltError(w http.ResponseWriter, r *http.Request, err error) {
+	var validationError *ValidationError
+	if errors.As(err, &validationError) {
+		haltProblem(w, http.StatusUnprocessableEntity, "validation_failed", err.Error(), validationError.InvalidParams...)
+		return
+	}
+	for _, problem := range errorProblems {
+		if errors.Is(err, problem.err) {
+			haltProblem(w, problem.status, problem.code, err.Error())
+			return
+		}
+	}
+	HaltInternalServerError(w, r, err)
+}
+
+func haltProblem(w http.ResponseWriter, status int, code string, detail string, invalidParams ...InvalidParam) {
+	w.Header().Set("Content-Type", problemContentType)
+	writeResponse(w, status, Problem{
+		Type:          "about:blank",
+		Title:         http.StatusText(status),
+		Status:        status,
+		Detail:        detail,
+		Code:          code,
+		InvalidParams: invalidParams,
+	})
+}
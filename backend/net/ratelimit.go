@@ -0,0 +1,182 @@
+package net
+
+import (
+	"backend/util"
+	"math"
+	stdnet "net"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Buckets that refilled completely are dropped this often, so clients that went away don't use memory forever
+const rateLimitSweepInterval = time.Minute
+
+// writesRoute is the route of the buckets of the write limit, which all writes share
+const writesRoute = "writes"
+
+var writeMethods = []string{http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// RateLimit lets a client make Burst requests at once, and then RequestsPerSecond on average. A zero rate doesn't limit.
+type RateLimit struct {
+	RequestsPerSecond float64
+	Burst             int
+}
+
+// RateLimiter keeps a token bucket per client, identified by the authenticated user or otherwise the IP address. Routes
+// with their own limit have their own buckets, writes to all other routes share the buckets of the write limit and
+// reads share the buckets of the default limit.
+type RateLimiter struct {
+	defaultLimit RateLimit
+	// Replaces the default limit on POST, PUT, PATCH and DELETE requests
+	writeLimit RateLimit
+	// By route pattern, like "POST /users/login"
+	routeLimits map[string]RateLimit
+	currentTime util.CurrentTime
+
+	// Requests are limited concurrently, so the mutex must be held while touching the buckets
+	mutex     sync.Mutex
+	buckets   map[bucketKey]*bucket
+	lastSweep time.Time
+}
+
+type bucketKey struct {
+	// The route pattern, writesRoute for the write limit and empty for the default limit
+	route  string
+	client string
+}
+
+type bucket struct {
+	limit     RateLimit
+	tokens    float64
+	updatedAt time.Time
+}
+
+// rateLimitResult has what the RateLimit-* headers report, durations are rounded up to whole seconds by the headers.
+type rateLimitResult struct {
+	allowed    bool
+	remaining  int
+	reset      time.Duration
+	retryAfter time.Duration
+}
+
+func CreateRateLimiter(defaultLimit RateLimit, writeLimit RateLimit, routeLimits map[string]RateLimit) *RateLimiter {
+	return TestRateLimiter(defaultLimit, writeLimit, routeLimits, util.GetCurrentTime)
+}
+
+func TestRateLimiter(defaultLimit RateLimit, writeLimit RateLimit, routeLimits map[string]RateLimit, currentTime util.CurrentTime) *RateLimiter {
+	return &RateLimiter{
+		defaultLimit: defaultLimit,
+		writeLimit:   writeLimit,
+		routeLimits:  routeLimits,
+		currentTime:  currentTime,
+		buckets:      make(map[bucketKey]*bucket),
+		lastSweep:    currentTime(),
+	}
+}
+
+// RateLimitMiddleware halts requests of clients that exceed their limit with 429 Too Many Requests. Wrap
+// AuthenticationMiddleware around it, so authenticated requests are limited per user instead of per IP address. That
+// also means requests halted by AuthenticationMiddleware, like those with an invalid token, aren't limited.
+func RateLimitMiddleware(next http.Handler, mux *http.ServeMux, limiter *RateLimiter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := bucketKey{client: clientKey(r)}
+		limit := limiter.defaultLimit
+		if slices.Contains(writeMethods, r.Method) {
+			key.route, limit = writesRoute, limiter.writeLimit
+		}
+		if _, pattern := mux.Handler(r); pattern != "" {
+			if routeLimit, exists := limiter.routeLimits[pattern]; exists {
+				key.route, limit = pattern, routeLimit
+			}
+		}
+		if limit.RequestsPerSecond <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		result := limiter.take(key, limit)
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(limit.Burst))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.remaining))
+		w.Header().Set("RateLimit-Reset", seconds(result.reset))
+		if !result.allowed {
+			Logger(r.Context()).Warn("Rate limited", "client", key.client, "route", key.route)
+			w.Header().Set("Retry-After", seconds(result.retryAfter))
+			haltProblem(w, http.StatusTooManyRequests, "rate_limited", "too many requests")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// take removes a token from the bucket of key, if there is one.
+func (l *RateLimiter) take(key bucketKey, limit RateLimit) rateLimitResult {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.currentTime()
+	if now.Sub(l.lastSweep) >= rateLimitSweepInterval {
+		l.sweep(now)
+	}
+
+	b, exists := l.buckets[key]
+	if !exists {
+		b = &bucket{limit: limit, tokens: float64(limit.Burst), updatedAt: now}
+		l.buckets[key] = b
+	}
+	b.refill(now)
+
+	result := rateLimitResult{allowed: b.tokens >= 1}
+	if result.allowed {
+		b.tokens--
+	} else {
+		result.retryAfter = b.durationUntil(1)
+	}
+	result.remaining = int(b.tokens)
+	result.reset = b.durationUntil(float64(limit.Burst))
+	return result
+}
+
+func (l *RateLimiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if b.refill(now); b.tokens >= float64(b.limit.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+func (b *bucket) refill(now time.Time) {
+	elapsed := now.Sub(b.updatedAt).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(float64(b.limit.Burst), b.tokens+elapsed*b.limit.RequestsPerSecond)
+		b.updatedAt = now
+	}
+}
+
+// durationUntil returns how long it takes until the bucket holds tokens again.
+func (b *bucket) durationUntil(tokens float64) time.Duration {
+	if b.tokens >= tokens {
+		return 0
+	}
+	return time.Duration((tokens - b.tokens) / b.limit.RequestsPerSecond * float64(time.Second))
+}
+
+// clientKey identifies the user of authenticated requests, and the IP address of all others. Behind a reverse proxy all
+// requests come from the proxy, so clients that aren't logged in share their limit.
+func clientKey(r *http.Request) string {
+	if user, ok := UserFromContext(r.Context()); ok {
+		return user.Id
+	}
+	host, _, err := stdnet.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func seconds(duration time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(duration.Seconds())))
+}
@@ -0,0 +1,213 @@
+package net
+
+import (
+	"backend/db"
+	"backend/util"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const (
+	firstUserToken  = "tkn_aaaaaaaaaaaaaaaaaaaaaa"
+	secondUserToken = "tkn_bbbbbbbbbbbbbbbbbbbbbb"
+)
+
+type rateLimitedRequest struct {
+	method     string
+	url        string
+	remoteAddr string
+	token      string
+	// Time since the previous request
+	wait               time.Duration
+	expectedStatus     int
+	expectedRemaining  string
+	expectedReset      string
+	expectedRetryAfter string
+}
+
+// fakeRateLimited serves every route of a mux with two users behind AuthenticationMiddleware and RateLimitMiddleware,
+// and returns a function that moves the clock.
+func fakeRateLimited(defaultLimit RateLimit, writeLimit RateLimit, routeLimits map[string]RateLimit) (http.Handler, func(time.Duration)) {
+	now := util.FakeTime(2024, 6, 30)
+	database := db.TestDatabase(func() time.Time { return now }, nil)
+	for user, token := range map[string]string{"first": firstUserToken, "second": secondUserToken} {
+		database.Users[user+"_user_id"] = db.User{Id: user + "_user_id", Name: user}
+		database.AccessTokens[token] = db.AccessToken{UserId: user + "_user_id", Token: token, ExpiresAt: util.FakeTime(2024, 7, 1)}
+	}
+
+	mux := http.NewServeMux()
+	for _, pattern := range []string{"POST /users/login", "GET /todolists", "POST /todolists", "DELETE /todolists/{list_id}"} {
+		mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) { NoContent(w) })
+	}
+	limiter := TestRateLimiter(defaultLimit, writeLimit, routeLimits, func() time.Time { return now })
+	handler := AuthenticationMiddleware(RateLimitMiddleware(mux, mux, limiter), CreateDatabaseTokens(database), database, false)
+	return handler, func(duration time.Duration) { now = now.Add(duration) }
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	loginLimit := map[string]RateLimit{"POST /users/login": {RequestsPerSecond: 0.5, Burst: 2}}
+	tests := []struct {
+		name         string
+		defaultLimit RateLimit
+		writeLimit   RateLimit
+		routeLimits  map[string]RateLimit
+		requests     []rateLimitedRequest
+	}{
+		{
+			name:         "Limited after burst",
+			defaultLimit: RateLimit{RequestsPerSecond: 1, Burst: 2},
+			requests: []rateLimitedRequest{
+				{method: http.MethodGet, url: "/todolists", token: firstUserToken, expectedStatus: http.StatusNoContent, expectedRemaining: "1", expectedReset: "1"},
+				{method: http.MethodGet, url: "/todolists", token: firstUserToken, expectedStatus: http.StatusNoContent, expectedRemaining: "0", expectedReset: "2"},
+				{method: http.MethodGet, url: "/todolists", token: firstUserToken, expectedStatus: http.StatusTooManyRequests, expectedRemaining: "0", expectedReset: "2", expectedRetryAfter: "1"},
+			},
+		},
+		{
+			name:         "Refills over time",
+			defaultLimit: RateLimit{RequestsPerSecond: 1, Burst: 2},
+			requests: []rateLimitedRequest{
+				{method: http.MethodGet, url: "/todolists", token: firstUserToken, expectedStatus: http.StatusNoContent, expectedRemaining: "1", expectedReset: "1"},
+				{method: http.MethodGet, url: "/todolists", token: firstUserToken, expectedStatus: http.StatusNoContent, expectedRemaining: "0", expectedReset: "2"},
+				{method: http.MethodGet, url: "/todolists", token: firstUserToken, wait: 500 * time.Millisecond, expectedStatus: http.StatusTooManyRequests, expectedRemaining: "0", expectedReset: "2", expectedRetryAfter: "1"},
+				{method: http.MethodGet, url: "/todolists", token: firstUserToken, wait: 500 * time.Millisecond, expectedStatus: http.StatusNoContent, expectedRemaining: "0", expectedReset: "2"},
+				{method: http.MethodGet, url: "/todolists", token: firstUserToken, wait: time.Hour, expectedStatus: http.StatusNoContent, expectedRemaining: "1", expectedReset: "1"},
+			},
+		},
+		{
+			name:         "Users have their own limit",
+			defaultLimit: RateLimit{RequestsPerSecond: 1, Burst: 1},
+			requests: []rateLimitedRequest{
+				{method: http.MethodGet, url: "/todolists", remoteAddr: "192.0.2.1:1234", token: firstUserToken, expectedStatus: http.StatusNoContent, expectedRemaining: "0", expectedReset: "1"},
+				{method: http.MethodGet, url: "/todolists", remoteAddr: "192.0.2.1:1234", token: secondUserToken, expectedStatus: http.StatusNoContent, expectedRemaining: "0", expectedReset: "1"},
+				{method: http.MethodGet, url: "/todolists", remoteAddr: "192.0.2.2:1234", token: firstUserToken, expectedStatus: http.StatusTooManyRequests, expectedRemaining: "0", expectedReset: "1", expectedRetryAfter: "1"},
+			},
+		},
+		{
+			name:         "IP addresses have their own limit",
+			defaultLimit: RateLimit{RequestsPerSecond: 1, Burst: 1},
+			writeLimit:   RateLimit{RequestsPerSecond: 1, Burst: 1},
+			requests: []rateLimitedRequest{
+				{method: http.MethodPost, url: "/users/login", remoteAddr: "192.0.2.1:1234", expectedStatus: http.StatusNoContent, expectedRemaining: "0", expectedReset: "1"},
+				{method: http.MethodPost, url: "/users/login", remoteAddr: "192.0.2.2:1234", expectedStatus: http.StatusNoContent, expectedRemaining: "0", expectedReset: "1"},
+				{method: http.MethodPost, url: "/users/login", remoteAddr: "192.0.2.1:5678", expectedStatus: http.StatusTooManyRequests, expectedRemaining: "0", expectedReset: "1", expectedRetryAfter: "1"},
+			},
+		},
+		{
+			name:         "Writes share the write limit",
+			defaultLimit: RateLimit{RequestsPerSecond: 1, Burst: 1},
+			writeLimit:   RateLimit{RequestsPerSecond: 1, Burst: 2},
+			requests: []rateLimitedRequest{
+				{method: http.MethodPost, url: "/todolists", token: firstUserToken, expectedStatus: http.StatusNoContent, expectedRemaining: "1", expectedReset: "1"},
+				{method: http.MethodGet, url: "/todolists", token: firstUserToken, expectedStatus: http.StatusNoContent, expectedRemaining: "0", expectedReset: "1"},
+				{method: http.MethodDelete, url: "/todolists/lst_aaaa", token: firstUserToken, expectedStatus: http.StatusNoContent, expectedRemaining: "0", expectedReset: "2"},
+				{method: http.MethodPost, url: "/todolists", token: firstUserToken, expectedStatus: http.StatusTooManyRequests, expectedRemaining: "0", expectedReset: "2", expectedRetryAfter: "1"},
+			},
+		},
+		{
+			name:         "Writes without write limit",
+			defaultLimit: RateLimit{RequestsPerSecond: 1, Burst: 1},
+			requests: []rateLimitedRequest{
+				{method: http.MethodPost, url: "/todolists", token: firstUserToken, expectedStatus: http.StatusNoContent},
+				{method: http.MethodPost, url: "/todolists", token: firstUserToken, expectedStatus: http.StatusNoContent},
+				{method: http.MethodGet, url: "/todolists", token: firstUserToken, expectedStatus: http.StatusNoContent, expectedRemaining: "0", expectedReset: "1"},
+			},
+		},
+		{
+			name:        "Route limit replaces write limit",
+			writeLimit:  RateLimit{RequestsPerSecond: 1, Burst: 1},
+			routeLimits: loginLimit,
+			requests: []rateLimitedRequest{
+				{method: http.MethodPost, url: "/todolists", token: firstUserToken, expectedStatus: http.StatusNoContent, expectedRemaining: "0", expectedReset: "1"},
+				{method: http.MethodPost, url: "/users/login", expectedStatus: http.StatusNoContent, expectedRemaining: "1", expectedReset: "2"},
+			},
+		},
+		{
+			name:         "Route limit replaces default limit",
+			defaultLimit: RateLimit{RequestsPerSecond: 1, Burst: 1},
+			routeLimits:  loginLimit,
+			requests: []rateLimitedRequest{
+				{method: http.MethodGet, url: "/todolists", token: firstUserToken, expectedStatus: http.StatusNoContent, expectedRemaining: "0", expectedReset: "1"},
+				{method: http.MethodPost, url: "/users/login", expectedStatus: http.StatusNoContent, expectedRemaining: "1", expectedReset: "2"},
+				{method: http.MethodPost, url: "/users/login", expectedStatus: http.StatusNoContent, expectedRemaining: "0", expectedReset: "4"},
+				{method: http.MethodPost, url: "/users/login", expectedStatus: http.StatusTooManyRequests, expectedRemaining: "0", expectedReset: "4", expectedRetryAfter: "2"},
+				{method: http.MethodGet, url: "/todolists", token: firstUserToken, wait: time.Second, expectedStatus: http.StatusNoContent, expectedRemaining: "0", expectedReset: "1"},
+			},
+		},
+		{
+			name:        "Route limit without default limit",
+			routeLimits: loginLimit,
+			requests: []rateLimitedRequest{
+				{method: http.MethodGet, url: "/todolists", token: firstUserToken, expectedStatus: http.StatusNoContent},
+				{method: http.MethodGet, url: "/todolists", token: firstUserToken, expectedStatus: http.StatusNoContent},
+				{method: http.MethodPost, url: "/users/login", expectedStatus: http.StatusNoContent, expectedRemaining: "1", expectedReset: "2"},
+			},
+		},
+		{
+			name:         "Route without limit",
+			defaultLimit: RateLimit{RequestsPerSecond: 1, Burst: 1},
+			routeLimits:  map[string]RateLimit{"GET /todolists": {}},
+			requests: []rateLimitedRequest{
+				{method: http.MethodGet, url: "/todolists", token: firstUserToken, expectedStatus: http.StatusNoContent},
+				{method: http.MethodGet, url: "/todolists", token: firstUserToken, expectedStatus: http.StatusNoContent},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, wait := fakeRateLimited(tt.defaultLimit, tt.writeLimit, tt.routeLimits)
+
+			for i, request := range tt.requests {
+				wait(request.wait)
+				w := httptest.NewRecorder()
+				r := httptest.NewRequest(request.method, request.url, nil)
+				if request.remoteAddr != "" {
+					r.RemoteAddr = request.remoteAddr
+				}
+				if request.token != "" {
+					r.Header.Set("Authorization", "Bearer "+request.token)
+				}
+
+				handler.ServeHTTP(w, r)
+
+				assert.Equal(t, request.expectedStatus, w.Result().StatusCode, "request %d", i)
+				assert.Equal(t, request.expectedRemaining, w.Result().Header.Get("RateLimit-Remaining"), "request %d", i)
+				assert.Equal(t, request.expectedReset, w.Result().Header.Get("RateLimit-Reset"), "request %d", i)
+				assert.Equal(t, request.expectedRetryAfter, w.Result().Header.Get("Retry-After"), "request %d", i)
+				if request.expectedStatus == http.StatusTooManyRequests {
+					assert.JSONEq(t, `{"type":"about:blank","title":"Too Many Requests","status":429,"detail":"too many requests","code":"rate_limited"}`, w.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimitMiddleware_LimitHeader(t *testing.T) {
+	handler, _ := fakeRateLimited(RateLimit{}, RateLimit{RequestsPerSecond: 1, Burst: 3}, nil)
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/users/login", nil))
+
+	assert.Equal(t, "3", w.Result().Header.Get("RateLimit-Limit"))
+}
+
+func TestRateLimiter_SweepsFullBuckets(t *testing.T) {
+	now := util.FakeTime(2024, 6, 30)
+	limiter := TestRateLimiter(RateLimit{RequestsPerSecond: 1, Burst: 10}, RateLimit{}, nil, func() time.Time { return now })
+	limiter.take(bucketKey{client: "first"}, limiter.defaultLimit)
+	now = now.Add(rateLimitSweepInterval - 500*time.Millisecond)
+	limiter.take(bucketKey{client: "second"}, limiter.defaultLimit)
+
+	// Only the bucket of the first client refilled by the time the sweep runs
+	now = now.Add(500 * time.Millisecond)
+	limiter.take(bucketKey{client: "third"}, limiter.defaultLimit)
+	assert.Len(t, limiter.buckets, 2)
+	assert.NotContains(t, limiter.buckets, bucketKey{client: "first"})
+
+	now = now.Add(rateLimitSweepInterval)
+	limiter.take(bucketKey{client: "third"}, limiter.defaultLimit)
+	assert.Len(t, limiter.buckets, 1)
+}
@@ -0,0 +1,53 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// ShutdownHook runs once the server stopped handling requests, e.g. to flush the database to disk.
+type ShutdownHook func() error
+
+// Serve handles requests until ctx is cancelled. Then health stops being ready, while the server keeps handling requests
+// for drainDelay so supervisors notice and stop sending new ones. Afterwards it stops accepting connections and gives
+// in-flight requests up to drainTimeout to finish. The hooks run in order afterwards, also when the server failed to start.
+func Serve(ctx context.Context, server *http.Server, health *Health, drainDelay time.Duration, drainTimeout time.Duration, hooks ...ShutdownHook) error {
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.ListenAndServe()
+	}()
+
+	var err error
+	select {
+	case err = <-serveErr:
+	case <-ctx.Done():
+		health.ShutDown()
+		// The server can still fail while supervisors notice, then there's nothing left to drain
+		select {
+		case err = <-serveErr:
+		case <-time.After(drainDelay):
+			err = shutDown(server, drainTimeout)
+		}
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		err = nil
+	}
+
+	for _, hook := range hooks {
+		err = errors.Join(err, hook())
+	}
+	return err
+}
+
+func shutDown(server *http.Server, drainTimeout time.Duration) error {
+	drainCtx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+	err := server.Shutdown(drainCtx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		// Cut off the connections of requests that didn't finish in time
+		err = errors.Join(errors.New("not all requests finished before the drain timeout"), server.Close())
+	}
+	return err
+}
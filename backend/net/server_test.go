@@ -0,0 +1,122 @@
+package net
+
+import (
+	"backend/db"
+	"context"
+	"github.com/stretchr/testify/assert"
+	stdnet "net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func freeAddress(t *testing.T) string {
+	listener, err := stdnet.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+func waitUntilListening(t *testing.T, address string) {
+	for i := 0; i < 100; i++ {
+		if conn, err := stdnet.Dial("tcp", address); err == nil {
+			_ = conn.Close()
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("server not listening on %s", address)
+}
+
+func TestServe_DrainsRequestsBeforeHooks(t *testing.T) {
+	address := freeAddress(t)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	server := &http.Server{Addr: address, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		NoContent(w)
+	})}
+
+	var events []string
+	hook := func() error {
+		events = append(events, "hook")
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- Serve(ctx, server, CreateHealth(db.CreateDatabase()), 0, time.Second, hook) }()
+	waitUntilListening(t, address)
+
+	response := make(chan int)
+	go func() {
+		resp, err := http.Get("http://" + address)
+		if err != nil {
+			response <- 0
+			return
+		}
+		_ = resp.Body.Close()
+		response <- resp.StatusCode
+	}()
+	<-started
+
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(t, events, "hooks ran before the request finished")
+
+	events = append(events, "request")
+	close(release)
+	assert.Equal(t, http.StatusNoContent, <-response)
+	assert.NoError(t, <-done)
+	assert.Equal(t, []string{"request", "hook"}, events)
+}
+
+func TestServe_DrainTimeout(t *testing.T) {
+	address := freeAddress(t)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	server := &http.Server{Addr: address, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})}
+
+	hookRan := false
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- Serve(ctx, server, CreateHealth(db.CreateDatabase()), 0, 50*time.Millisecond, func() error { hookRan = true; return nil })
+	}()
+	waitUntilListening(t, address)
+
+	go func() {
+		if resp, err := http.Get("http://" + address); err == nil {
+			_ = resp.Body.Close()
+		}
+	}()
+	<-started
+	cancel()
+
+	assert.EqualError(t, <-done, "not all requests finished before the drain timeout")
+	assert.True(t, hookRan)
+}
+
+func TestServe_FailsToStart(t *testing.T) {
+	listener, err := stdnet.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	var hooks []string
+	err = Serve(context.Background(), &http.Server{Addr: listener.Addr().String()}, CreateHealth(db.CreateDatabase()), 0, time.Second,
+		func() error { hooks = append(hooks, "first"); return nil },
+		func() error { hooks = append(hooks, "second"); return nil },
+	)
+
+	assert.ErrorContains(t, err, "address already in use")
+	assert.Equal(t, []string{"first", "second"}, hooks)
+}
@@ -0,0 +1,202 @@
+package net
+
+import (
+	"backend/db"
+	"backend/util"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Tokens issues the access tokens AuthenticationMiddleware accepts.
+type Tokens interface {
+	Issue(userId string, lifetime time.Duration) (*db.AccessToken, error)
+	// Verify rejects invalid and expired tokens
+	Verify(token string) (*db.AccessToken, error)
+}
+
+// DatabaseTokens stores every access token in the database, so they can be revoked right away.
+type DatabaseTokens struct {
+	database db.Database
+}
+
+func CreateDatabaseTokens(database db.Database) *DatabaseTokens {
+	return &DatabaseTokens{database: database}
+}
+
+func (t *DatabaseTokens) Issue(userId string, lifetime time.Duration) (*db.AccessToken, error) {
+	return t.database.CreateAccessToken(userId, lifetime)
+}
+
+func (t *DatabaseTokens) Verify(token string) (*db.AccessToken, error) {
+	return t.database.GetAccessToken(token)
+}
+
+// Secrets shorter than the SHA-256 output weaken the signature
+const minSigningKeyLength = 32
+
+type SigningKey struct {
+	Id     string
+	Secret []byte
+}
+
+// SignedTokens are JWTs signed with HMAC-SHA256, verified without a database lookup so multiple servers can share
+// them. They can't be revoked, logging out only revokes the refresh token and the access token stays valid until it
+// expires.
+type SignedTokens struct {
+	// The first key signs new tokens, the others are only accepted to verify tokens signed before a key rotation
+	keys         []SigningKey
+	currentTime  util.CurrentTime
+	generateUuid util.GenerateUuid
+}
+
+func CreateSignedTokens(keys []SigningKey) (*SignedTokens, error) {
+	return TestSignedTokens(keys, util.GetCurrentTime, util.GenerateRandomUuid)
+}
+
+func TestSignedTokens(keys []SigningKey, currentTime util.CurrentTime, generateUuid util.GenerateUuid) (*SignedTokens, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("at least one signing key is required")
+	}
+	for i, key := range keys {
+		if key.Id == "" {
+			return nil, errors.New("signing key without id")
+		}
+		if len(key.Secret) < minSigningKeyLength {
+			return nil, fmt.Errorf("signing key %s must be at least %d bytes", key.Id, minSigningKeyLength)
+		}
+		for _, other := range keys[:i] {
+			if other.Id == key.Id {
+				return nil, fmt.Errorf("duplicate signing key %s", key.Id)
+			}
+		}
+	}
+	return &SignedTokens{keys: keys, currentTime: currentTime, generateUuid: generateUuid}, nil
+}
+
+// ParseSigningKeys reads keys in the form "id1:secret1,id2:secret2", the first key signs new tokens.
+func ParseSigningKeys(value string) ([]SigningKey, error) {
+	var keys []SigningKey
+	for _, pair := range strings.Split(value, ",") {
+		id, secret, found := strings.Cut(strings.TrimSpace(pair), ":")
+		if !found {
+			// Don't leak the secret in the error message
+			return nil, errors.New("signing keys must be in the form id:secret")
+		}
+		keys = append(keys, SigningKey{Id: id, Secret: []byte(secret)})
+	}
+	return keys, nil
+}
+
+type tokenHeader struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ"`
+	KeyId     string `json:"kid"`
+}
+
+type tokenClaims struct {
+	Subject   string `json:"sub"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+	// Unique per token, so every login is a separate session even when issued within the same second
+	Id string `json:"jti"`
+}
+
+const signingAlgorithm = "HS256"
+
+func (t *SignedTokens) Issue(userId string, lifetime time.Duration) (*db.AccessToken, error) {
+	// JWTs only carry whole seconds, and Verify returns them in UTC
+	now := t.currentTime().UTC().Truncate(time.Second)
+	expiresAt := now.Add(lifetime)
+	key := t.keys[0]
+
+	header, err := json.Marshal(tokenHeader{Algorithm: signingAlgorithm, Type: "JWT", KeyId: key.Id})
+	if err != nil {
+		return nil, err
+	}
+	claims, err := json.Marshal(tokenClaims{
+		Subject:   userId,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expiresAt.Unix(),
+		Id:        t.generateUuid("jti"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	payload := encodeSegment(header) + "." + encodeSegment(claims)
+	return &db.AccessToken{
+		UserId:    userId,
+		Token:     payload + "." + encodeSegment(sign(key, payload)),
+		IssuedAt:  now,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+func (t *SignedTokens) Verify(token string) (*db.AccessToken, error) {
+	segments := strings.Split(token, ".")
+	if len(segments) != 3 {
+		return nil, errors.New("invalid access token")
+	}
+
+	var header tokenHeader
+	if err := decodeSegment(segments[0], &header); err != nil || header.Algorithm != signingAlgorithm {
+		return nil, errors.New("invalid access token")
+	}
+	key, found := t.key(header.KeyId)
+	if !found {
+		return nil, errors.New("invalid access token")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(segments[2])
+	if err != nil || !hmac.Equal(signature, sign(key, segments[0]+"."+segments[1])) {
+		return nil, errors.New("invalid access token")
+	}
+
+	// Only trust the claims once the signature checks out
+	var claims tokenClaims
+	if err = decodeSegment(segments[1], &claims); err != nil || claims.Subject == "" {
+		return nil, errors.New("invalid access token")
+	}
+	accessToken := db.AccessToken{
+		UserId:    claims.Subject,
+		Token:     token,
+		IssuedAt:  time.Unix(claims.IssuedAt, 0).UTC(),
+		ExpiresAt: time.Unix(claims.ExpiresAt, 0).UTC(),
+	}
+	if !t.currentTime().Before(accessToken.ExpiresAt) {
+		return nil, errors.New("access token expired")
+	}
+	return &accessToken, nil
+}
+
+func (t *SignedTokens) key(id string) (SigningKey, bool) {
+	for _, key := range t.keys {
+		if key.Id == id {
+			return key, true
+		}
+	}
+	return SigningKey{}, false
+}
+
+func sign(key SigningKey, payload string) []byte {
+	mac := hmac.New(sha256.New, key.Secret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+func encodeSegment(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeSegment(segment string, result any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, result)
+}
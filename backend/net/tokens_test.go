@@ -0,0 +1,213 @@
+package net
+
+import (
+	"backend/util"
+	"encoding/base64"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	currentKey  = SigningKey{Id: "current", Secret: []byte("cccccccccccccccccccccccccccccccc")}
+	previousKey = SigningKey{Id: "previous", Secret: []byte("pppppppppppppppppppppppppppppppp")}
+)
+
+func fakeSignedTokens(t *testing.T, now time.Time, keys ...SigningKey) *SignedTokens {
+	tokens, err := TestSignedTokens(keys, func() time.Time { return now }, func(prefix string) string { return prefix + "_aaaa" })
+	assert.NoError(t, err)
+	return tokens
+}
+
+func TestSignedTokens_IssueAndVerify(t *testing.T) {
+	now := util.FakeTime(2024, 1, 1).Add(1500 * time.Millisecond)
+	tokens := fakeSignedTokens(t, now, currentKey)
+
+	issued, err := tokens.Issue("usr_aaaa", time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, "usr_aaaa", issued.UserId)
+	assert.Equal(t, util.FakeTime(2024, 1, 1).Add(time.Second).UTC(), issued.IssuedAt)
+	assert.Equal(t, util.FakeTime(2024, 1, 1).Add(time.Second+time.Hour).UTC(), issued.ExpiresAt)
+
+	verified, err := tokens.Verify(issued.Token)
+	assert.NoError(t, err)
+	assert.Equal(t, issued, verified)
+}
+
+func TestSignedTokens_Verify(t *testing.T) {
+	issuedAt := util.FakeTime(2024, 1, 1)
+	issued, err := fakeSignedTokens(t, issuedAt, currentKey).Issue("usr_aaaa", time.Hour)
+	assert.NoError(t, err)
+	segments := strings.Split(issued.Token, ".")
+
+	tests := []struct {
+		name          string
+		token         string
+		now           time.Time
+		keys          []SigningKey
+		expectedError string
+	}{
+		{
+			name:  "Valid token",
+			token: issued.Token,
+			now:   issuedAt.Add(time.Minute),
+			keys:  []SigningKey{currentKey},
+		},
+		{
+			name:  "Token signed with a rotated key",
+			token: issued.Token,
+			now:   issuedAt.Add(time.Minute),
+			keys:  []SigningKey{previousKey, currentKey},
+		},
+		{
+			name:          "Token signed with a removed key",
+			token:         issued.Token,
+			now:           issuedAt.Add(time.Minute),
+			keys:          []SigningKey{previousKey},
+			expectedError: "invalid access token",
+		},
+		{
+			name:          "Token signed with a different secret",
+			token:         issued.Token,
+			now:           issuedAt.Add(time.Minute),
+			keys:          []SigningKey{{Id: currentKey.Id, Secret: previousKey.Secret}},
+			expectedError: "invalid access token",
+		},
+		{
+			name:          "Expired token",
+			token:         issued.Token,
+			now:           issuedAt.Add(time.Hour),
+			keys:          []SigningKey{currentKey},
+			expectedError: "access token expired",
+		},
+		{
+			name:          "Tampered claims",
+			token:         segments[0] + "." + encodeSegment([]byte(`{"sub":"usr_bbbb","iat":1704067200,"exp":1893456000}`)) + "." + segments[2],
+			now:           issuedAt.Add(time.Minute),
+			keys:          []SigningKey{currentKey},
+			expectedError: "invalid access token",
+		},
+		{
+			name:          "Unsigned token",
+			token:         encodeSegment([]byte(`{"alg":"none","kid":"current"}`)) + "." + segments[1] + ".",
+			now:           issuedAt.Add(time.Minute),
+			keys:          []SigningKey{currentKey},
+			expectedError: "invalid access token",
+		},
+		{
+			name:          "Invalid signature encoding",
+			token:         segments[0] + "." + segments[1] + ".!!!!",
+			now:           issuedAt.Add(time.Minute),
+			keys:          []SigningKey{currentKey},
+			expectedError: "invalid access token",
+		},
+		{
+			name:          "Database token",
+			token:         "tkn_aaaaaaaaaaaaaaaaaaaaaa",
+			now:           issuedAt.Add(time.Minute),
+			keys:          []SigningKey{currentKey},
+			expectedError: "invalid access token",
+		},
+		{
+			name:          "Empty token",
+			token:         "",
+			now:           issuedAt.Add(time.Minute),
+			keys:          []SigningKey{currentKey},
+			expectedError: "invalid access token",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			accessToken, err := fakeSignedTokens(t, test.now, test.keys...).Verify(test.token)
+
+			if test.expectedError != "" {
+				assert.EqualError(t, err, test.expectedError)
+				assert.Nil(t, accessToken)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, "usr_aaaa", accessToken.UserId)
+			}
+		})
+	}
+}
+
+func TestSignedTokens_IssueSignsWithFirstKey(t *testing.T) {
+	now := util.FakeTime(2024, 1, 1)
+	issued, err := fakeSignedTokens(t, now, currentKey, previousKey).Issue("usr_aaaa", time.Hour)
+	assert.NoError(t, err)
+
+	header, err := base64.RawURLEncoding.DecodeString(strings.Split(issued.Token, ".")[0])
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"alg":"HS256","typ":"JWT","kid":"current"}`, string(header))
+}
+
+func TestSignedTokens_UniquePerIssue(t *testing.T) {
+	tokens, err := CreateSignedTokens([]SigningKey{currentKey})
+	assert.NoError(t, err)
+
+	first, err := tokens.Issue("usr_aaaa", time.Hour)
+	assert.NoError(t, err)
+	second, err := tokens.Issue("usr_aaaa", time.Hour)
+	assert.NoError(t, err)
+	assert.NotEqual(t, first.Token, second.Token)
+}
+
+func TestCreateSignedTokens(t *testing.T) {
+	tests := []struct {
+		name          string
+		keys          []SigningKey
+		expectedError string
+	}{
+		{
+			name: "Valid keys",
+			keys: []SigningKey{currentKey, previousKey},
+		},
+		{
+			name:          "No keys",
+			keys:          nil,
+			expectedError: "at least one signing key is required",
+		},
+		{
+			name:          "Missing id",
+			keys:          []SigningKey{{Secret: currentKey.Secret}},
+			expectedError: "signing key without id",
+		},
+		{
+			name:          "Short secret",
+			keys:          []SigningKey{{Id: "short", Secret: []byte("secret")}},
+			expectedError: "signing key short must be at least 32 bytes",
+		},
+		{
+			name:          "Duplicate id",
+			keys:          []SigningKey{currentKey, {Id: currentKey.Id, Secret: previousKey.Secret}},
+			expectedError: "duplicate signing key current",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tokens, err := CreateSignedTokens(test.keys)
+
+			if test.expectedError != "" {
+				assert.EqualError(t, err, test.expectedError)
+				assert.Nil(t, tokens)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestParseSigningKeys(t *testing.T) {
+	keys, err := ParseSigningKeys("current:cccccccccccccccccccccccccccccccc, previous:pppp:pppp")
+	assert.NoError(t, err)
+	assert.Equal(t, []SigningKey{
+		{Id: "current", Secret: []byte("cccccccccccccccccccccccccccccccc")},
+		{Id: "previous", Secret: []byte("pppp:pppp")},
+	}, keys)
+
+	_, err = ParseSigningKeys("current:secret,secret")
+	assert.EqualError(t, err, "signing keys must be in the form id:secret")
+}
@@ -0,0 +1,154 @@
+package routes
+
+import (
+	"backend/db"
+	"backend/net"
+	"net/http"
+	"regexp"
+)
+
+// Admin manages the accounts of other users and the ownership of their todo lists. Register its handlers behind
+// net.AdminMiddleware.
+type Admin struct {
+	database db.Database
+}
+
+func CreateAdmin(database db.Database) Admin {
+	return Admin{database: database}
+}
+
+// GetUsers returns every user, sorted by name.
+func (a *Admin) GetUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := a.database.GetUsers()
+	if err != nil {
+		net.HaltInternalServerError(w, r, err)
+		return
+	}
+
+	response := adminUsersResponse{Users: []adminUser{}}
+	for _, user := range *users {
+		response.Users = append(response.Users, toAdminUser(&user))
+	}
+	net.Success(w, response)
+}
+
+// PatchUser disables or enables an account. Disabling also revokes every session of the user.
+func (a *Admin) PatchUser(w http.ResponseWriter, r *http.Request) {
+	body, err := net.ParseBody[adminUserPatchRequest](r)
+	if err != nil {
+		net.HaltError(w, r, err)
+		return
+	}
+
+	user, ok := a.targetUser(w, r)
+	if !ok {
+		return
+	}
+
+	user.Disabled = *body.Disabled
+	updatedUser, err := a.database.UpdateUser(user)
+	if err != nil {
+		net.HaltInternalServerError(w, r, err)
+		return
+	}
+	if updatedUser.Disabled {
+		if err = a.database.DeleteUserTokens(updatedUser.Id); err != nil {
+			net.HaltInternalServerError(w, r, err)
+			return
+		}
+	}
+	net.Logger(r.Context()).Info("Patched user", "target_user_id", updatedUser.Id, "disabled", updatedUser.Disabled)
+
+	net.Success(w, toAdminUser(updatedUser))
+}
+
+// DeleteUser deletes an account and its sessions. Its todo lists must first be transferred to other users.
+func (a *Admin) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := a.targetUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := a.database.DeleteUser(user.Id); err != nil {
+		net.HaltError(w, r, err)
+		return
+	}
+	net.Logger(r.Context()).Info("Deleted user", "target_user_id", user.Id)
+
+	net.NoContent(w)
+}
+
+// RevokeTokens logs a user out on every device, without disabling the account.
+func (a *Admin) RevokeTokens(w http.ResponseWriter, r *http.Request) {
+	userId := r.PathValue("user_id")
+	if !regexp.MustCompile(userIdRegex).MatchString(userId) {
+		net.HaltNotFound(w, "user_not_found", "user not found")
+		return
+	}
+	if _, err := a.database.GetUser(userId); err != nil {
+		net.HaltError(w, r, err)
+		return
+	}
+
+	if err := a.database.DeleteUserTokens(userId); err != nil {
+		net.HaltInternalServerError(w, r, err)
+		return
+	}
+	net.Logger(r.Context()).Info("Revoked tokens", "target_user_id", userId)
+
+	net.NoContent(w)
+}
+
+// TransferTodoList makes another user the owner of a todo list, the previous owner stays a member.
+func (a *Admin) TransferTodoList(w http.ResponseWriter, r *http.Request) {
+	body, err := net.ParseBody[ownerUpdateRequest](r)
+	if err != nil {
+		net.HaltError(w, r, err)
+		return
+	}
+
+	if !regexp.MustCompile(userIdRegex).MatchString(body.UserId) {
+		net.HaltInvalidField(w, "user_id", "invalid user id")
+		return
+	}
+
+	listId := r.PathValue("list_id")
+	if err = a.database.TransferTodoList(listId, body.UserId); err != nil {
+		net.HaltError(w, r, err)
+		return
+	}
+	todoList, err := a.database.GetTodoList(listId)
+	if err != nil {
+		net.HaltInternalServerError(w, r, err)
+		return
+	}
+	net.Logger(r.Context()).Info("Transferred todo list", "todo_list_id", listId, "owner_id", body.UserId)
+
+	net.Success(w, toListResponse(todoList))
+}
+
+// targetUser returns the user in the path, halting the request when it doesn't exist or is the admin sending it, so
+// admins can't lock themselves out.
+func (a *Admin) targetUser(w http.ResponseWriter, r *http.Request) (*db.User, bool) {
+	admin, ok := requestUser(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	userId := r.PathValue("user_id")
+	if !regexp.MustCompile(userIdRegex).MatchString(userId) {
+		net.HaltNotFound(w, "user_not_found", "user not found")
+		return nil, false
+	}
+	if userId == admin.Id {
+		net.HaltForbidden(w, "own_account", "cannot change own account")
+		return nil, false
+	}
+
+	user, err := a.database.GetUser(userId)
+	if err != nil {
+		net.HaltError(w, r, err)
+		return nil, false
+	}
+	return user, true
+}
@@ -0,0 +1,416 @@
+package routes
+
+import (
+	"backend/db"
+	"backend/net"
+	"backend/util"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// adminFixture extends sharedListFixture, fakeUserId is an admin and fakeMemberUserId owns a second todo list.
+func adminFixture() *db.InMemoryDatabase {
+	database := sharedListFixture()
+	database.Users[fakeUserId] = db.User{Id: fakeUserId, Name: "owner", Admin: true}
+	database.RefreshTokens[fakeRefreshToken] = db.RefreshToken{UserId: fakeMemberUserId, Token: fakeRefreshToken, AccessToken: fakeMemberToken, ExpiresAt: util.FakeTime(2030, 1, 1).UTC()}
+	database.TodoLists[fakeTodoListId2] = db.TodoList{Id: fakeTodoListId2, OwnerId: fakeMemberUserId}
+	return database
+}
+
+// asAdmin runs handler behind AuthenticationMiddleware and AdminMiddleware, like the server does.
+func asAdmin(database db.Database, handler http.HandlerFunc) http.Handler {
+	return authenticated(database, net.AdminMiddleware(handler).ServeHTTP)
+}
+
+func TestAdmin_GetUsers(t *testing.T) {
+	tests := []struct {
+		description  string
+		accessToken  string
+		responseCode int
+		responseBody string
+	}{
+		{
+			description:  "Admin",
+			accessToken:  fakeToken,
+			responseCode: http.StatusOK,
+			responseBody: `{"users":[` +
+				`{"id":"usr_cccccccccccccccccccccc","name":"member","admin":false,"disabled":false},` +
+				`{"id":"usr_dddddddddddddddddddddd","name":"outsider","admin":false,"disabled":false},` +
+				`{"id":"usr_aaaaaaaaaaaaaaaaaaaaaa","name":"owner","admin":true,"disabled":false}]}`,
+		},
+		{
+			description:  "Not an admin",
+			accessToken:  fakeMemberToken,
+			responseCode: http.StatusForbidden,
+			responseBody: problem(http.StatusForbidden, "admin_required", "admin role required"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.description, func(t *testing.T) {
+			forEachDatabase(t, adminFixture, func(t *testing.T, database db.Database, contents func() *db.InMemoryDatabase) {
+				admin := CreateAdmin(database)
+
+				request := httptest.NewRequest(http.MethodGet, "/admin/users", nil)
+				request.Header.Set("Authorization", "Bearer "+tt.accessToken)
+				writer := httptest.NewRecorder()
+
+				asAdmin(database, admin.GetUsers).ServeHTTP(writer, request)
+
+				assert.Equal(t, tt.responseCode, writer.Code)
+				assert.Equal(t, tt.responseBody, writer.Body.String())
+			})
+		})
+	}
+}
+
+func TestAdmin_PatchUser(t *testing.T) {
+	tests := []struct {
+		description           string
+		accessToken           string
+		userId                string
+		body                  string
+		responseCode          int
+		responseBody          string
+		databaseUser          db.User
+		databaseTokens        []string
+		databaseRefreshTokens []string
+	}{
+		{
+			description:    "Disable user",
+			accessToken:    fakeToken,
+			userId:         fakeMemberUserId,
+			body:           `{"disabled":true}`,
+			responseCode:   http.StatusOK,
+			responseBody:   `{"id":"usr_cccccccccccccccccccccc","name":"member","admin":false,"disabled":true}`,
+			databaseUser:   db.User{Id: fakeMemberUserId, Name: "member", Disabled: true},
+			databaseTokens: []string{fakeToken, fakeOutsiderToken},
+		},
+		{
+			description:           "Enable user",
+			accessToken:           fakeToken,
+			userId:                fakeMemberUserId,
+			body:                  `{"disabled":false}`,
+			responseCode:          http.StatusOK,
+			responseBody:          `{"id":"usr_cccccccccccccccccccccc","name":"member","admin":false,"disabled":false}`,
+			databaseUser:          db.User{Id: fakeMemberUserId, Name: "member"},
+			databaseTokens:        []string{fakeToken, fakeMemberToken, fakeOutsiderToken},
+			databaseRefreshTokens: []string{fakeRefreshToken},
+		},
+		{
+			description:           "Missing disabled",
+			accessToken:           fakeToken,
+			userId:                fakeMemberUserId,
+			body:                  `{}`,
+			responseCode:          http.StatusUnprocessableEntity,
+			responseBody:          problem(http.StatusUnprocessableEntity, "validation_failed", "validation error", net.InvalidParam{Name: "disabled", Reason: "required"}),
+			databaseUser:          db.User{Id: fakeMemberUserId, Name: "member"},
+			databaseTokens:        []string{fakeToken, fakeMemberToken, fakeOutsiderToken},
+			databaseRefreshTokens: []string{fakeRefreshToken},
+		},
+		{
+			description:           "Own account",
+			accessToken:           fakeToken,
+			userId:                fakeUserId,
+			body:                  `{"disabled":true}`,
+			responseCode:          http.StatusForbidden,
+			responseBody:          problem(http.StatusForbidden, "own_account", "cannot change own account"),
+			databaseUser:          db.User{Id: fakeMemberUserId, Name: "member"},
+			databaseTokens:        []string{fakeToken, fakeMemberToken, fakeOutsiderToken},
+			databaseRefreshTokens: []string{fakeRefreshToken},
+		},
+		{
+			description:           "Invalid user id",
+			accessToken:           fakeToken,
+			userId:                "invalid",
+			body:                  `{"disabled":true}`,
+			responseCode:          http.StatusNotFound,
+			responseBody:          problem(http.StatusNotFound, "user_not_found", "user not found"),
+			databaseUser:          db.User{Id: fakeMemberUserId, Name: "member"},
+			databaseTokens:        []string{fakeToken, fakeMemberToken, fakeOutsiderToken},
+			databaseRefreshTokens: []string{fakeRefreshToken},
+		},
+		{
+			description:           "Unknown user",
+			accessToken:           fakeToken,
+			userId:                fakeWrongUserId,
+			body:                  `{"disabled":true}`,
+			responseCode:          http.StatusNotFound,
+			responseBody:          problem(http.StatusNotFound, "user_not_found", "user not found"),
+			databaseUser:          db.User{Id: fakeMemberUserId, Name: "member"},
+			databaseTokens:        []string{fakeToken, fakeMemberToken, fakeOutsiderToken},
+			databaseRefreshTokens: []string{fakeRefreshToken},
+		},
+		{
+			description:           "Not an admin",
+			accessToken:           fakeOutsiderToken,
+			userId:                fakeMemberUserId,
+			body:                  `{"disabled":true}`,
+			responseCode:          http.StatusForbidden,
+			responseBody:          problem(http.StatusForbidden, "admin_required", "admin role required"),
+			databaseUser:          db.User{Id: fakeMemberUserId, Name: "member"},
+			databaseTokens:        []string{fakeToken, fakeMemberToken, fakeOutsiderToken},
+			databaseRefreshTokens: []string{fakeRefreshToken},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.description, func(t *testing.T) {
+			forEachDatabase(t, adminFixture, func(t *testing.T, database db.Database, contents func() *db.InMemoryDatabase) {
+				admin := CreateAdmin(database)
+
+				request := httptest.NewRequest(http.MethodPatch, "/admin/users", strings.NewReader(tt.body))
+				request.SetPathValue("user_id", tt.userId)
+				request.Header.Set("Authorization", "Bearer "+tt.accessToken)
+				writer := httptest.NewRecorder()
+
+				asAdmin(database, admin.PatchUser).ServeHTTP(writer, request)
+
+				assert.Equal(t, tt.responseCode, writer.Code)
+				assert.Equal(t, tt.responseBody, writer.Body.String())
+				assert.Equal(t, tt.databaseUser, contents().Users[fakeMemberUserId])
+				assertTokens(t, tt.databaseTokens, tt.databaseRefreshTokens, contents())
+			})
+		})
+	}
+}
+
+func TestAdmin_DeleteUser(t *testing.T) {
+	tests := []struct {
+		description   string
+		accessToken   string
+		userId        string
+		responseCode  int
+		responseBody  string
+		databaseUsers []string
+	}{
+		{
+			description:   "Delete user",
+			accessToken:   fakeToken,
+			userId:        fakeOutsiderUserId,
+			responseCode:  http.StatusNoContent,
+			databaseUsers: []string{fakeUserId, fakeMemberUserId},
+		},
+		{
+			description:   "User still owns todo lists",
+			accessToken:   fakeToken,
+			userId:        fakeMemberUserId,
+			responseCode:  http.StatusConflict,
+			responseBody:  problem(http.StatusConflict, "user_owns_todo_lists", "user still owns todo lists"),
+			databaseUsers: []string{fakeUserId, fakeMemberUserId, fakeOutsiderUserId},
+		},
+		{
+			description:   "Own account",
+			accessToken:   fakeToken,
+			userId:        fakeUserId,
+			responseCode:  http.StatusForbidden,
+			responseBody:  problem(http.StatusForbidden, "own_account", "cannot change own account"),
+			databaseUsers: []string{fakeUserId, fakeMemberUserId, fakeOutsiderUserId},
+		},
+		{
+			description:   "Not an admin",
+			accessToken:   fakeMemberToken,
+			userId:        fakeOutsiderUserId,
+			responseCode:  http.StatusForbidden,
+			responseBody:  problem(http.StatusForbidden, "admin_required", "admin role required"),
+			databaseUsers: []string{fakeUserId, fakeMemberUserId, fakeOutsiderUserId},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.description, func(t *testing.T) {
+			forEachDatabase(t, adminFixture, func(t *testing.T, database db.Database, contents func() *db.InMemoryDatabase) {
+				admin := CreateAdmin(database)
+
+				request := httptest.NewRequest(http.MethodDelete, "/admin/users", nil)
+				request.SetPathValue("user_id", tt.userId)
+				request.Header.Set("Authorization", "Bearer "+tt.accessToken)
+				writer := httptest.NewRecorder()
+
+				asAdmin(database, admin.DeleteUser).ServeHTTP(writer, request)
+
+				assert.Equal(t, tt.responseCode, writer.Code)
+				assert.Equal(t, tt.responseBody, writer.Body.String())
+				var users []string
+				for userId := range contents().Users {
+					users = append(users, userId)
+				}
+				assert.ElementsMatch(t, tt.databaseUsers, users)
+			})
+		})
+	}
+}
+
+func TestAdmin_DeleteUserKeepsTodos(t *testing.T) {
+	forEachDatabase(t, func() *db.InMemoryDatabase {
+		database := adminFixture()
+		database.TodoItems[fakeTodoId] = db.TodoItem{Id: fakeTodoId, ListId: fakeTodoListId, Description: "first todo", Status: "todo", UserId: fakeOutsiderUserId, UpdatedAt: util.FakeTime(2024, 1, 1).UTC()}
+		return database
+	}, func(t *testing.T, database db.Database, contents func() *db.InMemoryDatabase) {
+		admin := CreateAdmin(database)
+		todoLists := CreateTodoLists(database)
+
+		request := httptest.NewRequest(http.MethodDelete, "/admin/users", nil)
+		request.SetPathValue("user_id", fakeOutsiderUserId)
+		request.Header.Set("Authorization", "Bearer "+fakeToken)
+		writer := httptest.NewRecorder()
+		asAdmin(database, admin.DeleteUser).ServeHTTP(writer, request)
+		assert.Equal(t, http.StatusNoContent, writer.Code)
+
+		// The todo remains, without the name of who created it
+		request = httptest.NewRequest(http.MethodGet, "/todolists", nil)
+		request.SetPathValue("list_id", fakeTodoListId)
+		request.Header.Set("Authorization", "Bearer "+fakeToken)
+		writer = httptest.NewRecorder()
+		authenticated(database, todoLists.Get).ServeHTTP(writer, request)
+		assert.Equal(t, http.StatusOK, writer.Code)
+		assert.Contains(t, writer.Body.String(), `"todos":[{"id":"tdo_aaaaaaaaaaaaaaaaaaaaaa","created_by":"","description":"first todo"`)
+	})
+}
+
+func TestAdmin_RevokeTokens(t *testing.T) {
+	tests := []struct {
+		description           string
+		accessToken           string
+		userId                string
+		responseCode          int
+		responseBody          string
+		databaseTokens        []string
+		databaseRefreshTokens []string
+	}{
+		{
+			description:    "Revoke tokens",
+			accessToken:    fakeToken,
+			userId:         fakeMemberUserId,
+			responseCode:   http.StatusNoContent,
+			databaseTokens: []string{fakeToken, fakeOutsiderToken},
+		},
+		{
+			description:           "Unknown user",
+			accessToken:           fakeToken,
+			userId:                fakeWrongUserId,
+			responseCode:          http.StatusNotFound,
+			responseBody:          problem(http.StatusNotFound, "user_not_found", "user not found"),
+			databaseTokens:        []string{fakeToken, fakeMemberToken, fakeOutsiderToken},
+			databaseRefreshTokens: []string{fakeRefreshToken},
+		},
+		{
+			description:           "Not an admin",
+			accessToken:           fakeOutsiderToken,
+			userId:                fakeMemberUserId,
+			responseCode:          http.StatusForbidden,
+			responseBody:          problem(http.StatusForbidden, "admin_required", "admin role required"),
+			databaseTokens:        []string{fakeToken, fakeMemberToken, fakeOutsiderToken},
+			databaseRefreshTokens: []string{fakeRefreshToken},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.description, func(t *testing.T) {
+			forEachDatabase(t, adminFixture, func(t *testing.T, database db.Database, contents func() *db.InMemoryDatabase) {
+				admin := CreateAdmin(database)
+
+				request := httptest.NewRequest(http.MethodDelete, "/admin/users/tokens", nil)
+				request.SetPathValue("user_id", tt.userId)
+				request.Header.Set("Authorization", "Bearer "+tt.accessToken)
+				writer := httptest.NewRecorder()
+
+				asAdmin(database, admin.RevokeTokens).ServeHTTP(writer, request)
+
+				assert.Equal(t, tt.responseCode, writer.Code)
+				assert.Equal(t, tt.responseBody, writer.Body.String())
+				assertTokens(t, tt.databaseTokens, tt.databaseRefreshTokens, contents())
+			})
+		})
+	}
+}
+
+func TestAdmin_TransferTodoList(t *testing.T) {
+	tests := []struct {
+		description  string
+		accessToken  string
+		listId       string
+		body         string
+		responseCode int
+		responseBody string
+		databaseList db.TodoList
+	}{
+		{
+			description:  "Transfer to member",
+			accessToken:  fakeToken,
+			listId:       fakeTodoListId,
+			body:         fmt.Sprintf(`{"user_id":"%s"}`, fakeMemberUserId),
+			responseCode: http.StatusOK,
+			responseBody: `{"todo_list_id":"lst_aaaaaaaaaaaaaaaaaaaaaa","title":"","description":"","owner_id":"usr_cccccccccccccccccccccc","created_at":"0001-01-01T00:00:00Z","updated_at":"0001-01-01T00:00:00Z"}`,
+			databaseList: db.TodoList{Id: fakeTodoListId, OwnerId: fakeMemberUserId, MemberIds: []string{fakeUserId}},
+		},
+		{
+			description:  "Transfer to outsider",
+			accessToken:  fakeToken,
+			listId:       fakeTodoListId,
+			body:         fmt.Sprintf(`{"user_id":"%s"}`, fakeOutsiderUserId),
+			responseCode: http.StatusOK,
+			responseBody: `{"todo_list_id":"lst_aaaaaaaaaaaaaaaaaaaaaa","title":"","description":"","owner_id":"usr_dddddddddddddddddddddd","created_at":"0001-01-01T00:00:00Z","updated_at":"0001-01-01T00:00:00Z"}`,
+			databaseList: db.TodoList{Id: fakeTodoListId, OwnerId: fakeOutsiderUserId, MemberIds: []string{fakeMemberUserId, fakeUserId}},
+		},
+		{
+			description:  "Invalid user id",
+			accessToken:  fakeToken,
+			listId:       fakeTodoListId,
+			body:         `{"user_id":"invalid"}`,
+			responseCode: http.StatusUnprocessableEntity,
+			responseBody: invalidField("user_id", "invalid user id"),
+			databaseList: db.TodoList{Id: fakeTodoListId, OwnerId: fakeUserId, MemberIds: []string{fakeMemberUserId}},
+		},
+		{
+			description:  "Unknown user",
+			accessToken:  fakeToken,
+			listId:       fakeTodoListId,
+			body:         fmt.Sprintf(`{"user_id":"%s"}`, fakeWrongUserId),
+			responseCode: http.StatusNotFound,
+			responseBody: problem(http.StatusNotFound, "user_not_found", "user not found"),
+			databaseList: db.TodoList{Id: fakeTodoListId, OwnerId: fakeUserId, MemberIds: []string{fakeMemberUserId}},
+		},
+		{
+			description:  "Unknown todo list",
+			accessToken:  fakeToken,
+			listId:       fakeWrongTodoListId,
+			body:         fmt.Sprintf(`{"user_id":"%s"}`, fakeMemberUserId),
+			responseCode: http.StatusNotFound,
+			responseBody: problem(http.StatusNotFound, "todo_list_not_found", "todo list not found"),
+			databaseList: db.TodoList{Id: fakeTodoListId, OwnerId: fakeUserId, MemberIds: []string{fakeMemberUserId}},
+		},
+		{
+			description:  "Not an admin",
+			accessToken:  fakeMemberToken,
+			listId:       fakeTodoListId,
+			body:         fmt.Sprintf(`{"user_id":"%s"}`, fakeMemberUserId),
+			responseCode: http.StatusForbidden,
+			responseBody: problem(http.StatusForbidden, "admin_required", "admin role required"),
+			databaseList: db.TodoList{Id: fakeTodoListId, OwnerId: fakeUserId, MemberIds: []string{fakeMemberUserId}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.description, func(t *testing.T) {
+			forEachDatabase(t, adminFixture, func(t *testing.T, database db.Database, contents func() *db.InMemoryDatabase) {
+				admin := CreateAdmin(database)
+
+				request := httptest.NewRequest(http.MethodPut, "/admin/todolists/owner", strings.NewReader(tt.body))
+				request.SetPathValue("list_id", tt.listId)
+				request.Header.Set("Authorization", "Bearer "+tt.accessToken)
+				writer := httptest.NewRecorder()
+
+				asAdmin(database, admin.TransferTodoList).ServeHTTP(writer, request)
+
+				assert.Equal(t, tt.responseCode, writer.Code)
+				assert.Equal(t, tt.responseBody, writer.Body.String())
+				assert.Equal(t, tt.databaseList, contents().TodoLists[fakeTodoListId])
+			})
+		})
+	}
+}
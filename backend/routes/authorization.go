@@ -0,0 +1,46 @@
+package routes
+
+import (
+	"backend/db"
+	"backend/net"
+	"net/http"
+)
+
+// requestUser returns the user that sent the request, halting it when the user is missing.
+func requestUser(w http.ResponseWriter, r *http.Request) (*db.User, bool) {
+	// AuthenticationMiddleware already stored the user, this only fails when the route isn't behind it
+	user, ok := net.UserFromContext(r.Context())
+	if !ok {
+		net.HaltUnauthorized(w, "not_authenticated", "not authenticated")
+		return nil, false
+	}
+	return user, true
+}
+
+// authorizeTodoList returns the todo list, halting the request when it doesn't exist or the user isn't a member.
+func authorizeTodoList(w http.ResponseWriter, r *http.Request, database db.Database, listId string, userId string) (*db.TodoList, bool) {
+	todoList, err := database.GetTodoList(listId)
+	if err != nil {
+		net.HaltError(w, r, err)
+		return nil, false
+	}
+	if !todoList.IsMember(userId) {
+		net.HaltForbidden(w, "not_a_member", "not a member of this todo list")
+		return nil, false
+	}
+	return todoList, true
+}
+
+// authorizeTodo returns the todo and its list, halting the request when it doesn't exist or the user isn't a member of its list.
+func authorizeTodo(w http.ResponseWriter, r *http.Request, database db.Database, todoId string, userId string) (*db.TodoItem, *db.TodoList, bool) {
+	item, err := database.GetTodo(todoId)
+	if err != nil {
+		net.HaltError(w, r, err)
+		return nil, nil, false
+	}
+	todoList, ok := authorizeTodoList(w, r, database, item.ListId, userId)
+	if !ok {
+		return nil, nil, false
+	}
+	return item, todoList, true
+}
@@ -0,0 +1,63 @@
+package routes
+
+import (
+	"backend/db"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestUser_FailsClosed(t *testing.T) {
+	forEachDatabase(t, sharedListFixture, func(t *testing.T, database db.Database, contents func() *db.InMemoryDatabase) {
+		todoLists := CreateTodoLists(database)
+		todos := CreateTodos(database)
+		users := CreateUsers(database, nil, fakeAccessTokenLifetime, fakeRefreshTokenLifetime)
+		// Every body is valid, so only the missing user halts the request
+		tests := []struct {
+			name    string
+			handler http.HandlerFunc
+			body    string
+		}{
+			{name: "create todo list", handler: todoLists.Create, body: `{"title":"new list"}`},
+			{name: "get todo lists", handler: todoLists.GetAll},
+			{name: "get todo list", handler: todoLists.Get},
+			{name: "patch todo list", handler: todoLists.Patch, body: `{"title":"new title"}`},
+			{name: "delete todo list", handler: todoLists.Delete},
+			{name: "get workflow", handler: todoLists.GetWorkflow},
+			{name: "update workflow", handler: todoLists.UpdateWorkflow, body: `{"statuses":["todo","done"],"transitions":{"todo":["done"]}}`},
+			{name: "get members", handler: todoLists.GetMembers},
+			{name: "add member", handler: todoLists.AddMember, body: fmt.Sprintf(`{"user_id":"%s"}`, fakeOutsiderUserId)},
+			{name: "remove member", handler: todoLists.RemoveMember},
+			{name: "create todo", handler: todos.Create, body: fmt.Sprintf(`{"description":"new todo","todo_list_id":"%s"}`, fakeTodoListId)},
+			{name: "update todo", handler: todos.Update, body: `{"status":"ongoing"}`},
+			{name: "patch todo", handler: todos.Patch, body: `{"description":"new description"}`},
+			{name: "delete todo", handler: todos.Delete},
+			{name: "logout", handler: users.Logout},
+			{name: "logout all", handler: users.LogoutAll},
+		}
+		before := contents()
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				// A valid token, but the handler isn't behind AuthenticationMiddleware
+				request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+				request.Header.Set("Authorization", fakeToken)
+				request.SetPathValue("list_id", fakeTodoListId)
+				request.SetPathValue("todo_id", fakeTodoId)
+				writer := httptest.NewRecorder()
+
+				tt.handler(writer, request)
+
+				assert.Equal(t, http.StatusUnauthorized, writer.Code)
+				assert.Equal(t, problem(http.StatusUnauthorized, "not_authenticated", "not authenticated"), writer.Body.String())
+				after := contents()
+				assert.Equal(t, before.AccessTokens, after.AccessTokens)
+				assert.Equal(t, before.TodoLists, after.TodoLists)
+				assert.Equal(t, before.TodoItems, after.TodoItems)
+			})
+		}
+	})
+}
@@ -1,6 +1,15 @@
 package routes
 
 const userNameRegex = `^[a-zA-Z0-9 ]{3,32}$`
+
+// bcrypt ignores everything after the first 72 bytes
+const minPasswordLength = 8
+const maxPasswordLength = 72
+
 const userIdRegex = `^usr_[23456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz]{22}$`
 
+const listTitleRegex = `^[a-zA-Z0-9 ]{1,64}$`
+const listDescriptionRegex = `^[a-zA-Z0-9 ]{0,256}$`
+
 const todoDescriptionRegex = `^[a-zA-Z0-9 ]{1,256}$`
+const statusRegex = `^[a-z0-9 ]{1,32}$`
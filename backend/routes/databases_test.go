@@ -0,0 +1,93 @@
+package routes
+
+import (
+	"backend/db"
+	"backend/net"
+	"backend/util"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+type databaseFixture func() *db.InMemoryDatabase
+type databaseTest func(t *testing.T, database db.Database, contents func() *db.InMemoryDatabase)
+
+// forEachDatabase runs test against every db.Database implementation, each seeded with a fresh fixture.
+// Tests assert on the stored data through contents, which works regardless of the implementation.
+func forEachDatabase(t *testing.T, fixture databaseFixture, test databaseTest) {
+	t.Run("in memory", func(t *testing.T) {
+		database := fixture()
+		test(t, database, func() *db.InMemoryDatabase { return database })
+	})
+
+	t.Run("sqlite", func(t *testing.T) {
+		database, err := db.TestSqliteDatabase(fixture())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = database.Close() })
+
+		test(t, database, func() *db.InMemoryDatabase {
+			contents, err := database.Dump()
+			if err != nil {
+				t.Fatal(err)
+			}
+			return contents
+		})
+	})
+}
+
+// sharedListFixture contains a todo list with a single todo, owned by fakeUserId and shared with fakeMemberUserId.
+// fakeOutsiderUserId has a valid token, but isn't a member.
+func sharedListFixture() *db.InMemoryDatabase {
+	database := db.TestDatabase(
+		func() time.Time { return util.FakeTime(2024, 6, 30) },
+		func(string) string { return "static_uuid" },
+	)
+	database.Users[fakeUserId] = db.User{Id: fakeUserId, Name: "owner"}
+	database.Users[fakeMemberUserId] = db.User{Id: fakeMemberUserId, Name: "member"}
+	database.Users[fakeOutsiderUserId] = db.User{Id: fakeOutsiderUserId, Name: "outsider"}
+	database.AccessTokens[fakeToken] = db.AccessToken{UserId: fakeUserId, Token: fakeToken, ExpiresAt: util.FakeTime(2030, 1, 1).UTC()}
+	database.AccessTokens[fakeMemberToken] = db.AccessToken{UserId: fakeMemberUserId, Token: fakeMemberToken, ExpiresAt: util.FakeTime(2030, 1, 1).UTC()}
+	database.AccessTokens[fakeOutsiderToken] = db.AccessToken{UserId: fakeOutsiderUserId, Token: fakeOutsiderToken, ExpiresAt: util.FakeTime(2030, 1, 1).UTC()}
+	database.TodoLists[fakeTodoListId] = db.TodoList{Id: fakeTodoListId, OwnerId: fakeUserId, MemberIds: []string{fakeMemberUserId}}
+	database.TodoItems[fakeTodoId] = db.TodoItem{Id: fakeTodoId, ListId: fakeTodoListId, Description: "first todo", Status: "todo", UserId: fakeUserId, UpdatedAt: util.FakeTime(2024, 1, 1).UTC()}
+	database.TodoItemOrder = []string{fakeTodoId}
+	return database
+}
+
+// customWorkflow starts todos in the backlog, and lets them go straight from todo to done.
+func customWorkflow() *db.Workflow {
+	return &db.Workflow{
+		Statuses: []string{"backlog", "todo", "blocked", "done"},
+		Transitions: map[string][]string{
+			"backlog": {"todo"},
+			"todo":    {"blocked", "done"},
+			"blocked": {"todo"},
+		},
+	}
+}
+
+// authenticated runs handler behind AuthenticationMiddleware, like the server does.
+func authenticated(database db.Database, handler http.HandlerFunc) http.Handler {
+	return net.AuthenticationMiddleware(handler, net.CreateDatabaseTokens(database), database, false)
+}
+
+// problem returns the body of an error response, which every handler halts with through the net package.
+func problem(status int, code string, detail string, invalidParams ...net.InvalidParam) string {
+	body, _ := json.Marshal(net.Problem{
+		Type:          "about:blank",
+		Title:         http.StatusText(status),
+		Status:        status,
+		Detail:        detail,
+		Code:          code,
+		InvalidParams: invalidParams,
+	})
+	return string(body)
+}
+
+// invalidField returns the body of a validation error of a single field.
+func invalidField(field string, detail string) string {
+	return problem(http.StatusUnprocessableEntity, "validation_failed", detail, net.InvalidParam{Name: field, Reason: detail})
+}
@@ -3,17 +3,102 @@ package routes
 import (
 	"backend/db"
 	"backend/net"
+	"cmp"
 	"net/http"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
 )
 
+// Debug exposes the whole database and the state of the process. Only register it in debug mode, behind
+// net.AdminMiddleware.
 type Debug struct {
-	database *db.Database
+	database  db.Database
+	startedAt time.Time
 }
 
-func CreateDebug(database *db.Database) Debug {
-	return Debug{database: database}
+func CreateDebug(database db.Database, startedAt time.Time) Debug {
+	return Debug{database: database, startedAt: startedAt}
 }
 
-func (u *Debug) Debug(w http.ResponseWriter, _ *http.Request) {
-	net.Success(w, u.database)
+func (d *Debug) Debug(w http.ResponseWriter, r *http.Request) {
+	stats, err := d.database.Stats()
+	if err != nil {
+		net.HaltInternalServerError(w, r, err)
+		return
+	}
+	dump, err := d.database.Dump()
+	if err != nil {
+		net.HaltInternalServerError(w, r, err)
+		return
+	}
+
+	var memory runtime.MemStats
+	runtime.ReadMemStats(&memory)
+
+	net.Success(w, debugResponse{
+		Uptime:     time.Since(d.startedAt).Round(time.Second).String(),
+		Goroutines: runtime.NumGoroutine(),
+		Memory: debugMemory{
+			AllocBytes:      memory.Alloc,
+			TotalAllocBytes: memory.TotalAlloc,
+			SysBytes:        memory.Sys,
+			HeapObjects:     memory.HeapObjects,
+			GcCycles:        memory.NumGC,
+		},
+		Counts: debugCounts{
+			Users:         stats.Users,
+			TodoLists:     stats.TodoLists,
+			TodosByStatus: stats.TodosByStatus,
+			AccessTokens:  stats.AccessTokens,
+			RefreshTokens: stats.RefreshTokens,
+		},
+		Database: toDebugDatabase(dump),
+	})
+}
+
+// toDebugDatabase redacts the tokens and password hashes, and sorts everything so the output is stable.
+func toDebugDatabase(dump *db.InMemoryDatabase) debugDatabase {
+	database := debugDatabase{
+		Users:         []db.User{},
+		AccessTokens:  []db.AccessToken{},
+		RefreshTokens: []db.RefreshToken{},
+		TodoLists:     []db.TodoList{},
+		TodoItems:     []db.TodoItem{},
+	}
+	for _, user := range dump.Users {
+		if user.PasswordHash != "" {
+			user.PasswordHash = net.Redacted
+		}
+		database.Users = append(database.Users, user)
+	}
+	for _, accessToken := range dump.AccessTokens {
+		accessToken.Token = net.Redacted
+		database.AccessTokens = append(database.AccessTokens, accessToken)
+	}
+	for _, refreshToken := range dump.RefreshTokens {
+		refreshToken.Token = net.Redacted
+		refreshToken.AccessToken = net.Redacted
+		database.RefreshTokens = append(database.RefreshTokens, refreshToken)
+	}
+	for _, todoList := range dump.TodoLists {
+		database.TodoLists = append(database.TodoLists, todoList)
+	}
+	for _, todoId := range dump.TodoItemOrder {
+		if item, exists := dump.TodoItems[todoId]; exists {
+			database.TodoItems = append(database.TodoItems, item)
+		}
+	}
+
+	slices.SortFunc(database.Users, func(a, b db.User) int { return strings.Compare(a.Id, b.Id) })
+	// The tokens are redacted, so they can't be sorted by token
+	slices.SortFunc(database.AccessTokens, func(a, b db.AccessToken) int {
+		return cmp.Or(strings.Compare(a.UserId, b.UserId), a.IssuedAt.Compare(b.IssuedAt))
+	})
+	slices.SortFunc(database.RefreshTokens, func(a, b db.RefreshToken) int {
+		return cmp.Or(strings.Compare(a.UserId, b.UserId), a.IssuedAt.Compare(b.IssuedAt))
+	})
+	slices.SortFunc(database.TodoLists, func(a, b db.TodoList) int { return strings.Compare(a.Id, b.Id) })
+	return database
 }
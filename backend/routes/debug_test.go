@@ -0,0 +1,101 @@
+package routes
+
+import (
+	"backend/db"
+	"backend/net"
+	"backend/util"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func debugFixture() *db.InMemoryDatabase {
+	database := sharedListFixture()
+	database.Users[fakeUserId] = db.User{Id: fakeUserId, Name: "owner", PasswordHash: "$2a$10$hash", Admin: true}
+	database.RefreshTokens[fakeRefreshToken] = db.RefreshToken{UserId: fakeUserId, Token: fakeRefreshToken, AccessToken: fakeToken, ExpiresAt: util.FakeTime(2030, 1, 1).UTC()}
+	return database
+}
+
+func TestDebug(t *testing.T) {
+	tests := []struct {
+		name           string
+		accessToken    string
+		expectedStatus int
+		expectedError  string
+	}{
+		{
+			name:           "Admin",
+			accessToken:    fakeToken,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Not an admin",
+			accessToken:    fakeMemberToken,
+			expectedStatus: http.StatusForbidden,
+			expectedError:  problem(http.StatusForbidden, "admin_required", "admin role required"),
+		},
+		{
+			name:           "Not authenticated",
+			accessToken:    "",
+			expectedStatus: http.StatusUnauthorized,
+			expectedError:  problem(http.StatusUnauthorized, "missing_token", "missing access token"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forEachDatabase(t, debugFixture, func(t *testing.T, database db.Database, contents func() *db.InMemoryDatabase) {
+				debug := CreateDebug(database, util.GetCurrentTime())
+				request := httptest.NewRequest(http.MethodGet, "/debug", nil)
+				if tt.accessToken != "" {
+					request.Header.Set("Authorization", "Bearer "+tt.accessToken)
+				}
+				writer := httptest.NewRecorder()
+
+				authenticated(database, net.AdminMiddleware(http.HandlerFunc(debug.Debug)).ServeHTTP).ServeHTTP(writer, request)
+
+				assert.Equal(t, tt.expectedStatus, writer.Code)
+				if tt.expectedError != "" {
+					assert.JSONEq(t, tt.expectedError, writer.Body.String())
+					return
+				}
+
+				// Nothing that can be used to log in may leave the server
+				for _, secret := range []string{fakeToken, fakeMemberToken, fakeOutsiderToken, fakeRefreshToken, "$2a$10$hash"} {
+					assert.NotContains(t, writer.Body.String(), secret)
+				}
+
+				var response debugResponse
+				assert.NoError(t, json.Unmarshal(writer.Body.Bytes(), &response))
+				assert.NotEmpty(t, response.Uptime)
+				assert.Positive(t, response.Goroutines)
+				assert.Positive(t, response.Memory.AllocBytes)
+				assert.Equal(t, debugCounts{
+					Users:         3,
+					TodoLists:     1,
+					TodosByStatus: map[string]int{"todo": 1},
+					AccessTokens:  3,
+					RefreshTokens: 1,
+				}, response.Counts)
+
+				assert.Equal(t, []string{fakeUserId, fakeMemberUserId, fakeOutsiderUserId}, userIds(response.Database.Users))
+				assert.Equal(t, net.Redacted, response.Database.Users[0].PasswordHash)
+				assert.Len(t, response.Database.AccessTokens, 3)
+				assert.Equal(t, net.Redacted, response.Database.AccessTokens[0].Token)
+				assert.Equal(t, []db.RefreshToken{{UserId: fakeUserId, Token: net.Redacted, AccessToken: net.Redacted, ExpiresAt: util.FakeTime(2030, 1, 1).UTC()}}, response.Database.RefreshTokens)
+				assert.Equal(t, fakeTodoListId, response.Database.TodoLists[0].Id)
+				assert.Equal(t, fakeTodoId, response.Database.TodoItems[0].Id)
+			})
+		})
+	}
+}
+
+func userIds(users []db.User) []string {
+	var ids []string
+	for _, user := range users {
+		ids = append(ids, user.Id)
+	}
+	return ids
+}
@@ -6,7 +6,8 @@ import (
 )
 
 type registerRequest struct {
-	Name string `json:"name" validate:"required"`
+	Name     string `json:"name" validate:"required"`
+	Password string `json:"password" validate:"required"`
 }
 
 type registerResponse struct {
@@ -14,23 +15,81 @@ type registerResponse struct {
 }
 
 type loginRequest struct {
-	UserId string `json:"user_id" validate:"required"`
+	Name     string `json:"name" validate:"required"`
+	Password string `json:"password" validate:"required"`
 }
 
 type loginResponse struct {
-	AccessToken string `json:"access_token"`
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresAt    string `json:"expires_at"`
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
 }
 
 type listCreateRequest struct {
+	Title       string `json:"title" validate:"required"`
+	Description string `json:"description"`
 }
 
 type listCreateResponse struct {
 	TodoListId string `json:"todo_list_id"`
 }
 
+// Fields that are left out are not changed
+type listPatchRequest struct {
+	Title       *string `json:"title" validate:"required_without=Description"`
+	Description *string `json:"description" validate:"required_without=Title"`
+}
+
+type listResponse struct {
+	ListId      string `json:"todo_list_id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	OwnerId     string `json:"owner_id"`
+	CreatedAt   string `json:"created_at"`
+	UpdatedAt   string `json:"updated_at"`
+}
+
 type listGetResponse struct {
-	ListId string     `json:"todo_list_id"`
-	Todos  []todoItem `json:"todos"`
+	listResponse
+	Todos []todoItem `json:"todos"`
+}
+
+type listsGetResponse struct {
+	TodoLists []listSummary `json:"todo_lists"`
+}
+
+type listSummary struct {
+	ListId       string         `json:"todo_list_id"`
+	Title        string         `json:"title"`
+	OwnerId      string         `json:"owner_id"`
+	TodoCount    int            `json:"todo_count"`
+	StatusCounts map[string]int `json:"status_counts"`
+}
+
+type memberAddRequest struct {
+	UserId string `json:"user_id" validate:"required"`
+}
+
+type membersResponse struct {
+	ListId    string   `json:"todo_list_id"`
+	OwnerId   string   `json:"owner_id"`
+	MemberIds []string `json:"member_ids"`
+}
+
+type workflowRequest struct {
+	Statuses    []string            `json:"statuses" validate:"required,min=1,max=16"`
+	Transitions map[string][]string `json:"transitions" validate:"required"`
+}
+
+type workflowResponse struct {
+	ListId        string              `json:"todo_list_id"`
+	InitialStatus string              `json:"initial_status"`
+	Statuses      []string            `json:"statuses"`
+	Transitions   map[string][]string `json:"transitions"`
 }
 
 type todoCreateRequest struct {
@@ -42,6 +101,12 @@ type todoUpdateRequest struct {
 	Status string `json:"status" validate:"required"`
 }
 
+// Fields that are left out are not changed
+type todoPatchRequest struct {
+	Description *string `json:"description" validate:"required_without=Status"`
+	Status      *string `json:"status" validate:"required_without=Description"`
+}
+
 type todoItem struct {
 	Id          string `json:"id"`
 	CreatedBy   string `json:"created_by"`
@@ -50,12 +115,109 @@ type todoItem struct {
 	UpdatedAt   string `json:"updated_at"`
 }
 
+// toTodoItem leaves CreatedBy empty when the user that created the todo was deleted.
 func toTodoItem(todo *db.TodoItem, user *db.User) *todoItem {
+	var createdBy string
+	if user != nil {
+		createdBy = user.Name
+	}
 	return &todoItem{
 		Id:          todo.Id,
-		CreatedBy:   user.Name,
+		CreatedBy:   createdBy,
 		Description: todo.Description,
 		Status:      todo.Status,
 		UpdatedAt:   todo.UpdatedAt.Format(time.RFC3339),
 	}
 }
+
+func toListResponse(todoList *db.TodoList) listResponse {
+	return listResponse{
+		ListId:      todoList.Id,
+		Title:       todoList.Title,
+		Description: todoList.Description,
+		OwnerId:     todoList.OwnerId,
+		CreatedAt:   todoList.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:   todoList.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+func toMembersResponse(todoList *db.TodoList) membersResponse {
+	memberIds := []string{}
+	memberIds = append(memberIds, todoList.MemberIds...)
+	return membersResponse{
+		ListId:    todoList.Id,
+		OwnerId:   todoList.OwnerId,
+		MemberIds: memberIds,
+	}
+}
+
+// toWorkflowResponse lists the transitions of every status, even when there are none.
+func toWorkflowResponse(todoList *db.TodoList) workflowResponse {
+	workflow := todoList.StatusWorkflow()
+	transitions := map[string][]string{}
+	for _, status := range workflow.Statuses {
+		transitions[status] = append([]string{}, workflow.Transitions[status]...)
+	}
+	return workflowResponse{
+		ListId:        todoList.Id,
+		InitialStatus: workflow.InitialStatus(),
+		Statuses:      workflow.Statuses,
+		Transitions:   transitions,
+	}
+}
+
+type adminUsersResponse struct {
+	Users []adminUser `json:"users"`
+}
+
+type adminUser struct {
+	Id       string `json:"id"`
+	Name     string `json:"name"`
+	Admin    bool   `json:"admin"`
+	Disabled bool   `json:"disabled"`
+}
+
+type adminUserPatchRequest struct {
+	Disabled *bool `json:"disabled" validate:"required"`
+}
+
+type ownerUpdateRequest struct {
+	UserId string `json:"user_id" validate:"required"`
+}
+
+func toAdminUser(user *db.User) adminUser {
+	return adminUser{Id: user.Id, Name: user.Name, Admin: user.Admin, Disabled: user.Disabled}
+}
+
+type debugResponse struct {
+	Uptime     string        `json:"uptime"`
+	Goroutines int           `json:"goroutines"`
+	Memory     debugMemory   `json:"memory"`
+	Counts     debugCounts   `json:"counts"`
+	Database   debugDatabase `json:"database"`
+}
+
+type debugMemory struct {
+	AllocBytes      uint64 `json:"alloc_bytes"`
+	TotalAllocBytes uint64 `json:"total_alloc_bytes"`
+	SysBytes        uint64 `json:"sys_bytes"`
+	HeapObjects     uint64 `json:"heap_objects"`
+	GcCycles        uint32 `json:"gc_cycles"`
+}
+
+type debugCounts struct {
+	Users         int            `json:"users"`
+	TodoLists     int            `json:"todo_lists"`
+	TodosByStatus map[string]int `json:"todos_by_status"`
+	AccessTokens  int            `json:"access_tokens"`
+	RefreshTokens int            `json:"refresh_tokens"`
+}
+
+// debugDatabase has the same fields as the database, but lists instead of maps as the tokens are redacted
+type debugDatabase struct {
+	Users         []db.User
+	AccessTokens  []db.AccessToken
+	RefreshTokens []db.RefreshToken
+	TodoLists     []db.TodoList
+	TodoItems     []db.TodoItem
+}
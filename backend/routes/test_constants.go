@@ -1,12 +1,25 @@
 package routes
 
+import "time"
+
 const fakeToken = "tkn_aaaaaaaaaaaaaaaaaaaaaa"
 const fakeWrongToken = "tkn_bbbbbbbbbbbbbbbbbbbbbb"
+const fakeOtherSessionToken = "tkn_eeeeeeeeeeeeeeeeeeeeee"
+const fakeRefreshToken = "rtk_aaaaaaaaaaaaaaaaaaaaaa"
+const fakeExpiredRefreshToken = "rtk_bbbbbbbbbbbbbbbbbbbbbb"
 
 const fakeUserId = "usr_aaaaaaaaaaaaaaaaaaaaaa"
 const fakeWrongUserId = "usr_bbbbbbbbbbbbbbbbbbbbbb"
+const fakePassword = "correct horse"
+const fakeAccessTokenLifetime = time.Hour
+const fakeRefreshTokenLifetime = 30 * 24 * time.Hour
 const fakeTodoListId = "lst_aaaaaaaaaaaaaaaaaaaaaa"
 const fakeWrongTodoListId = "lst_bbbbbbbbbbbbbbbbbbbbbb"
 const fakeTodoListId2 = "lst_cccccccccccccccccccccc"
 const fakeTodoId = "tdo_aaaaaaaaaaaaaaaaaaaaaa"
 const fakeWrongTodoId = "tdo_bbbbbbbbbbbbbbbbbbbbbb"
+
+const fakeMemberToken = "tkn_cccccccccccccccccccccc"
+const fakeMemberUserId = "usr_cccccccccccccccccccccc"
+const fakeOutsiderToken = "tkn_dddddddddddddddddddddd"
+const fakeOutsiderUserId = "usr_dddddddddddddddddddddd"
@@ -5,6 +5,7 @@ import (
 	"backend/net"
 	"fmt"
 	"net/http"
+	"regexp"
 )
 
 type TodoLists struct {
@@ -16,34 +17,318 @@ func CreateTodoLists(database db.Database) TodoLists {
 }
 
 func (t *TodoLists) Create(w http.ResponseWriter, r *http.Request) {
-	_, err := net.ParseBody[listCreateRequest](r)
+	body, err := net.ParseBody[listCreateRequest](r)
 	if err != nil {
-		net.HaltBadRequest(w, err.Error())
+		net.HaltError(w, r, err)
 		return
 	}
 
-	todoList := t.database.CreateTodoList()
-	fmt.Printf("Created todo list %s\n", todoList.Id)
+	if !regexp.MustCompile(listTitleRegex).MatchString(body.Title) {
+		net.HaltInvalidField(w, "title", "title not valid")
+		return
+	}
+	if !regexp.MustCompile(listDescriptionRegex).MatchString(body.Description) {
+		net.HaltInvalidField(w, "description", "description not valid")
+		return
+	}
+
+	user, ok := requestUser(w, r)
+	if !ok {
+		return
+	}
+
+	todoList, err := t.database.CreateTodoList(user.Id, body.Title, body.Description)
+	if err != nil {
+		net.HaltInternalServerError(w, r, err)
+		return
+	}
+	net.Logger(r.Context()).Info("Created todo list", "todo_list_id", todoList.Id)
 
 	net.Success(w, listCreateResponse{TodoListId: todoList.Id})
 }
 
 func (t *TodoLists) Get(w http.ResponseWriter, r *http.Request) {
+	user, ok := requestUser(w, r)
+	if !ok {
+		return
+	}
+
 	listId := r.PathValue("list_id")
+	todoList, ok := authorizeTodoList(w, r, t.database, listId, user.Id)
+	if !ok {
+		return
+	}
 
 	todos, err := t.database.GetTodos(listId)
 	if err != nil {
-		net.HaltBadRequest(w, err.Error())
+		net.HaltError(w, r, err)
 		return
 	}
 
 	formattedTodos := []todoItem{}
 	for _, todo := range *todos {
 		// Ignoring the error, as a real database would handle this using foreign keys
-		user, _ := t.database.GetUser(todo.UserId)
-		formattedTodos = append(formattedTodos, *toTodoItem(&todo, user))
+		creator, _ := t.database.GetUser(todo.UserId)
+		formattedTodos = append(formattedTodos, *toTodoItem(&todo, creator))
+	}
+	net.Logger(r.Context()).Debug("Get todo list", "todo_list_id", listId)
+
+	net.Success(w, listGetResponse{listResponse: toListResponse(todoList), Todos: formattedTodos})
+}
+
+// Patch lets every member rename the todo list or change its description.
+func (t *TodoLists) Patch(w http.ResponseWriter, r *http.Request) {
+	body, err := net.ParseBody[listPatchRequest](r)
+	if err != nil {
+		net.HaltError(w, r, err)
+		return
+	}
+
+	if body.Title != nil && !regexp.MustCompile(listTitleRegex).MatchString(*body.Title) {
+		net.HaltInvalidField(w, "title", "title not valid")
+		return
+	}
+	if body.Description != nil && !regexp.MustCompile(listDescriptionRegex).MatchString(*body.Description) {
+		net.HaltInvalidField(w, "description", "description not valid")
+		return
+	}
+
+	user, ok := requestUser(w, r)
+	if !ok {
+		return
+	}
+
+	todoList, ok := authorizeTodoList(w, r, t.database, r.PathValue("list_id"), user.Id)
+	if !ok {
+		return
+	}
+
+	if body.Title != nil {
+		todoList.Title = *body.Title
+	}
+	if body.Description != nil {
+		todoList.Description = *body.Description
+	}
+
+	updatedList, err := t.database.UpdateTodoList(todoList)
+	if err != nil {
+		net.HaltInternalServerError(w, r, err)
+		return
+	}
+	net.Logger(r.Context()).Info("Patched todo list", "todo_list_id", todoList.Id)
+
+	net.Success(w, toListResponse(updatedList))
+}
+
+// GetAll returns every todo list the user owns or is a member of.
+func (t *TodoLists) GetAll(w http.ResponseWriter, r *http.Request) {
+	user, ok := requestUser(w, r)
+	if !ok {
+		return
+	}
+
+	todoLists, err := t.database.GetTodoLists(user.Id)
+	if err != nil {
+		net.HaltInternalServerError(w, r, err)
+		return
+	}
+
+	summaries := []listSummary{}
+	for _, todoList := range *todoLists {
+		todos, err := t.database.GetTodos(todoList.Id)
+		if err != nil {
+			net.HaltInternalServerError(w, r, err)
+			return
+		}
+
+		summary := listSummary{ListId: todoList.Id, Title: todoList.Title, OwnerId: todoList.OwnerId, StatusCounts: map[string]int{}}
+		for _, todo := range *todos {
+			summary.TodoCount++
+			summary.StatusCounts[todo.Status]++
+		}
+		summaries = append(summaries, summary)
+	}
+
+	net.Success(w, listsGetResponse{TodoLists: summaries})
+}
+
+func (t *TodoLists) Delete(w http.ResponseWriter, r *http.Request) {
+	user, ok := requestUser(w, r)
+	if !ok {
+		return
+	}
+
+	todoList, ok := authorizeTodoList(w, r, t.database, r.PathValue("list_id"), user.Id)
+	if !ok {
+		return
+	}
+	if todoList.OwnerId != user.Id {
+		net.HaltForbidden(w, "owner_only", "only the owner can delete a todo list")
+		return
+	}
+
+	err := t.database.DeleteTodoList(todoList.Id)
+	if err != nil {
+		net.HaltInternalServerError(w, r, err)
+		return
+	}
+	net.Logger(r.Context()).Info("Deleted todo list", "todo_list_id", todoList.Id)
+
+	net.NoContent(w)
+}
+
+func (t *TodoLists) GetMembers(w http.ResponseWriter, r *http.Request) {
+	user, ok := requestUser(w, r)
+	if !ok {
+		return
+	}
+
+	todoList, ok := authorizeTodoList(w, r, t.database, r.PathValue("list_id"), user.Id)
+	if !ok {
+		return
+	}
+
+	net.Success(w, toMembersResponse(todoList))
+}
+
+// AddMember lets every member invite other users to the todo list.
+func (t *TodoLists) AddMember(w http.ResponseWriter, r *http.Request) {
+	body, err := net.ParseBody[memberAddRequest](r)
+	if err != nil {
+		net.HaltError(w, r, err)
+		return
+	}
+
+	if !regexp.MustCompile(userIdRegex).MatchString(body.UserId) {
+		net.HaltInvalidField(w, "user_id", "invalid user id")
+		return
+	}
+
+	user, ok := requestUser(w, r)
+	if !ok {
+		return
+	}
+
+	todoList, ok := authorizeTodoList(w, r, t.database, r.PathValue("list_id"), user.Id)
+	if !ok {
+		return
+	}
+
+	if _, err = t.database.GetUser(body.UserId); err != nil {
+		net.HaltError(w, r, err)
+		return
+	}
+
+	if !todoList.IsMember(body.UserId) {
+		if err = t.database.AddTodoListMember(todoList.Id, body.UserId); err != nil {
+			net.HaltInternalServerError(w, r, err)
+			return
+		}
+		todoList.MemberIds = append(todoList.MemberIds, body.UserId)
+		net.Logger(r.Context()).Info("Added member", "member_id", body.UserId, "todo_list_id", todoList.Id)
+	}
+
+	net.Success(w, toMembersResponse(todoList))
+}
+
+// RemoveMember lets the owner remove any member, while other members can only remove themselves.
+func (t *TodoLists) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	user, ok := requestUser(w, r)
+	if !ok {
+		return
+	}
+
+	todoList, ok := authorizeTodoList(w, r, t.database, r.PathValue("list_id"), user.Id)
+	if !ok {
+		return
+	}
+
+	memberId := r.PathValue("user_id")
+	if memberId == todoList.OwnerId {
+		net.HaltConflict(w, "owner_not_removable", "the owner can't be removed")
+		return
+	}
+	if user.Id != todoList.OwnerId && user.Id != memberId {
+		net.HaltForbidden(w, "owner_only", "only the owner can remove other members")
+		return
+	}
+
+	if err := t.database.RemoveTodoListMember(todoList.Id, memberId); err != nil {
+		net.HaltError(w, r, err)
+		return
+	}
+	net.Logger(r.Context()).Info("Removed member", "member_id", memberId, "todo_list_id", todoList.Id)
+
+	net.NoContent(w)
+}
+
+func (t *TodoLists) GetWorkflow(w http.ResponseWriter, r *http.Request) {
+	user, ok := requestUser(w, r)
+	if !ok {
+		return
+	}
+
+	todoList, ok := authorizeTodoList(w, r, t.database, r.PathValue("list_id"), user.Id)
+	if !ok {
+		return
+	}
+
+	net.Success(w, toWorkflowResponse(todoList))
+}
+
+// UpdateWorkflow lets the owner replace the workflow, as long as no todo is left in a status that gets removed.
+func (t *TodoLists) UpdateWorkflow(w http.ResponseWriter, r *http.Request) {
+	body, err := net.ParseBody[workflowRequest](r)
+	if err != nil {
+		net.HaltError(w, r, err)
+		return
+	}
+
+	for _, status := range body.Statuses {
+		if !regexp.MustCompile(statusRegex).MatchString(status) {
+			net.HaltInvalidField(w, "statuses", "status not valid")
+			return
+		}
+	}
+	workflow := &db.Workflow{Statuses: body.Statuses, Transitions: body.Transitions}
+	if err = workflow.Validate(); err != nil {
+		net.HaltError(w, r, err)
+		return
+	}
+
+	user, ok := requestUser(w, r)
+	if !ok {
+		return
+	}
+
+	todoList, ok := authorizeTodoList(w, r, t.database, r.PathValue("list_id"), user.Id)
+	if !ok {
+		return
+	}
+	if todoList.OwnerId != user.Id {
+		net.HaltForbidden(w, "owner_only", "only the owner can change the workflow")
+		return
+	}
+
+	todos, err := t.database.GetTodos(todoList.Id)
+	if err != nil {
+		net.HaltInternalServerError(w, r, err)
+		return
+	}
+	for _, todo := range *todos {
+		if !workflow.HasStatus(todo.Status) {
+			net.HaltConflict(w, "status_in_use", fmt.Sprintf("status %s is still used by todo %s", todo.Status, todo.Id))
+			return
+		}
+	}
+
+	todoList.Workflow = workflow
+	updatedList, err := t.database.UpdateTodoList(todoList)
+	if err != nil {
+		net.HaltInternalServerError(w, r, err)
+		return
 	}
-	fmt.Printf("Get todo list %s\n", listId)
+	net.Logger(r.Context()).Info("Changed workflow", "todo_list_id", todoList.Id)
 
-	net.Success(w, listGetResponse{ListId: listId, Todos: formattedTodos})
+	net.Success(w, toWorkflowResponse(updatedList))
 }
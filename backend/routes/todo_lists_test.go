@@ -2,7 +2,9 @@ package routes
 
 import (
 	"backend/db"
+	"backend/net"
 	"backend/util"
+	"fmt"
 	"github.com/stretchr/testify/assert"
 	"net/http"
 	"net/http/httptest"
@@ -27,38 +29,95 @@ func TestTodoLists_Create(t *testing.T) {
 			accessToken:   fakeToken,
 			body:          `{"invalid":"body"}`,
 			responseCode:  http.StatusBadRequest,
-			responseBody:  `{"error":"body not valid"}`,
+			responseBody:  problem(http.StatusBadRequest, "invalid_body", "body not valid"),
 			databaseLists: make(map[string]db.TodoList),
 		},
 		{
-			description:   "Create new todo list",
+			description:   "Missing title",
 			accessToken:   fakeToken,
-			body:          `{}`,
-			responseCode:  http.StatusOK,
-			responseBody:  `{"todo_list_id":"static_uuid"}`,
-			databaseLists: map[string]db.TodoList{"static_uuid": {Id: "static_uuid"}},
+			body:          `{"description":"weekly shopping"}`,
+			responseCode:  http.StatusUnprocessableEntity,
+			responseBody:  problem(http.StatusUnprocessableEntity, "validation_failed", "validation error", net.InvalidParam{Name: "title", Reason: "required"}),
+			databaseLists: make(map[string]db.TodoList),
+		},
+		{
+			description:   "Invalid title",
+			accessToken:   fakeToken,
+			body:          `{"title":"groceries!"}`,
+			responseCode:  http.StatusUnprocessableEntity,
+			responseBody:  invalidField("title", "title not valid"),
+			databaseLists: make(map[string]db.TodoList),
+		},
+		{
+			description:   "Title too long",
+			accessToken:   fakeToken,
+			body:          fmt.Sprintf(`{"title":"%s"}`, strings.Repeat("a", 65)),
+			responseCode:  http.StatusUnprocessableEntity,
+			responseBody:  invalidField("title", "title not valid"),
+			databaseLists: make(map[string]db.TodoList),
+		},
+		{
+			description:   "Invalid description",
+			accessToken:   fakeToken,
+			body:          `{"title":"Groceries","description":"weekly shopping!"}`,
+			responseCode:  http.StatusUnprocessableEntity,
+			responseBody:  invalidField("description", "description not valid"),
+			databaseLists: make(map[string]db.TodoList),
+		},
+		{
+			description:  "Create new todo list",
+			accessToken:  fakeToken,
+			body:         `{"title":"Groceries"}`,
+			responseCode: http.StatusOK,
+			responseBody: `{"todo_list_id":"static_uuid"}`,
+			databaseLists: map[string]db.TodoList{"static_uuid": {
+				Id:        "static_uuid",
+				Title:     "Groceries",
+				OwnerId:   fakeUserId,
+				CreatedAt: util.FakeTime(2021, 1, 1).UTC(),
+				UpdatedAt: util.FakeTime(2021, 1, 1).UTC(),
+			}},
+		},
+		{
+			description:  "Create new todo list with description",
+			accessToken:  fakeToken,
+			body:         `{"title":"Groceries","description":"weekly shopping"}`,
+			responseCode: http.StatusOK,
+			responseBody: `{"todo_list_id":"static_uuid"}`,
+			databaseLists: map[string]db.TodoList{"static_uuid": {
+				Id:          "static_uuid",
+				Title:       "Groceries",
+				Description: "weekly shopping",
+				OwnerId:     fakeUserId,
+				CreatedAt:   util.FakeTime(2021, 1, 1).UTC(),
+				UpdatedAt:   util.FakeTime(2021, 1, 1).UTC(),
+			}},
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.description, func(t *testing.T) {
-			database := db.TestDatabase(
-				func() time.Time { return util.FakeTime(2021, 1, 1) },
-				func(string) string { return "static_uuid" },
-			)
-			database.AccessTokens[fakeToken] = db.AccessToken{UserId: fakeUserId, Token: fakeToken}
-
-			todoList := CreateTodoLists(&database)
+			forEachDatabase(t, func() *db.InMemoryDatabase {
+				database := db.TestDatabase(
+					func() time.Time { return util.FakeTime(2021, 1, 1) },
+					func(string) string { return "static_uuid" },
+				)
+				database.Users[fakeUserId] = db.User{Id: fakeUserId, Name: "test user"}
+				database.AccessTokens[fakeToken] = db.AccessToken{UserId: fakeUserId, Token: fakeToken, ExpiresAt: util.FakeTime(2030, 1, 1).UTC()}
+				return database
+			}, func(t *testing.T, database db.Database, contents func() *db.InMemoryDatabase) {
+				todoList := CreateTodoLists(database)
 
-			request := httptest.NewRequest(http.MethodPost, "/todolists", strings.NewReader(tt.body))
-			request.Header.Set("Authorization", tt.accessToken)
-			writer := httptest.NewRecorder()
+				request := httptest.NewRequest(http.MethodPost, "/todolists", strings.NewReader(tt.body))
+				request.Header.Set("Authorization", "Bearer "+tt.accessToken)
+				writer := httptest.NewRecorder()
 
-			todoList.Create(writer, request)
+				authenticated(database, todoList.Create).ServeHTTP(writer, request)
 
-			assert.Equal(t, tt.responseCode, writer.Code)
-			assert.Equal(t, tt.responseBody, writer.Body.String())
-			assert.Equal(t, tt.databaseLists, database.TodoLists)
+				assert.Equal(t, tt.responseCode, writer.Code)
+				assert.Equal(t, tt.responseBody, writer.Body.String())
+				assert.Equal(t, tt.databaseLists, contents().TodoLists)
+			})
 		})
 	}
 }
@@ -79,59 +138,730 @@ func TestTodoLists_Get(t *testing.T) {
 			description:  "Invalid todo list id parameter",
 			accessToken:  fakeToken,
 			todoListId:   `invalid-list-id`,
-			responseCode: http.StatusBadRequest,
-			responseBody: `{"error":"invalid todo list"}`,
+			responseCode: http.StatusNotFound,
+			responseBody: problem(http.StatusNotFound, "todo_list_not_found", "invalid todo list"),
 		},
 		{
 			description:  "todo list not found",
 			accessToken:  fakeToken,
 			todoListId:   fakeWrongTodoListId,
-			responseCode: http.StatusBadRequest,
-			responseBody: `{"error":"todo list not found"}`,
+			responseCode: http.StatusNotFound,
+			responseBody: problem(http.StatusNotFound, "todo_list_not_found", "todo list not found"),
 		},
 		{
 			description:  "Get empty todo list",
 			accessToken:  fakeToken,
 			todoListId:   fakeNoElementsTodoListId,
 			responseCode: http.StatusOK,
-			responseBody: `{"todo_list_id":"lst_cccccccccccccccccccccc","todos":[]}`,
+			responseBody: `{"todo_list_id":"lst_cccccccccccccccccccccc","title":"Chores","description":"","owner_id":"usr_aaaaaaaaaaaaaaaaaaaaaa","created_at":"2021-12-31T23:59:59Z","updated_at":"2021-12-31T23:59:59Z","todos":[]}`,
 		},
 		{
 			description:  "Get todo list",
 			accessToken:  fakeToken,
 			todoListId:   fakeTodoListId,
 			responseCode: http.StatusOK,
-			responseBody: `{"todo_list_id":"lst_aaaaaaaaaaaaaaaaaaaaaa","todos":[{"id":"id1","created_by":"test user","description":"first todo","status":"todo","updated_at":"2024-01-01T00:00:00+00:00"},{"id":"id2","created_by":"test user","description":"second todo","status":"ongoing","updated_at":"2023-01-01T00:00:00+00:00"}]}`,
+			responseBody: `{"todo_list_id":"lst_aaaaaaaaaaaaaaaaaaaaaa","title":"Groceries","description":"weekly shopping","owner_id":"usr_aaaaaaaaaaaaaaaaaaaaaa","created_at":"2021-12-31T23:59:59Z","updated_at":"2023-05-31T23:59:59Z","todos":[{"id":"id1","created_by":"test user","description":"first todo","status":"todo","updated_at":"2023-12-31T23:59:59Z"},{"id":"id2","created_by":"test user","description":"second todo","status":"ongoing","updated_at":"2022-12-31T23:59:59Z"}]}`,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.description, func(t *testing.T) {
-			database := db.TestDatabase(
-				func() time.Time { return util.FakeTime(2021, 1, 1) },
-				func(string) string { return "static_uuid" },
-			)
-			database.Users[fakeUserId] = db.User{Id: fakeUserId, Name: "test user"}
-			database.AccessTokens[fakeToken] = db.AccessToken{UserId: fakeUserId, Token: fakeToken}
-			database.TodoLists[fakeNoElementsTodoListId] = db.TodoList{Id: fakeNoElementsTodoListId}
-			database.TodoLists[fakeTodoListId] = db.TodoList{Id: fakeTodoListId}
-			database.TodoItems = map[string]db.TodoItem{
-				"id1": {Id: "id1", ListId: fakeTodoListId, Description: "first todo", Status: "todo", UserId: fakeUserId, UpdatedAt: util.FakeTime(2024, 1, 1)},
-				"id2": {Id: "id2", ListId: fakeTodoListId, Description: "second todo", Status: "ongoing", UserId: fakeUserId, UpdatedAt: util.FakeTime(2023, 1, 1)},
-			}
-			database.TodoItemOrder = []string{"id1", "id2"}
-
-			todoList := CreateTodoLists(&database)
-
-			request := httptest.NewRequest(http.MethodGet, "/todolists", nil)
-			request.SetPathValue("list_id", tt.todoListId)
-			request.Header.Set("Authorization", tt.accessToken)
-			writer := httptest.NewRecorder()
-
-			todoList.Get(writer, request)
-
-			assert.Equal(t, tt.responseCode, writer.Code)
-			assert.Equal(t, tt.responseBody, writer.Body.String())
+			forEachDatabase(t, func() *db.InMemoryDatabase {
+				database := db.TestDatabase(
+					func() time.Time { return util.FakeTime(2021, 1, 1) },
+					func(string) string { return "static_uuid" },
+				)
+				database.Users[fakeUserId] = db.User{Id: fakeUserId, Name: "test user"}
+				database.AccessTokens[fakeToken] = db.AccessToken{UserId: fakeUserId, Token: fakeToken, ExpiresAt: util.FakeTime(2030, 1, 1).UTC()}
+				database.TodoLists[fakeNoElementsTodoListId] = db.TodoList{
+					Id:        fakeNoElementsTodoListId,
+					Title:     "Chores",
+					OwnerId:   fakeUserId,
+					CreatedAt: util.FakeTime(2022, 1, 1).UTC(),
+					UpdatedAt: util.FakeTime(2022, 1, 1).UTC(),
+				}
+				database.TodoLists[fakeTodoListId] = db.TodoList{
+					Id:          fakeTodoListId,
+					Title:       "Groceries",
+					Description: "weekly shopping",
+					OwnerId:     fakeUserId,
+					CreatedAt:   util.FakeTime(2022, 1, 1).UTC(),
+					UpdatedAt:   util.FakeTime(2023, 6, 1).UTC(),
+				}
+				database.TodoItems = map[string]db.TodoItem{
+					"id1": {Id: "id1", ListId: fakeTodoListId, Description: "first todo", Status: "todo", UserId: fakeUserId, UpdatedAt: util.FakeTime(2024, 1, 1).UTC()},
+					"id2": {Id: "id2", ListId: fakeTodoListId, Description: "second todo", Status: "ongoing", UserId: fakeUserId, UpdatedAt: util.FakeTime(2023, 1, 1).UTC()},
+				}
+				database.TodoItemOrder = []string{"id1", "id2"}
+				return database
+			}, func(t *testing.T, database db.Database, contents func() *db.InMemoryDatabase) {
+				todoList := CreateTodoLists(database)
+
+				request := httptest.NewRequest(http.MethodGet, "/todolists", nil)
+				request.SetPathValue("list_id", tt.todoListId)
+				request.Header.Set("Authorization", "Bearer "+tt.accessToken)
+				writer := httptest.NewRecorder()
+
+				authenticated(database, todoList.Get).ServeHTTP(writer, request)
+
+				assert.Equal(t, tt.responseCode, writer.Code)
+				assert.Equal(t, tt.responseBody, writer.Body.String())
+			})
+		})
+	}
+}
+
+type deleteListTestCase struct {
+	description   string
+	accessToken   string
+	todoListId    string
+	responseCode  int
+	responseBody  string
+	databaseLists []string
+	databaseTodos []string
+}
+
+func TestTodoLists_Delete(t *testing.T) {
+	tests := []deleteListTestCase{
+		{
+			description:   "Invalid todo list id parameter",
+			accessToken:   fakeToken,
+			todoListId:    `invalid-list-id`,
+			responseCode:  http.StatusNotFound,
+			responseBody:  problem(http.StatusNotFound, "todo_list_not_found", "invalid todo list"),
+			databaseLists: []string{fakeTodoListId, fakeTodoListId2},
+			databaseTodos: []string{"id1", "id2", "id3"},
+		},
+		{
+			description:   "todo list not found",
+			accessToken:   fakeToken,
+			todoListId:    fakeWrongTodoListId,
+			responseCode:  http.StatusNotFound,
+			responseBody:  problem(http.StatusNotFound, "todo_list_not_found", "todo list not found"),
+			databaseLists: []string{fakeTodoListId, fakeTodoListId2},
+			databaseTodos: []string{"id1", "id2", "id3"},
+		},
+		{
+			description:   "Delete todo list and its todos",
+			accessToken:   fakeToken,
+			todoListId:    fakeTodoListId,
+			responseCode:  http.StatusNoContent,
+			responseBody:  ``,
+			databaseLists: []string{fakeTodoListId2},
+			databaseTodos: []string{"id3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.description, func(t *testing.T) {
+			forEachDatabase(t, func() *db.InMemoryDatabase {
+				database := db.TestDatabase(
+					func() time.Time { return util.FakeTime(2021, 1, 1) },
+					func(string) string { return "static_uuid" },
+				)
+				database.Users[fakeUserId] = db.User{Id: fakeUserId, Name: "test user"}
+				database.AccessTokens[fakeToken] = db.AccessToken{UserId: fakeUserId, Token: fakeToken, ExpiresAt: util.FakeTime(2030, 1, 1).UTC()}
+				database.TodoLists[fakeTodoListId] = db.TodoList{Id: fakeTodoListId, OwnerId: fakeUserId}
+				database.TodoLists[fakeTodoListId2] = db.TodoList{Id: fakeTodoListId2, OwnerId: fakeUserId}
+				database.TodoItems = map[string]db.TodoItem{
+					"id1": {Id: "id1", ListId: fakeTodoListId, Description: "first todo", Status: "todo", UserId: fakeUserId, UpdatedAt: util.FakeTime(2024, 1, 1).UTC()},
+					"id2": {Id: "id2", ListId: fakeTodoListId, Description: "second todo", Status: "ongoing", UserId: fakeUserId, UpdatedAt: util.FakeTime(2023, 1, 1).UTC()},
+					"id3": {Id: "id3", ListId: fakeTodoListId2, Description: "other todo", Status: "todo", UserId: fakeUserId, UpdatedAt: util.FakeTime(2023, 1, 1).UTC()},
+				}
+				database.TodoItemOrder = []string{"id1", "id2", "id3"}
+				return database
+			}, func(t *testing.T, database db.Database, contents func() *db.InMemoryDatabase) {
+				todoList := CreateTodoLists(database)
+
+				request := httptest.NewRequest(http.MethodDelete, "/todolists", nil)
+				request.SetPathValue("list_id", tt.todoListId)
+				request.Header.Set("Authorization", "Bearer "+tt.accessToken)
+				writer := httptest.NewRecorder()
+
+				authenticated(database, todoList.Delete).ServeHTTP(writer, request)
+
+				assert.Equal(t, tt.responseCode, writer.Code)
+				assert.Equal(t, tt.responseBody, writer.Body.String())
+				var lists []string
+				for listId := range contents().TodoLists {
+					lists = append(lists, listId)
+				}
+				assert.ElementsMatch(t, tt.databaseLists, lists)
+				assert.Equal(t, tt.databaseTodos, contents().TodoItemOrder)
+			})
+		})
+	}
+}
+
+type authorizeListTestCase struct {
+	description  string
+	accessToken  string
+	method       string
+	body         string
+	userId       string
+	responseCode int
+	responseBody string
+}
+
+func TestTodoLists_Authorization(t *testing.T) {
+	tests := []authorizeListTestCase{
+		{
+			description:  "Owner gets todo list",
+			accessToken:  fakeToken,
+			method:       http.MethodGet,
+			responseCode: http.StatusOK,
+		},
+		{
+			description:  "Member gets todo list",
+			accessToken:  fakeMemberToken,
+			method:       http.MethodGet,
+			responseCode: http.StatusOK,
+		},
+		{
+			description:  "Outsider can't get todo list",
+			accessToken:  fakeOutsiderToken,
+			method:       http.MethodGet,
+			responseCode: http.StatusForbidden,
+			responseBody: problem(http.StatusForbidden, "not_a_member", "not a member of this todo list"),
+		},
+		{
+			description:  "Outsider can't get members",
+			accessToken:  fakeOutsiderToken,
+			method:       "GET members",
+			responseCode: http.StatusForbidden,
+			responseBody: problem(http.StatusForbidden, "not_a_member", "not a member of this todo list"),
+		},
+		{
+			description:  "Outsider can't invite themselves",
+			accessToken:  fakeOutsiderToken,
+			method:       "POST members",
+			body:         fmt.Sprintf(`{"user_id":"%s"}`, fakeOutsiderUserId),
+			responseCode: http.StatusForbidden,
+			responseBody: problem(http.StatusForbidden, "not_a_member", "not a member of this todo list"),
+		},
+		{
+			description:  "Outsider can't delete todo list",
+			accessToken:  fakeOutsiderToken,
+			method:       http.MethodDelete,
+			responseCode: http.StatusForbidden,
+			responseBody: problem(http.StatusForbidden, "not_a_member", "not a member of this todo list"),
+		},
+		{
+			description:  "Member can't delete todo list",
+			accessToken:  fakeMemberToken,
+			method:       http.MethodDelete,
+			responseCode: http.StatusForbidden,
+			responseBody: problem(http.StatusForbidden, "owner_only", "only the owner can delete a todo list"),
+		},
+		{
+			description:  "Owner deletes todo list",
+			accessToken:  fakeToken,
+			method:       http.MethodDelete,
+			responseCode: http.StatusNoContent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.description, func(t *testing.T) {
+			forEachDatabase(t, sharedListFixture, func(t *testing.T, database db.Database, contents func() *db.InMemoryDatabase) {
+				todoLists := CreateTodoLists(database)
+
+				request := httptest.NewRequest(http.MethodGet, "/todolists", strings.NewReader(tt.body))
+				request.SetPathValue("list_id", fakeTodoListId)
+				request.Header.Set("Authorization", "Bearer "+tt.accessToken)
+				writer := httptest.NewRecorder()
+
+				switch tt.method {
+				case http.MethodGet:
+					authenticated(database, todoLists.Get).ServeHTTP(writer, request)
+				case http.MethodDelete:
+					authenticated(database, todoLists.Delete).ServeHTTP(writer, request)
+				case "GET members":
+					authenticated(database, todoLists.GetMembers).ServeHTTP(writer, request)
+				case "POST members":
+					authenticated(database, todoLists.AddMember).ServeHTTP(writer, request)
+				}
+
+				assert.Equal(t, tt.responseCode, writer.Code)
+				if tt.responseBody != "" {
+					assert.Equal(t, tt.responseBody, writer.Body.String())
+				}
+			})
+		})
+	}
+}
+
+type membersTestCase struct {
+	description  string
+	accessToken  string
+	body         string
+	memberId     string
+	responseCode int
+	responseBody string
+	databaseList db.TodoList
+}
+
+func TestTodoLists_AddMember(t *testing.T) {
+	tests := []membersTestCase{
+		{
+			description:  "Invalid body",
+			accessToken:  fakeToken,
+			body:         `{"invalid":"body"}`,
+			responseCode: http.StatusBadRequest,
+			responseBody: problem(http.StatusBadRequest, "invalid_body", "body not valid"),
+			databaseList: db.TodoList{Id: fakeTodoListId, OwnerId: fakeUserId, MemberIds: []string{fakeMemberUserId}},
+		},
+		{
+			description:  "Invalid user id",
+			accessToken:  fakeToken,
+			body:         `{"user_id":"not-a-uuid"}`,
+			responseCode: http.StatusUnprocessableEntity,
+			responseBody: invalidField("user_id", "invalid user id"),
+			databaseList: db.TodoList{Id: fakeTodoListId, OwnerId: fakeUserId, MemberIds: []string{fakeMemberUserId}},
+		},
+		{
+			description:  "User not found",
+			accessToken:  fakeToken,
+			body:         fmt.Sprintf(`{"user_id":"%s"}`, fakeWrongUserId),
+			responseCode: http.StatusNotFound,
+			responseBody: problem(http.StatusNotFound, "user_not_found", "user not found"),
+			databaseList: db.TodoList{Id: fakeTodoListId, OwnerId: fakeUserId, MemberIds: []string{fakeMemberUserId}},
+		},
+		{
+			description:  "Owner invites user",
+			accessToken:  fakeToken,
+			body:         fmt.Sprintf(`{"user_id":"%s"}`, fakeOutsiderUserId),
+			responseCode: http.StatusOK,
+			responseBody: `{"todo_list_id":"lst_aaaaaaaaaaaaaaaaaaaaaa","owner_id":"usr_aaaaaaaaaaaaaaaaaaaaaa","member_ids":["usr_cccccccccccccccccccccc","usr_dddddddddddddddddddddd"]}`,
+			databaseList: db.TodoList{Id: fakeTodoListId, OwnerId: fakeUserId, MemberIds: []string{fakeMemberUserId, fakeOutsiderUserId}},
+		},
+		{
+			description:  "Member invites user",
+			accessToken:  fakeMemberToken,
+			body:         fmt.Sprintf(`{"user_id":"%s"}`, fakeOutsiderUserId),
+			responseCode: http.StatusOK,
+			responseBody: `{"todo_list_id":"lst_aaaaaaaaaaaaaaaaaaaaaa","owner_id":"usr_aaaaaaaaaaaaaaaaaaaaaa","member_ids":["usr_cccccccccccccccccccccc","usr_dddddddddddddddddddddd"]}`,
+			databaseList: db.TodoList{Id: fakeTodoListId, OwnerId: fakeUserId, MemberIds: []string{fakeMemberUserId, fakeOutsiderUserId}},
+		},
+		{
+			description:  "Invite existing member",
+			accessToken:  fakeToken,
+			body:         fmt.Sprintf(`{"user_id":"%s"}`, fakeMemberUserId),
+			responseCode: http.StatusOK,
+			responseBody: `{"todo_list_id":"lst_aaaaaaaaaaaaaaaaaaaaaa","owner_id":"usr_aaaaaaaaaaaaaaaaaaaaaa","member_ids":["usr_cccccccccccccccccccccc"]}`,
+			databaseList: db.TodoList{Id: fakeTodoListId, OwnerId: fakeUserId, MemberIds: []string{fakeMemberUserId}},
+		},
+		{
+			description:  "Invite owner",
+			accessToken:  fakeMemberToken,
+			body:         fmt.Sprintf(`{"user_id":"%s"}`, fakeUserId),
+			responseCode: http.StatusOK,
+			responseBody: `{"todo_list_id":"lst_aaaaaaaaaaaaaaaaaaaaaa","owner_id":"usr_aaaaaaaaaaaaaaaaaaaaaa","member_ids":["usr_cccccccccccccccccccccc"]}`,
+			databaseList: db.TodoList{Id: fakeTodoListId, OwnerId: fakeUserId, MemberIds: []string{fakeMemberUserId}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.description, func(t *testing.T) {
+			forEachDatabase(t, sharedListFixture, func(t *testing.T, database db.Database, contents func() *db.InMemoryDatabase) {
+				todoLists := CreateTodoLists(database)
+
+				request := httptest.NewRequest(http.MethodPost, "/todolists/members", strings.NewReader(tt.body))
+				request.SetPathValue("list_id", fakeTodoListId)
+				request.Header.Set("Authorization", "Bearer "+tt.accessToken)
+				writer := httptest.NewRecorder()
+
+				authenticated(database, todoLists.AddMember).ServeHTTP(writer, request)
+
+				assert.Equal(t, tt.responseCode, writer.Code)
+				assert.Equal(t, tt.responseBody, writer.Body.String())
+				assert.Equal(t, tt.databaseList, contents().TodoLists[fakeTodoListId])
+			})
+		})
+	}
+}
+
+func TestTodoLists_RemoveMember(t *testing.T) {
+	tests := []membersTestCase{
+		{
+			description:  "Owner can't be removed",
+			accessToken:  fakeToken,
+			memberId:     fakeUserId,
+			responseCode: http.StatusConflict,
+			responseBody: problem(http.StatusConflict, "owner_not_removable", "the owner can't be removed"),
+			databaseList: db.TodoList{Id: fakeTodoListId, OwnerId: fakeUserId, MemberIds: []string{fakeMemberUserId}},
+		},
+		{
+			description:  "User isn't a member",
+			accessToken:  fakeToken,
+			memberId:     fakeOutsiderUserId,
+			responseCode: http.StatusNotFound,
+			responseBody: problem(http.StatusNotFound, "member_not_found", "user is not a member"),
+			databaseList: db.TodoList{Id: fakeTodoListId, OwnerId: fakeUserId, MemberIds: []string{fakeMemberUserId}},
+		},
+		{
+			description:  "Outsider can't remove members",
+			accessToken:  fakeOutsiderToken,
+			memberId:     fakeMemberUserId,
+			responseCode: http.StatusForbidden,
+			responseBody: problem(http.StatusForbidden, "not_a_member", "not a member of this todo list"),
+			databaseList: db.TodoList{Id: fakeTodoListId, OwnerId: fakeUserId, MemberIds: []string{fakeMemberUserId}},
+		},
+		{
+			description:  "Owner removes member",
+			accessToken:  fakeToken,
+			memberId:     fakeMemberUserId,
+			responseCode: http.StatusNoContent,
+			databaseList: db.TodoList{Id: fakeTodoListId, OwnerId: fakeUserId},
+		},
+		{
+			description:  "Member leaves",
+			accessToken:  fakeMemberToken,
+			memberId:     fakeMemberUserId,
+			responseCode: http.StatusNoContent,
+			databaseList: db.TodoList{Id: fakeTodoListId, OwnerId: fakeUserId},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.description, func(t *testing.T) {
+			forEachDatabase(t, sharedListFixture, func(t *testing.T, database db.Database, contents func() *db.InMemoryDatabase) {
+				todoLists := CreateTodoLists(database)
+
+				request := httptest.NewRequest(http.MethodDelete, "/todolists/members", nil)
+				request.SetPathValue("list_id", fakeTodoListId)
+				request.SetPathValue("user_id", tt.memberId)
+				request.Header.Set("Authorization", "Bearer "+tt.accessToken)
+				writer := httptest.NewRecorder()
+
+				authenticated(database, todoLists.RemoveMember).ServeHTTP(writer, request)
+
+				assert.Equal(t, tt.responseCode, writer.Code)
+				assert.Equal(t, tt.responseBody, writer.Body.String())
+				assert.Equal(t, tt.databaseList, contents().TodoLists[fakeTodoListId])
+			})
+		})
+	}
+}
+
+type getAllListsTestCase struct {
+	description  string
+	accessToken  string
+	responseCode int
+	responseBody string
+}
+
+func TestTodoLists_GetAll(t *testing.T) {
+	tests := []getAllListsTestCase{
+		{
+			description:  "Owner gets owned lists",
+			accessToken:  fakeToken,
+			responseCode: http.StatusOK,
+			responseBody: `{"todo_lists":[{"todo_list_id":"lst_aaaaaaaaaaaaaaaaaaaaaa","title":"Groceries","owner_id":"usr_aaaaaaaaaaaaaaaaaaaaaa","todo_count":3,"status_counts":{"done":1,"todo":2}},{"todo_list_id":"lst_cccccccccccccccccccccc","title":"Chores","owner_id":"usr_aaaaaaaaaaaaaaaaaaaaaa","todo_count":0,"status_counts":{}}]}`,
+		},
+		{
+			description:  "Member gets shared lists",
+			accessToken:  fakeMemberToken,
+			responseCode: http.StatusOK,
+			responseBody: `{"todo_lists":[{"todo_list_id":"lst_aaaaaaaaaaaaaaaaaaaaaa","title":"Groceries","owner_id":"usr_aaaaaaaaaaaaaaaaaaaaaa","todo_count":3,"status_counts":{"done":1,"todo":2}}]}`,
+		},
+		{
+			description:  "Outsider gets no lists",
+			accessToken:  fakeOutsiderToken,
+			responseCode: http.StatusOK,
+			responseBody: `{"todo_lists":[]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.description, func(t *testing.T) {
+			forEachDatabase(t, func() *db.InMemoryDatabase {
+				database := sharedListFixture()
+				sharedList := database.TodoLists[fakeTodoListId]
+				sharedList.Title = "Groceries"
+				database.TodoLists[fakeTodoListId] = sharedList
+				database.TodoLists[fakeTodoListId2] = db.TodoList{Id: fakeTodoListId2, Title: "Chores", OwnerId: fakeUserId}
+				database.TodoItems["id2"] = db.TodoItem{Id: "id2", ListId: fakeTodoListId, Description: "second todo", Status: "done", UserId: fakeUserId, UpdatedAt: util.FakeTime(2024, 1, 1).UTC()}
+				database.TodoItems["id3"] = db.TodoItem{Id: "id3", ListId: fakeTodoListId, Description: "third todo", Status: "todo", UserId: fakeUserId, UpdatedAt: util.FakeTime(2024, 1, 1).UTC()}
+				database.TodoItemOrder = []string{fakeTodoId, "id2", "id3"}
+				return database
+			}, func(t *testing.T, database db.Database, contents func() *db.InMemoryDatabase) {
+				todoLists := CreateTodoLists(database)
+
+				request := httptest.NewRequest(http.MethodGet, "/todolists", nil)
+				request.Header.Set("Authorization", "Bearer "+tt.accessToken)
+				writer := httptest.NewRecorder()
+
+				authenticated(database, todoLists.GetAll).ServeHTTP(writer, request)
+
+				assert.Equal(t, tt.responseCode, writer.Code)
+				assert.Equal(t, tt.responseBody, writer.Body.String())
+			})
+		})
+	}
+}
+
+type patchListTestCase struct {
+	description  string
+	accessToken  string
+	todoListId   string
+	body         string
+	responseCode int
+	responseBody string
+	databaseList db.TodoList
+}
+
+func TestTodoLists_Patch(t *testing.T) {
+	original := db.TodoList{
+		Id:          fakeTodoListId,
+		Title:       "Groceries",
+		Description: "weekly shopping",
+		OwnerId:     fakeUserId,
+		MemberIds:   []string{fakeMemberUserId},
+		CreatedAt:   util.FakeTime(2024, 1, 1).UTC(),
+		UpdatedAt:   util.FakeTime(2024, 1, 1).UTC(),
+	}
+
+	tests := []patchListTestCase{
+		{
+			description:  "Invalid body",
+			accessToken:  fakeToken,
+			todoListId:   fakeTodoListId,
+			body:         `{}`,
+			responseCode: http.StatusUnprocessableEntity,
+			responseBody: problem(http.StatusUnprocessableEntity, "validation_failed", "validation error", net.InvalidParam{Name: "title", Reason: "required_without"}, net.InvalidParam{Name: "description", Reason: "required_without"}),
+			databaseList: original,
+		},
+		{
+			description:  "Invalid title",
+			accessToken:  fakeToken,
+			todoListId:   fakeTodoListId,
+			body:         `{"title":""}`,
+			responseCode: http.StatusUnprocessableEntity,
+			responseBody: invalidField("title", "title not valid"),
+			databaseList: original,
+		},
+		{
+			description:  "Invalid description",
+			accessToken:  fakeToken,
+			todoListId:   fakeTodoListId,
+			body:         `{"description":"weekly shopping!"}`,
+			responseCode: http.StatusUnprocessableEntity,
+			responseBody: invalidField("description", "description not valid"),
+			databaseList: original,
+		},
+		{
+			description:  "todo list not found",
+			accessToken:  fakeToken,
+			todoListId:   fakeWrongTodoListId,
+			body:         `{"title":"Weekend groceries"}`,
+			responseCode: http.StatusNotFound,
+			responseBody: problem(http.StatusNotFound, "todo_list_not_found", "todo list not found"),
+			databaseList: original,
+		},
+		{
+			description:  "Outsider can't rename",
+			accessToken:  fakeOutsiderToken,
+			todoListId:   fakeTodoListId,
+			body:         `{"title":"Weekend groceries"}`,
+			responseCode: http.StatusForbidden,
+			responseBody: problem(http.StatusForbidden, "not_a_member", "not a member of this todo list"),
+			databaseList: original,
+		},
+		{
+			description:  "Rename todo list",
+			accessToken:  fakeMemberToken,
+			todoListId:   fakeTodoListId,
+			body:         `{"title":"Weekend groceries"}`,
+			responseCode: http.StatusOK,
+			responseBody: `{"todo_list_id":"lst_aaaaaaaaaaaaaaaaaaaaaa","title":"Weekend groceries","description":"weekly shopping","owner_id":"usr_aaaaaaaaaaaaaaaaaaaaaa","created_at":"2023-12-31T23:59:59Z","updated_at":"2024-06-29T23:59:59Z"}`,
+			databaseList: db.TodoList{
+				Id:          fakeTodoListId,
+				Title:       "Weekend groceries",
+				Description: "weekly shopping",
+				OwnerId:     fakeUserId,
+				MemberIds:   []string{fakeMemberUserId},
+				CreatedAt:   util.FakeTime(2024, 1, 1).UTC(),
+				UpdatedAt:   util.FakeTime(2024, 6, 30).UTC(),
+			},
+		},
+		{
+			description:  "Clear description",
+			accessToken:  fakeToken,
+			todoListId:   fakeTodoListId,
+			body:         `{"description":""}`,
+			responseCode: http.StatusOK,
+			responseBody: `{"todo_list_id":"lst_aaaaaaaaaaaaaaaaaaaaaa","title":"Groceries","description":"","owner_id":"usr_aaaaaaaaaaaaaaaaaaaaaa","created_at":"2023-12-31T23:59:59Z","updated_at":"2024-06-29T23:59:59Z"}`,
+			databaseList: db.TodoList{
+				Id:        fakeTodoListId,
+				Title:     "Groceries",
+				OwnerId:   fakeUserId,
+				MemberIds: []string{fakeMemberUserId},
+				CreatedAt: util.FakeTime(2024, 1, 1).UTC(),
+				UpdatedAt: util.FakeTime(2024, 6, 30).UTC(),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.description, func(t *testing.T) {
+			forEachDatabase(t, func() *db.InMemoryDatabase {
+				database := sharedListFixture()
+				database.TodoLists[fakeTodoListId] = original
+				return database
+			}, func(t *testing.T, database db.Database, contents func() *db.InMemoryDatabase) {
+				todoLists := CreateTodoLists(database)
+
+				request := httptest.NewRequest(http.MethodPatch, "/todolists", strings.NewReader(tt.body))
+				request.SetPathValue("list_id", tt.todoListId)
+				request.Header.Set("Authorization", "Bearer "+tt.accessToken)
+				writer := httptest.NewRecorder()
+
+				authenticated(database, todoLists.Patch).ServeHTTP(writer, request)
+
+				assert.Equal(t, tt.responseCode, writer.Code)
+				assert.Equal(t, tt.responseBody, writer.Body.String())
+				assert.Equal(t, tt.databaseList, contents().TodoLists[fakeTodoListId])
+			})
+		})
+	}
+}
+
+type getWorkflowTestCase struct {
+	description  string
+	accessToken  string
+	workflow     *db.Workflow
+	responseCode int
+	responseBody string
+}
+
+func TestTodoLists_GetWorkflow(t *testing.T) {
+	tests := []getWorkflowTestCase{
+		{
+			description:  "Outsider can't get workflow",
+			accessToken:  fakeOutsiderToken,
+			responseCode: http.StatusForbidden,
+			responseBody: problem(http.StatusForbidden, "not_a_member", "not a member of this todo list"),
+		},
+		{
+			description:  "Get default workflow",
+			accessToken:  fakeMemberToken,
+			responseCode: http.StatusOK,
+			responseBody: `{"todo_list_id":"lst_aaaaaaaaaaaaaaaaaaaaaa","initial_status":"todo","statuses":["todo","ongoing","done"],"transitions":{"done":["ongoing"],"ongoing":["done","todo"],"todo":["ongoing"]}}`,
+		},
+		{
+			description:  "Get custom workflow",
+			accessToken:  fakeToken,
+			workflow:     customWorkflow(),
+			responseCode: http.StatusOK,
+			responseBody: `{"todo_list_id":"lst_aaaaaaaaaaaaaaaaaaaaaa","initial_status":"backlog","statuses":["backlog","todo","blocked","done"],"transitions":{"backlog":["todo"],"blocked":["todo"],"done":[],"todo":["blocked","done"]}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.description, func(t *testing.T) {
+			forEachDatabase(t, func() *db.InMemoryDatabase {
+				database := sharedListFixture()
+				todoList := database.TodoLists[fakeTodoListId]
+				todoList.Workflow = tt.workflow
+				database.TodoLists[fakeTodoListId] = todoList
+				return database
+			}, func(t *testing.T, database db.Database, contents func() *db.InMemoryDatabase) {
+				todoLists := CreateTodoLists(database)
+
+				request := httptest.NewRequest(http.MethodGet, "/todolists/workflow", nil)
+				request.SetPathValue("list_id", fakeTodoListId)
+				request.Header.Set("Authorization", "Bearer "+tt.accessToken)
+				writer := httptest.NewRecorder()
+
+				authenticated(database, todoLists.GetWorkflow).ServeHTTP(writer, request)
+
+				assert.Equal(t, tt.responseCode, writer.Code)
+				assert.Equal(t, tt.responseBody, writer.Body.String())
+			})
+		})
+	}
+}
+
+type updateWorkflowTestCase struct {
+	description      string
+	accessToken      string
+	body             string
+	responseCode     int
+	responseBody     string
+	databaseWorkflow *db.Workflow
+}
+
+func TestTodoLists_UpdateWorkflow(t *testing.T) {
+	tests := []updateWorkflowTestCase{
+		{
+			description:  "Missing statuses",
+			accessToken:  fakeToken,
+			body:         `{"transitions":{}}`,
+			responseCode: http.StatusUnprocessableEntity,
+			responseBody: problem(http.StatusUnprocessableEntity, "validation_failed", "validation error", net.InvalidParam{Name: "statuses", Reason: "required"}),
+		},
+		{
+			description:  "Empty statuses",
+			accessToken:  fakeToken,
+			body:         `{"statuses":[],"transitions":{}}`,
+			responseCode: http.StatusUnprocessableEntity,
+			responseBody: problem(http.StatusUnprocessableEntity, "validation_failed", "validation error", net.InvalidParam{Name: "statuses", Reason: "min"}),
+		},
+		{
+			description:  "Invalid status",
+			accessToken:  fakeToken,
+			body:         `{"statuses":["todo","Done!"],"transitions":{}}`,
+			responseCode: http.StatusUnprocessableEntity,
+			responseBody: invalidField("statuses", "status not valid"),
+		},
+		{
+			description:  "Inconsistent workflow",
+			accessToken:  fakeToken,
+			body:         `{"statuses":["todo","done"],"transitions":{"todo":["ongoing"]}}`,
+			responseCode: http.StatusUnprocessableEntity,
+			responseBody: problem(http.StatusUnprocessableEntity, "invalid_workflow", "invalid workflow: transition to unknown status ongoing"),
+		},
+		{
+			description:  "Member can't change workflow",
+			accessToken:  fakeMemberToken,
+			body:         `{"statuses":["todo","done"],"transitions":{"todo":["done"]}}`,
+			responseCode: http.StatusForbidden,
+			responseBody: problem(http.StatusForbidden, "owner_only", "only the owner can change the workflow"),
+		},
+		{
+			description:  "Status still in use",
+			accessToken:  fakeToken,
+			body:         `{"statuses":["backlog","done"],"transitions":{"backlog":["done"]}}`,
+			responseCode: http.StatusConflict,
+			responseBody: problem(http.StatusConflict, "status_in_use", "status todo is still used by todo tdo_aaaaaaaaaaaaaaaaaaaaaa"),
+		},
+		{
+			description:      "Change workflow",
+			accessToken:      fakeToken,
+			body:             `{"statuses":["backlog","todo","blocked","done"],"transitions":{"backlog":["todo"],"todo":["blocked","done"],"blocked":["todo"]}}`,
+			responseCode:     http.StatusOK,
+			responseBody:     `{"todo_list_id":"lst_aaaaaaaaaaaaaaaaaaaaaa","initial_status":"backlog","statuses":["backlog","todo","blocked","done"],"transitions":{"backlog":["todo"],"blocked":["todo"],"done":[],"todo":["blocked","done"]}}`,
+			databaseWorkflow: customWorkflow(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.description, func(t *testing.T) {
+			forEachDatabase(t, sharedListFixture, func(t *testing.T, database db.Database, contents func() *db.InMemoryDatabase) {
+				todoLists := CreateTodoLists(database)
+
+				request := httptest.NewRequest(http.MethodPut, "/todolists/workflow", strings.NewReader(tt.body))
+				request.SetPathValue("list_id", fakeTodoListId)
+				request.Header.Set("Authorization", "Bearer "+tt.accessToken)
+				writer := httptest.NewRecorder()
+
+				authenticated(database, todoLists.UpdateWorkflow).ServeHTTP(writer, request)
+
+				assert.Equal(t, tt.responseCode, writer.Code)
+				assert.Equal(t, tt.responseBody, writer.Body.String())
+				assert.Equal(t, tt.databaseWorkflow, contents().TodoLists[fakeTodoListId].Workflow)
+			})
 		})
 	}
 }
@@ -3,7 +3,6 @@ package routes
 import (
 	"backend/db"
 	"backend/net"
-	"fmt"
 	"net/http"
 	"regexp"
 )
@@ -19,28 +18,31 @@ func CreateTodos(database db.Database) Todos {
 func (t *Todos) Create(w http.ResponseWriter, r *http.Request) {
 	body, err := net.ParseBody[todoCreateRequest](r)
 	if err != nil {
-		net.HaltBadRequest(w, err.Error())
+		net.HaltError(w, r, err)
 		return
 	}
 
 	if !regexp.MustCompile(todoDescriptionRegex).MatchString(body.Description) {
-		net.HaltBadRequest(w, "description not valid")
+		net.HaltInvalidField(w, "description", "description not valid")
 		return
 	}
 
-	_, err = t.database.GetTodos(body.ListId)
-	if err != nil {
-		net.HaltBadRequest(w, err.Error())
+	user, ok := requestUser(w, r)
+	if !ok {
 		return
 	}
 
-	accessToken, _ := t.database.GetAccessToken(r.Header.Get("Authorization"))
-	item := t.database.CreateTodo(body.ListId, body.Description, accessToken.UserId)
+	if _, ok = authorizeTodoList(w, r, t.database, body.ListId, user.Id); !ok {
+		return
+	}
 
-	// No need to handle error, we already know the user exists
-	user, _ := t.database.GetUser(item.UserId)
+	item, err := t.database.CreateTodo(body.ListId, body.Description, user.Id)
+	if err != nil {
+		net.HaltInternalServerError(w, r, err)
+		return
+	}
 
-	fmt.Printf("Created todo %s\n", item.Id)
+	net.Logger(r.Context()).Info("Created todo", "todo_id", item.Id)
 
 	net.Success(w, toTodoItem(item, user))
 }
@@ -48,28 +50,103 @@ func (t *Todos) Create(w http.ResponseWriter, r *http.Request) {
 func (t *Todos) Update(w http.ResponseWriter, r *http.Request) {
 	body, err := net.ParseBody[todoUpdateRequest](r)
 	if err != nil {
-		net.HaltBadRequest(w, err.Error())
+		net.HaltError(w, r, err)
 		return
 	}
 
-	todoId := r.PathValue("todo_id")
+	user, ok := requestUser(w, r)
+	if !ok {
+		return
+	}
+
+	item, todoList, ok := authorizeTodo(w, r, t.database, r.PathValue("todo_id"), user.Id)
+	if !ok {
+		return
+	}
 
-	item, err := t.database.GetTodo(todoId)
+	err = item.ChangeStatus(body.Status, todoList.StatusWorkflow())
 	if err != nil {
-		net.HaltBadRequest(w, err.Error())
+		net.HaltError(w, r, err)
 		return
 	}
 
-	err = item.ChangeStatus(body.Status)
+	updatedItem, err := t.database.UpdateTodo(item)
 	if err != nil {
-		net.HaltBadRequest(w, err.Error())
+		net.HaltInternalServerError(w, r, err)
 		return
 	}
 
-	// No need to handle error, we already know the both exists
-	updatedItem, _ := t.database.UpdateTodo(item)
-	user, _ := t.database.GetUser(updatedItem.UserId)
-	fmt.Printf("Updated todo %s\n", item.Id)
+	// No need to handle error, we already know the user exists
+	creator, _ := t.database.GetUser(updatedItem.UserId)
+	net.Logger(r.Context()).Info("Updated todo", "todo_id", item.Id)
+
+	net.Success(w, toTodoItem(updatedItem, creator))
+}
+
+func (t *Todos) Patch(w http.ResponseWriter, r *http.Request) {
+	body, err := net.ParseBody[todoPatchRequest](r)
+	if err != nil {
+		net.HaltError(w, r, err)
+		return
+	}
+
+	if body.Description != nil && !regexp.MustCompile(todoDescriptionRegex).MatchString(*body.Description) {
+		net.HaltInvalidField(w, "description", "description not valid")
+		return
+	}
+
+	user, ok := requestUser(w, r)
+	if !ok {
+		return
+	}
+
+	item, todoList, ok := authorizeTodo(w, r, t.database, r.PathValue("todo_id"), user.Id)
+	if !ok {
+		return
+	}
+
+	if body.Description != nil {
+		item.Description = *body.Description
+	}
+	// Resending the current status is not a transition, so it's allowed
+	if body.Status != nil && *body.Status != item.Status {
+		err = item.ChangeStatus(*body.Status, todoList.StatusWorkflow())
+		if err != nil {
+			net.HaltError(w, r, err)
+			return
+		}
+	}
+
+	updatedItem, err := t.database.UpdateTodo(item)
+	if err != nil {
+		net.HaltInternalServerError(w, r, err)
+		return
+	}
+
+	// No need to handle error, we already know the user exists
+	creator, _ := t.database.GetUser(updatedItem.UserId)
+	net.Logger(r.Context()).Info("Patched todo", "todo_id", item.Id)
+
+	net.Success(w, toTodoItem(updatedItem, creator))
+}
+
+func (t *Todos) Delete(w http.ResponseWriter, r *http.Request) {
+	user, ok := requestUser(w, r)
+	if !ok {
+		return
+	}
+
+	item, _, ok := authorizeTodo(w, r, t.database, r.PathValue("todo_id"), user.Id)
+	if !ok {
+		return
+	}
+
+	err := t.database.DeleteTodo(item.Id)
+	if err != nil {
+		net.HaltInternalServerError(w, r, err)
+		return
+	}
+	net.Logger(r.Context()).Info("Deleted todo", "todo_id", item.Id)
 
-	net.Success(w, toTodoItem(updatedItem, user))
+	net.NoContent(w)
 }
@@ -2,6 +2,7 @@ package routes
 
 import (
 	"backend/db"
+	"backend/net"
 	"backend/util"
 	"fmt"
 	"github.com/stretchr/testify/assert"
@@ -28,7 +29,7 @@ func TestTodo_CreateValidations(t *testing.T) {
 			accessToken:   fakeToken,
 			body:          `{"invalid":"body"}`,
 			responseCode:  http.StatusBadRequest,
-			responseBody:  `{"error":"body not valid"}`,
+			responseBody:  problem(http.StatusBadRequest, "invalid_body", "body not valid"),
 			databaseTodos: make(map[string]db.TodoItem),
 		},
 		{
@@ -36,8 +37,8 @@ func TestTodo_CreateValidations(t *testing.T) {
 			accessToken: fakeToken,
 			body: fmt.Sprintf(`{"description":"%s", "todo_list_id":"%s"}`,
 				strings.Repeat("a", 257), fakeTodoListId),
-			responseCode:  http.StatusBadRequest,
-			responseBody:  `{"error":"description not valid"}`,
+			responseCode:  http.StatusUnprocessableEntity,
+			responseBody:  invalidField("description", "description not valid"),
 			databaseTodos: make(map[string]db.TodoItem),
 		},
 		{
@@ -45,8 +46,8 @@ func TestTodo_CreateValidations(t *testing.T) {
 			accessToken: fakeToken,
 			body: fmt.Sprintf(`{"description":"%s", "todo_list_id":"%s"}`,
 				"/", fakeTodoListId),
-			responseCode:  http.StatusBadRequest,
-			responseBody:  `{"error":"description not valid"}`,
+			responseCode:  http.StatusUnprocessableEntity,
+			responseBody:  invalidField("description", "description not valid"),
 			databaseTodos: make(map[string]db.TodoItem),
 		},
 		{
@@ -54,8 +55,8 @@ func TestTodo_CreateValidations(t *testing.T) {
 			accessToken: fakeToken,
 			body: fmt.Sprintf(`{"description":"%s", "todo_list_id":"%s"}`,
 				"description", "not-a-uuid"),
-			responseCode:  http.StatusBadRequest,
-			responseBody:  `{"error":"invalid todo list"}`,
+			responseCode:  http.StatusNotFound,
+			responseBody:  problem(http.StatusNotFound, "todo_list_not_found", "invalid todo list"),
 			databaseTodos: make(map[string]db.TodoItem),
 		},
 		{
@@ -63,32 +64,36 @@ func TestTodo_CreateValidations(t *testing.T) {
 			accessToken: fakeToken,
 			body: fmt.Sprintf(`{"description":"%s", "todo_list_id":"%s"}`,
 				"description", fakeWrongTodoListId),
-			responseCode:  http.StatusBadRequest,
-			responseBody:  `{"error":"todo list not found"}`,
+			responseCode:  http.StatusNotFound,
+			responseBody:  problem(http.StatusNotFound, "todo_list_not_found", "todo list not found"),
 			databaseTodos: make(map[string]db.TodoItem),
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.description, func(t *testing.T) {
-			database := db.TestDatabase(
-				func() time.Time { return util.FakeTime(2024, 6, 30) },
-				func(string) string { return "static_uuid" },
-			)
-			database.AccessTokens[fakeToken] = db.AccessToken{UserId: fakeUserId, Token: fakeToken}
-			database.TodoLists[fakeTodoListId] = db.TodoList{Id: fakeTodoListId}
-
-			todos := CreateTodos(&database)
+			forEachDatabase(t, func() *db.InMemoryDatabase {
+				database := db.TestDatabase(
+					func() time.Time { return util.FakeTime(2024, 6, 30) },
+					func(string) string { return "static_uuid" },
+				)
+				database.Users[fakeUserId] = db.User{Id: fakeUserId, Name: "test user"}
+				database.AccessTokens[fakeToken] = db.AccessToken{UserId: fakeUserId, Token: fakeToken, ExpiresAt: util.FakeTime(2030, 1, 1).UTC()}
+				database.TodoLists[fakeTodoListId] = db.TodoList{Id: fakeTodoListId, OwnerId: fakeUserId}
+				return database
+			}, func(t *testing.T, database db.Database, contents func() *db.InMemoryDatabase) {
+				todos := CreateTodos(database)
 
-			request := httptest.NewRequest(http.MethodPost, "/todos", strings.NewReader(tt.body))
-			request.Header.Set("Authorization", tt.accessToken)
-			writer := httptest.NewRecorder()
+				request := httptest.NewRequest(http.MethodPost, "/todos", strings.NewReader(tt.body))
+				request.Header.Set("Authorization", "Bearer "+tt.accessToken)
+				writer := httptest.NewRecorder()
 
-			todos.Create(writer, request)
+				authenticated(database, todos.Create).ServeHTTP(writer, request)
 
-			assert.Equal(t, tt.responseCode, writer.Code)
-			assert.Equal(t, tt.responseBody, writer.Body.String())
-			assert.Equal(t, tt.databaseTodos, database.TodoItems)
+				assert.Equal(t, tt.responseCode, writer.Code)
+				assert.Equal(t, tt.responseBody, writer.Body.String())
+				assert.Equal(t, tt.databaseTodos, contents().TodoItems)
+			})
 		})
 	}
 }
@@ -101,7 +106,7 @@ func TestTodo_CreateLogic(t *testing.T) {
 			body: fmt.Sprintf(`{"description":"%s", "todo_list_id":"%s"}`,
 				"test todo", fakeTodoListId),
 			responseCode: http.StatusOK,
-			responseBody: `{"id":"static_uuid","created_by":"test user","description":"test todo","status":"todo","updated_at":"2024-06-30T00:00:00+00:00"}`,
+			responseBody: `{"id":"static_uuid","created_by":"test user","description":"test todo","status":"todo","updated_at":"2024-06-29T23:59:59Z"}`,
 			databaseTodos: map[string]db.TodoItem{
 				"static_uuid": {
 					Id:          "static_uuid",
@@ -109,7 +114,25 @@ func TestTodo_CreateLogic(t *testing.T) {
 					Description: "test todo",
 					Status:      "todo",
 					UserId:      fakeUserId,
-					UpdatedAt:   util.FakeTime(2024, 6, 30),
+					UpdatedAt:   util.FakeTime(2024, 6, 30).UTC(),
+				},
+			},
+		},
+		{
+			description: "Create new todo in custom workflow",
+			accessToken: fakeToken,
+			body: fmt.Sprintf(`{"description":"%s", "todo_list_id":"%s"}`,
+				"test todo", fakeTodoListId2),
+			responseCode: http.StatusOK,
+			responseBody: `{"id":"static_uuid","created_by":"test user","description":"test todo","status":"backlog","updated_at":"2024-06-29T23:59:59Z"}`,
+			databaseTodos: map[string]db.TodoItem{
+				"static_uuid": {
+					Id:          "static_uuid",
+					ListId:      fakeTodoListId2,
+					Description: "test todo",
+					Status:      "backlog",
+					UserId:      fakeUserId,
+					UpdatedAt:   util.FakeTime(2024, 6, 30).UTC(),
 				},
 			},
 		},
@@ -118,33 +141,37 @@ func TestTodo_CreateLogic(t *testing.T) {
 			accessToken: fakeToken,
 			body: fmt.Sprintf(`{"description":"%s", "todo_list_id":"%s"}`,
 				"test todo", fakeWrongTodoListId),
-			responseCode:  http.StatusBadRequest,
-			responseBody:  `{"error":"todo list not found"}`,
+			responseCode:  http.StatusNotFound,
+			responseBody:  problem(http.StatusNotFound, "todo_list_not_found", "todo list not found"),
 			databaseTodos: make(map[string]db.TodoItem),
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.description, func(t *testing.T) {
-			database := db.TestDatabase(
-				func() time.Time { return util.FakeTime(2024, 6, 30) },
-				func(string) string { return "static_uuid" },
-			)
-			database.Users[fakeUserId] = db.User{Id: fakeUserId, Name: "test user"}
-			database.AccessTokens[fakeToken] = db.AccessToken{UserId: fakeUserId, Token: fakeToken}
-			database.TodoLists[fakeTodoListId] = db.TodoList{Id: fakeTodoListId}
+			forEachDatabase(t, func() *db.InMemoryDatabase {
+				database := db.TestDatabase(
+					func() time.Time { return util.FakeTime(2024, 6, 30) },
+					func(string) string { return "static_uuid" },
+				)
+				database.Users[fakeUserId] = db.User{Id: fakeUserId, Name: "test user"}
+				database.AccessTokens[fakeToken] = db.AccessToken{UserId: fakeUserId, Token: fakeToken, ExpiresAt: util.FakeTime(2030, 1, 1).UTC()}
+				database.TodoLists[fakeTodoListId] = db.TodoList{Id: fakeTodoListId, OwnerId: fakeUserId}
+				database.TodoLists[fakeTodoListId2] = db.TodoList{Id: fakeTodoListId2, OwnerId: fakeUserId, Workflow: customWorkflow()}
+				return database
+			}, func(t *testing.T, database db.Database, contents func() *db.InMemoryDatabase) {
+				todos := CreateTodos(database)
 
-			todos := CreateTodos(&database)
+				request := httptest.NewRequest(http.MethodPost, "/todos", strings.NewReader(tt.body))
+				request.Header.Set("Authorization", "Bearer "+tt.accessToken)
+				writer := httptest.NewRecorder()
 
-			request := httptest.NewRequest(http.MethodPost, "/todos", strings.NewReader(tt.body))
-			request.Header.Add("Authorization", tt.accessToken)
-			writer := httptest.NewRecorder()
+				authenticated(database, todos.Create).ServeHTTP(writer, request)
 
-			todos.Create(writer, request)
-
-			assert.Equal(t, tt.responseCode, writer.Code)
-			assert.Equal(t, tt.responseBody, writer.Body.String())
-			assert.Equal(t, tt.databaseTodos, database.TodoItems)
+				assert.Equal(t, tt.responseCode, writer.Code)
+				assert.Equal(t, tt.responseBody, writer.Body.String())
+				assert.Equal(t, tt.databaseTodos, contents().TodoItems)
+			})
 		})
 	}
 }
@@ -152,6 +179,7 @@ func TestTodo_CreateLogic(t *testing.T) {
 type updateTodoTestCase struct {
 	description   string
 	accessToken   string
+	workflow      *db.Workflow
 	todoId        string
 	body          string
 	responseCode  int
@@ -167,49 +195,53 @@ func TestTodo_UpdateValidations(t *testing.T) {
 			todoId:       fakeTodoId,
 			body:         `{"invalid":"body"}`,
 			responseCode: http.StatusBadRequest,
-			responseBody: `{"error":"body not valid"}`,
+			responseBody: problem(http.StatusBadRequest, "invalid_body", "body not valid"),
 		},
 		{
 			description:  "Todo Id invalid",
 			accessToken:  fakeToken,
 			todoId:       "not-a-uuid",
 			body:         `{"status":"progress"}`,
-			responseCode: http.StatusBadRequest,
-			responseBody: `{"error":"invalid todo"}`,
+			responseCode: http.StatusNotFound,
+			responseBody: problem(http.StatusNotFound, "todo_not_found", "invalid todo"),
 		},
 		{
 			description:  "Todo not found",
 			accessToken:  fakeToken,
 			todoId:       fakeWrongTodoId,
 			body:         `{"status":"progress"}`,
-			responseCode: http.StatusBadRequest,
-			responseBody: `{"error":"todo not found"}`,
+			responseCode: http.StatusNotFound,
+			responseBody: problem(http.StatusNotFound, "todo_not_found", "todo not found"),
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.description, func(t *testing.T) {
-			database := db.TestDatabase(
-				func() time.Time { return util.FakeTime(2024, 6, 30) },
-				func(string) string { return "static_uuid" },
-			)
-			database.AccessTokens[fakeToken] = db.AccessToken{UserId: fakeUserId, Token: fakeToken}
-			database.TodoLists[fakeTodoListId] = db.TodoList{Id: fakeTodoListId}
-			database.TodoItems = map[string]db.TodoItem{
-				fakeTodoId: {Id: fakeTodoId, ListId: fakeTodoListId, Description: "first todo", Status: "todo", UserId: fakeUserId, UpdatedAt: util.FakeTime(2024, 1, 1)},
-			}
-
-			todos := CreateTodos(&database)
-
-			request := httptest.NewRequest(http.MethodPost, "/todos", strings.NewReader(tt.body))
-			request.SetPathValue("todo_id", tt.todoId)
-			request.Header.Set("Authorization", tt.accessToken)
-			writer := httptest.NewRecorder()
-
-			todos.Update(writer, request)
-
-			assert.Equal(t, tt.responseCode, writer.Code)
-			assert.Equal(t, tt.responseBody, writer.Body.String())
+			forEachDatabase(t, func() *db.InMemoryDatabase {
+				database := db.TestDatabase(
+					func() time.Time { return util.FakeTime(2024, 6, 30) },
+					func(string) string { return "static_uuid" },
+				)
+				database.Users[fakeUserId] = db.User{Id: fakeUserId, Name: "test user"}
+				database.AccessTokens[fakeToken] = db.AccessToken{UserId: fakeUserId, Token: fakeToken, ExpiresAt: util.FakeTime(2030, 1, 1).UTC()}
+				database.TodoLists[fakeTodoListId] = db.TodoList{Id: fakeTodoListId, OwnerId: fakeUserId}
+				database.TodoItems = map[string]db.TodoItem{
+					fakeTodoId: {Id: fakeTodoId, ListId: fakeTodoListId, Description: "first todo", Status: "todo", UserId: fakeUserId, UpdatedAt: util.FakeTime(2024, 1, 1).UTC()},
+				}
+				return database
+			}, func(t *testing.T, database db.Database, contents func() *db.InMemoryDatabase) {
+				todos := CreateTodos(database)
+
+				request := httptest.NewRequest(http.MethodPost, "/todos", strings.NewReader(tt.body))
+				request.SetPathValue("todo_id", tt.todoId)
+				request.Header.Set("Authorization", "Bearer "+tt.accessToken)
+				writer := httptest.NewRecorder()
+
+				authenticated(database, todos.Update).ServeHTTP(writer, request)
+
+				assert.Equal(t, tt.responseCode, writer.Code)
+				assert.Equal(t, tt.responseBody, writer.Body.String())
+			})
 		})
 	}
 }
@@ -222,14 +254,14 @@ func TestTodos_UpdateLogic(t *testing.T) {
 			todoId:       fakeTodoId,
 			body:         `{"status":"ongoing"}`,
 			responseCode: http.StatusOK,
-			responseBody: `{"id":"tdo_aaaaaaaaaaaaaaaaaaaaaa","created_by":"test user","description":"first todo","status":"ongoing","updated_at":"2024-06-30T00:00:00+00:00"}`,
+			responseBody: `{"id":"tdo_aaaaaaaaaaaaaaaaaaaaaa","created_by":"test user","description":"first todo","status":"ongoing","updated_at":"2024-06-29T23:59:59Z"}`,
 			databaseLists: map[string][]db.TodoItem{
 				fakeTodoListId: {db.TodoItem{
 					Id:          "static_uuid",
 					Description: "first todo",
 					Status:      "ongoing",
 					UserId:      fakeUserId,
-					UpdatedAt:   util.FakeTime(2024, 6, 30),
+					UpdatedAt:   util.FakeTime(2024, 6, 30).UTC(),
 				}},
 			},
 		},
@@ -238,44 +270,355 @@ func TestTodos_UpdateLogic(t *testing.T) {
 			accessToken:  fakeToken,
 			todoId:       fakeTodoId,
 			body:         `{"status":"done"}`,
-			responseCode: http.StatusBadRequest,
-			responseBody: `{"error":"invalid status transition from todo to done"}`,
+			responseCode: http.StatusUnprocessableEntity,
+			responseBody: problem(http.StatusUnprocessableEntity, "invalid_status_transition", "invalid status transition from todo to done"),
 			databaseLists: map[string][]db.TodoItem{
 				fakeTodoListId: {db.TodoItem{
 					Id:          "static_uuid",
 					Description: "first todo",
 					Status:      "ongoing",
 					UserId:      fakeUserId,
-					UpdatedAt:   util.FakeTime(2000, 1, 1),
+					UpdatedAt:   util.FakeTime(2000, 1, 1).UTC(),
 				}},
 			},
 		},
+		{
+			description:  "Update todo valid transition in custom workflow",
+			accessToken:  fakeToken,
+			workflow:     customWorkflow(),
+			todoId:       fakeTodoId,
+			body:         `{"status":"done"}`,
+			responseCode: http.StatusOK,
+			responseBody: `{"id":"tdo_aaaaaaaaaaaaaaaaaaaaaa","created_by":"test user","description":"first todo","status":"done","updated_at":"2024-06-29T23:59:59Z"}`,
+		},
+		{
+			description:  "Update todo invalid transition in custom workflow",
+			accessToken:  fakeToken,
+			workflow:     customWorkflow(),
+			todoId:       fakeTodoId,
+			body:         `{"status":"ongoing"}`,
+			responseCode: http.StatusUnprocessableEntity,
+			responseBody: problem(http.StatusUnprocessableEntity, "invalid_status_transition", "invalid status transition from todo to ongoing"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.description, func(t *testing.T) {
+			forEachDatabase(t, func() *db.InMemoryDatabase {
+				database := db.TestDatabase(
+					func() time.Time { return util.FakeTime(2024, 6, 30) },
+					func(string) string { return "static_uuid" },
+				)
+				database.Users[fakeUserId] = db.User{Id: fakeUserId, Name: "test user"}
+				database.AccessTokens[fakeToken] = db.AccessToken{UserId: fakeUserId, Token: fakeToken, ExpiresAt: util.FakeTime(2030, 1, 1).UTC()}
+				database.TodoLists[fakeTodoListId] = db.TodoList{Id: fakeTodoListId, OwnerId: fakeUserId, Workflow: tt.workflow}
+				database.TodoItems = map[string]db.TodoItem{
+					fakeTodoId: {Id: fakeTodoId, ListId: fakeTodoListId, Description: "first todo", Status: "todo", UserId: fakeUserId, UpdatedAt: util.FakeTime(2000, 1, 1).UTC()},
+				}
+				return database
+			}, func(t *testing.T, database db.Database, contents func() *db.InMemoryDatabase) {
+				todos := CreateTodos(database)
+
+				request := httptest.NewRequest(http.MethodPost, "/todos", strings.NewReader(tt.body))
+				request.SetPathValue("todo_id", tt.todoId)
+				request.Header.Set("Authorization", "Bearer "+tt.accessToken)
+				writer := httptest.NewRecorder()
+
+				authenticated(database, todos.Update).ServeHTTP(writer, request)
+
+				assert.Equal(t, tt.responseCode, writer.Code)
+				assert.Equal(t, tt.responseBody, writer.Body.String())
+			})
+		})
+	}
+}
+
+type deleteTodoTestCase struct {
+	description   string
+	accessToken   string
+	todoId        string
+	responseCode  int
+	responseBody  string
+	databaseOrder []string
+}
+
+func TestTodos_Delete(t *testing.T) {
+	const fakeOtherTodoId = "tdo_cccccccccccccccccccccc"
+
+	tests := []deleteTodoTestCase{
+		{
+			description:   "Todo Id invalid",
+			accessToken:   fakeToken,
+			todoId:        "not-a-uuid",
+			responseCode:  http.StatusNotFound,
+			responseBody:  problem(http.StatusNotFound, "todo_not_found", "invalid todo"),
+			databaseOrder: []string{fakeTodoId, fakeOtherTodoId},
+		},
+		{
+			description:   "Todo not found",
+			accessToken:   fakeToken,
+			todoId:        fakeWrongTodoId,
+			responseCode:  http.StatusNotFound,
+			responseBody:  problem(http.StatusNotFound, "todo_not_found", "todo not found"),
+			databaseOrder: []string{fakeTodoId, fakeOtherTodoId},
+		},
+		{
+			description:   "Delete todo",
+			accessToken:   fakeToken,
+			todoId:        fakeTodoId,
+			responseCode:  http.StatusNoContent,
+			responseBody:  ``,
+			databaseOrder: []string{fakeOtherTodoId},
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.description, func(t *testing.T) {
-			database := db.TestDatabase(
-				func() time.Time { return util.FakeTime(2024, 6, 30) },
-				func(string) string { return "static_uuid" },
-			)
-			database.Users[fakeUserId] = db.User{Id: fakeUserId, Name: "test user"}
-			database.AccessTokens[fakeToken] = db.AccessToken{UserId: fakeUserId, Token: fakeToken}
-			database.TodoLists[fakeTodoListId] = db.TodoList{Id: fakeTodoListId}
-			database.TodoItems = map[string]db.TodoItem{
-				fakeTodoId: {Id: fakeTodoId, ListId: fakeTodoListId, Description: "first todo", Status: "todo", UserId: fakeUserId, UpdatedAt: util.FakeTime(2000, 1, 1)},
-			}
-
-			todos := CreateTodos(&database)
-
-			request := httptest.NewRequest(http.MethodPost, "/todos", strings.NewReader(tt.body))
-			request.SetPathValue("todo_id", tt.todoId)
-			request.Header.Set("Authorization", tt.accessToken)
-			writer := httptest.NewRecorder()
-
-			todos.Update(writer, request)
-
-			assert.Equal(t, tt.responseCode, writer.Code)
-			assert.Equal(t, tt.responseBody, writer.Body.String())
+			forEachDatabase(t, func() *db.InMemoryDatabase {
+				database := db.TestDatabase(
+					func() time.Time { return util.FakeTime(2024, 6, 30) },
+					func(string) string { return "static_uuid" },
+				)
+				database.Users[fakeUserId] = db.User{Id: fakeUserId, Name: "test user"}
+				database.AccessTokens[fakeToken] = db.AccessToken{UserId: fakeUserId, Token: fakeToken, ExpiresAt: util.FakeTime(2030, 1, 1).UTC()}
+				database.TodoLists[fakeTodoListId] = db.TodoList{Id: fakeTodoListId, OwnerId: fakeUserId}
+				database.TodoItems = map[string]db.TodoItem{
+					fakeTodoId:      {Id: fakeTodoId, ListId: fakeTodoListId, Description: "first todo", Status: "todo", UserId: fakeUserId, UpdatedAt: util.FakeTime(2024, 1, 1).UTC()},
+					fakeOtherTodoId: {Id: fakeOtherTodoId, ListId: fakeTodoListId, Description: "second todo", Status: "todo", UserId: fakeUserId, UpdatedAt: util.FakeTime(2024, 1, 1).UTC()},
+				}
+				database.TodoItemOrder = []string{fakeTodoId, fakeOtherTodoId}
+				return database
+			}, func(t *testing.T, database db.Database, contents func() *db.InMemoryDatabase) {
+				todos := CreateTodos(database)
+
+				request := httptest.NewRequest(http.MethodDelete, "/todos", nil)
+				request.SetPathValue("todo_id", tt.todoId)
+				request.Header.Set("Authorization", "Bearer "+tt.accessToken)
+				writer := httptest.NewRecorder()
+
+				authenticated(database, todos.Delete).ServeHTTP(writer, request)
+
+				assert.Equal(t, tt.responseCode, writer.Code)
+				assert.Equal(t, tt.responseBody, writer.Body.String())
+				assert.Equal(t, tt.databaseOrder, contents().TodoItemOrder)
+				assert.Len(t, contents().TodoItems, len(tt.databaseOrder))
+			})
+		})
+	}
+}
+
+type patchTodoTestCase struct {
+	description  string
+	accessToken  string
+	todoId       string
+	body         string
+	responseCode int
+	responseBody string
+	databaseTodo db.TodoItem
+}
+
+func TestTodos_Patch(t *testing.T) {
+	original := db.TodoItem{Id: fakeTodoId, ListId: fakeTodoListId, Description: "first todo", Status: "todo", UserId: fakeUserId, UpdatedAt: util.FakeTime(2000, 1, 1).UTC()}
+
+	tests := []patchTodoTestCase{
+		{
+			description:  "Invalid body",
+			accessToken:  fakeToken,
+			todoId:       fakeTodoId,
+			body:         `{"invalid":"body"}`,
+			responseCode: http.StatusBadRequest,
+			responseBody: problem(http.StatusBadRequest, "invalid_body", "body not valid"),
+			databaseTodo: original,
+		},
+		{
+			description:  "No fields",
+			accessToken:  fakeToken,
+			todoId:       fakeTodoId,
+			body:         `{}`,
+			responseCode: http.StatusUnprocessableEntity,
+			responseBody: problem(http.StatusUnprocessableEntity, "validation_failed", "validation error", net.InvalidParam{Name: "description", Reason: "required_without"}, net.InvalidParam{Name: "status", Reason: "required_without"}),
+			databaseTodo: original,
+		},
+		{
+			description:  "Description invalid characters",
+			accessToken:  fakeToken,
+			todoId:       fakeTodoId,
+			body:         `{"description":"/"}`,
+			responseCode: http.StatusUnprocessableEntity,
+			responseBody: invalidField("description", "description not valid"),
+			databaseTodo: original,
+		},
+		{
+			description:  "Todo not found",
+			accessToken:  fakeToken,
+			todoId:       fakeWrongTodoId,
+			body:         `{"description":"fixed todo"}`,
+			responseCode: http.StatusNotFound,
+			responseBody: problem(http.StatusNotFound, "todo_not_found", "todo not found"),
+			databaseTodo: original,
+		},
+		{
+			description:  "Invalid transition",
+			accessToken:  fakeToken,
+			todoId:       fakeTodoId,
+			body:         `{"description":"fixed todo","status":"done"}`,
+			responseCode: http.StatusUnprocessableEntity,
+			responseBody: problem(http.StatusUnprocessableEntity, "invalid_status_transition", "invalid status transition from todo to done"),
+			databaseTodo: original,
+		},
+		{
+			description:  "Change description",
+			accessToken:  fakeToken,
+			todoId:       fakeTodoId,
+			body:         `{"description":"fixed todo"}`,
+			responseCode: http.StatusOK,
+			responseBody: `{"id":"tdo_aaaaaaaaaaaaaaaaaaaaaa","created_by":"test user","description":"fixed todo","status":"todo","updated_at":"2024-06-29T23:59:59Z"}`,
+			databaseTodo: db.TodoItem{Id: fakeTodoId, ListId: fakeTodoListId, Description: "fixed todo", Status: "todo", UserId: fakeUserId, UpdatedAt: util.FakeTime(2024, 6, 30).UTC()},
+		},
+		{
+			description:  "Change status",
+			accessToken:  fakeToken,
+			todoId:       fakeTodoId,
+			body:         `{"status":"ongoing"}`,
+			responseCode: http.StatusOK,
+			responseBody: `{"id":"tdo_aaaaaaaaaaaaaaaaaaaaaa","created_by":"test user","description":"first todo","status":"ongoing","updated_at":"2024-06-29T23:59:59Z"}`,
+			databaseTodo: db.TodoItem{Id: fakeTodoId, ListId: fakeTodoListId, Description: "first todo", Status: "ongoing", UserId: fakeUserId, UpdatedAt: util.FakeTime(2024, 6, 30).UTC()},
+		},
+		{
+			description:  "Change description and status",
+			accessToken:  fakeToken,
+			todoId:       fakeTodoId,
+			body:         `{"description":"fixed todo","status":"ongoing"}`,
+			responseCode: http.StatusOK,
+			responseBody: `{"id":"tdo_aaaaaaaaaaaaaaaaaaaaaa","created_by":"test user","description":"fixed todo","status":"ongoing","updated_at":"2024-06-29T23:59:59Z"}`,
+			databaseTodo: db.TodoItem{Id: fakeTodoId, ListId: fakeTodoListId, Description: "fixed todo", Status: "ongoing", UserId: fakeUserId, UpdatedAt: util.FakeTime(2024, 6, 30).UTC()},
+		},
+		{
+			description:  "Unchanged status",
+			accessToken:  fakeToken,
+			todoId:       fakeTodoId,
+			body:         `{"description":"fixed todo","status":"todo"}`,
+			responseCode: http.StatusOK,
+			responseBody: `{"id":"tdo_aaaaaaaaaaaaaaaaaaaaaa","created_by":"test user","description":"fixed todo","status":"todo","updated_at":"2024-06-29T23:59:59Z"}`,
+			databaseTodo: db.TodoItem{Id: fakeTodoId, ListId: fakeTodoListId, Description: "fixed todo", Status: "todo", UserId: fakeUserId, UpdatedAt: util.FakeTime(2024, 6, 30).UTC()},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.description, func(t *testing.T) {
+			forEachDatabase(t, func() *db.InMemoryDatabase {
+				database := db.TestDatabase(
+					func() time.Time { return util.FakeTime(2024, 6, 30) },
+					func(string) string { return "static_uuid" },
+				)
+				database.Users[fakeUserId] = db.User{Id: fakeUserId, Name: "test user"}
+				database.AccessTokens[fakeToken] = db.AccessToken{UserId: fakeUserId, Token: fakeToken, ExpiresAt: util.FakeTime(2030, 1, 1).UTC()}
+				database.TodoLists[fakeTodoListId] = db.TodoList{Id: fakeTodoListId, OwnerId: fakeUserId}
+				database.TodoItems = map[string]db.TodoItem{fakeTodoId: original}
+				return database
+			}, func(t *testing.T, database db.Database, contents func() *db.InMemoryDatabase) {
+				todos := CreateTodos(database)
+
+				request := httptest.NewRequest(http.MethodPatch, "/todos", strings.NewReader(tt.body))
+				request.SetPathValue("todo_id", tt.todoId)
+				request.Header.Set("Authorization", "Bearer "+tt.accessToken)
+				writer := httptest.NewRecorder()
+
+				authenticated(database, todos.Patch).ServeHTTP(writer, request)
+
+				assert.Equal(t, tt.responseCode, writer.Code)
+				assert.Equal(t, tt.responseBody, writer.Body.String())
+				assert.Equal(t, tt.databaseTodo, contents().TodoItems[fakeTodoId])
+			})
+		})
+	}
+}
+
+type authorizeTodoTestCase struct {
+	description  string
+	accessToken  string
+	method       string
+	body         string
+	responseCode int
+	responseBody string
+}
+
+func TestTodos_Authorization(t *testing.T) {
+	tests := []authorizeTodoTestCase{
+		{
+			description:  "Member creates todo",
+			accessToken:  fakeMemberToken,
+			method:       http.MethodPost,
+			body:         fmt.Sprintf(`{"description":"member todo", "todo_list_id":"%s"}`, fakeTodoListId),
+			responseCode: http.StatusOK,
+		},
+		{
+			description:  "Member updates todo",
+			accessToken:  fakeMemberToken,
+			method:       http.MethodPut,
+			body:         `{"status":"ongoing"}`,
+			responseCode: http.StatusOK,
+		},
+		{
+			description:  "Outsider can't create todo",
+			accessToken:  fakeOutsiderToken,
+			method:       http.MethodPost,
+			body:         fmt.Sprintf(`{"description":"outsider todo", "todo_list_id":"%s"}`, fakeTodoListId),
+			responseCode: http.StatusForbidden,
+			responseBody: problem(http.StatusForbidden, "not_a_member", "not a member of this todo list"),
+		},
+		{
+			description:  "Outsider can't update todo",
+			accessToken:  fakeOutsiderToken,
+			method:       http.MethodPut,
+			body:         `{"status":"ongoing"}`,
+			responseCode: http.StatusForbidden,
+			responseBody: problem(http.StatusForbidden, "not_a_member", "not a member of this todo list"),
+		},
+		{
+			description:  "Outsider can't patch todo",
+			accessToken:  fakeOutsiderToken,
+			method:       http.MethodPatch,
+			body:         `{"description":"outsider todo"}`,
+			responseCode: http.StatusForbidden,
+			responseBody: problem(http.StatusForbidden, "not_a_member", "not a member of this todo list"),
+		},
+		{
+			description:  "Outsider can't delete todo",
+			accessToken:  fakeOutsiderToken,
+			method:       http.MethodDelete,
+			responseCode: http.StatusForbidden,
+			responseBody: problem(http.StatusForbidden, "not_a_member", "not a member of this todo list"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.description, func(t *testing.T) {
+			forEachDatabase(t, sharedListFixture, func(t *testing.T, database db.Database, contents func() *db.InMemoryDatabase) {
+				todos := CreateTodos(database)
+
+				request := httptest.NewRequest(tt.method, "/todos", strings.NewReader(tt.body))
+				request.SetPathValue("todo_id", fakeTodoId)
+				request.Header.Set("Authorization", "Bearer "+tt.accessToken)
+				writer := httptest.NewRecorder()
+
+				switch tt.method {
+				case http.MethodPost:
+					authenticated(database, todos.Create).ServeHTTP(writer, request)
+				case http.MethodPut:
+					authenticated(database, todos.Update).ServeHTTP(writer, request)
+				case http.MethodPatch:
+					authenticated(database, todos.Patch).ServeHTTP(writer, request)
+				case http.MethodDelete:
+					authenticated(database, todos.Delete).ServeHTTP(writer, request)
+				}
+
+				assert.Equal(t, tt.responseCode, writer.Code)
+				if tt.responseBody != "" {
+					assert.Equal(t, tt.responseBody, writer.Body.String())
+					assert.Equal(t, sharedListFixture().TodoItems, contents().TodoItems)
+				}
+			})
 		})
 	}
 }
@@ -3,37 +3,67 @@ package routes
 import (
 	"backend/db"
 	"backend/net"
+	"errors"
 	"fmt"
+	"golang.org/x/crypto/bcrypt"
 	"net/http"
 	"regexp"
+	"time"
 )
 
+// Compared against when the user doesn't exist, so a failed login takes as long whether the user exists or not
+var missingUserPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("missing user password"), bcrypt.DefaultCost)
+
 type Users struct {
-	database db.Database
+	database             db.Database
+	tokens               net.Tokens
+	passwordCost         int
+	accessTokenLifetime  time.Duration
+	refreshTokenLifetime time.Duration
 }
 
-func CreateUsers(database db.Database) Users {
-	return Users{database: database}
+func CreateUsers(database db.Database, tokens net.Tokens, accessTokenLifetime time.Duration, refreshTokenLifetime time.Duration) Users {
+	return Users{
+		database:             database,
+		tokens:               tokens,
+		passwordCost:         bcrypt.DefaultCost,
+		accessTokenLifetime:  accessTokenLifetime,
+		refreshTokenLifetime: refreshTokenLifetime,
+	}
 }
 
 func (u *Users) Register(w http.ResponseWriter, r *http.Request) {
 	body, err := net.ParseBody[registerRequest](r)
 	if err != nil {
-		net.HaltBadRequest(w, err.Error())
+		net.HaltError(w, r, err)
 		return
 	}
 
 	if !regexp.MustCompile(userNameRegex).MatchString(body.Name) {
-		net.HaltBadRequest(w, "invalid user name")
+		net.HaltInvalidField(w, "name", "invalid user name")
+		return
+	}
+
+	if len(body.Password) < minPasswordLength || len(body.Password) > maxPasswordLength {
+		net.HaltInvalidField(w, "password", fmt.Sprintf("password must be between %d and %d characters", minPasswordLength, maxPasswordLength))
+		return
+	}
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(body.Password), u.passwordCost)
+	if err != nil {
+		net.HaltInternalServerError(w, r, err)
 		return
 	}
 
-	fmt.Printf("UserId name: %s\n", body.Name)
-	user := u.database.CreateUser(body.Name)
+	user, err := u.database.CreateUser(body.Name, string(passwordHash))
+	if err != nil {
+		net.HaltError(w, r, err)
+		return
+	}
 	response := registerResponse{
 		UserId: user.Id,
 	}
-	fmt.Printf("Created user %s\n", user.Id)
+	net.Logger(r.Context()).Info("Created user", "user_id", user.Id)
 
 	net.Success(w, response)
 }
@@ -41,30 +71,115 @@ func (u *Users) Register(w http.ResponseWriter, r *http.Request) {
 func (u *Users) Login(w http.ResponseWriter, r *http.Request) {
 	body, err := net.ParseBody[loginRequest](r)
 	if err != nil {
-		net.HaltBadRequest(w, err.Error())
+		net.HaltError(w, r, err)
 		return
 	}
 
-	// TODO move into db
-	if !regexp.MustCompile(userIdRegex).MatchString(body.UserId) {
-		net.HaltBadRequest(w, "invalid user id")
+	user, ok := u.authenticate(body.Name, body.Password)
+	if !ok {
+		// Never tell which part was wrong, that would reveal which users exist
+		net.HaltUnauthorized(w, "invalid_credentials", "invalid user name or password")
+		return
+	}
+	// Only told after the password matched, so it doesn't reveal which users exist either
+	if user.Disabled {
+		net.HaltForbidden(w, "account_disabled", "account disabled")
 		return
 	}
 
-	user, err := u.database.GetUser(body.UserId)
+	// Every login starts a new session, so logging out on one device doesn't log out the others
+	net.Logger(r.Context()).Info("Logged in", "user_id", user.Id)
+	u.startSession(w, r, user.Id)
+}
+
+// Refresh exchanges a refresh token for a new session, the old access and refresh token are revoked.
+func (u *Users) Refresh(w http.ResponseWriter, r *http.Request) {
+	body, err := net.ParseBody[refreshRequest](r)
 	if err != nil {
-		net.HaltBadRequest(w, "user not found")
+		net.HaltError(w, r, err)
 		return
 	}
-	// TODO: return existing token if exists
 
-	fmt.Printf("Account number: %s\n", user.Id)
-	accessToken := u.database.CreateAccessToken(user.Id)
-	response := loginResponse{
-		AccessToken: accessToken.Token,
+	refreshToken, err := u.database.GetRefreshToken(body.RefreshToken)
+	if err != nil {
+		net.HaltUnauthorized(w, "invalid_refresh_token", "invalid refresh token")
+		return
+	}
+	if user, err := u.database.GetUser(refreshToken.UserId); err != nil || user.Disabled {
+		net.HaltUnauthorized(w, "invalid_refresh_token", "invalid refresh token")
+		return
 	}
-	// Just for debugging purposes, don't do this in production!
-	fmt.Printf("Created token %s\n", accessToken.Token)
+	// Also deletes the refresh token, only the first of two concurrent refreshes succeeds
+	if err = u.database.DeleteAccessToken(refreshToken.AccessToken); err != nil {
+		net.HaltUnauthorized(w, "invalid_refresh_token", "invalid refresh token")
+		return
+	}
+
+	u.startSession(w, r, refreshToken.UserId)
+}
 
+// Logout revokes the access token of the request and its refresh token.
+func (u *Users) Logout(w http.ResponseWriter, r *http.Request) {
+	// Read from the context, as the Authorization header can hold the token in different forms
+	accessToken, ok := net.AccessTokenFromContext(r.Context())
+	if !ok {
+		net.HaltUnauthorized(w, "not_authenticated", "not authenticated")
+		return
+	}
+
+	// Signed access tokens can't be revoked, so they still work after their session ended. Logging out again is fine.
+	if err := u.database.DeleteAccessToken(accessToken.Token); err != nil && !errors.Is(err, db.ErrInvalidAccessToken) {
+		net.HaltInternalServerError(w, r, err)
+		return
+	}
+
+	net.NoContent(w)
+}
+
+// LogoutAll revokes every access and refresh token of the user, on all devices.
+func (u *Users) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	user, ok := requestUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := u.database.DeleteUserTokens(user.Id); err != nil {
+		net.HaltInternalServerError(w, r, err)
+		return
+	}
+	net.Logger(r.Context()).Info("Logged out all sessions")
+
+	net.NoContent(w)
+}
+
+func (u *Users) startSession(w http.ResponseWriter, r *http.Request, userId string) {
+	accessToken, err := u.tokens.Issue(userId, u.accessTokenLifetime)
+	if err != nil {
+		net.HaltInternalServerError(w, r, err)
+		return
+	}
+	refreshToken, err := u.database.CreateRefreshToken(accessToken, u.refreshTokenLifetime)
+	if err != nil {
+		net.HaltInternalServerError(w, r, err)
+		return
+	}
+	response := loginResponse{
+		AccessToken:  accessToken.Token,
+		RefreshToken: refreshToken.Token,
+		ExpiresAt:    accessToken.ExpiresAt.Format(time.RFC3339),
+	}
 	net.Success(w, response)
 }
+
+// authenticate returns the user with name, as long as the password matches.
+func (u *Users) authenticate(name string, password string) (*db.User, bool) {
+	user, err := u.database.GetUserByName(name)
+	if err != nil || user.PasswordHash == "" {
+		_ = bcrypt.CompareHashAndPassword(missingUserPasswordHash, []byte(password))
+		return nil, false
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		return nil, false
+	}
+	return user, true
+}
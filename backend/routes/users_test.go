@@ -2,9 +2,12 @@ package routes
 
 import (
 	"backend/db"
+	"backend/net"
 	"backend/util"
+	"encoding/json"
 	"fmt"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -25,7 +28,7 @@ func TestUsers_Register(t *testing.T) {
 	tests := []registerTestCase{
 		{
 			description:   "Valid body",
-			body:          `{"name":"myname"}`,
+			body:          `{"name":"myname","password":"correct horse"}`,
 			responseCode:  http.StatusOK,
 			responseBody:  `{"user_id":"static_uuid"}`,
 			databaseUsers: map[string]db.User{"static_uuid": {Id: "static_uuid", Name: "myname"}},
@@ -34,48 +37,91 @@ func TestUsers_Register(t *testing.T) {
 			description:   "Invalid body",
 			body:          `{"invalid":"body"}`,
 			responseCode:  http.StatusBadRequest,
-			responseBody:  `{"error":"body not valid"}`,
+			responseBody:  problem(http.StatusBadRequest, "invalid_body", "body not valid"),
+			databaseUsers: make(map[string]db.User),
+		},
+		{
+			description:   "Missing password",
+			body:          `{"name":"myname"}`,
+			responseCode:  http.StatusUnprocessableEntity,
+			responseBody:  problem(http.StatusUnprocessableEntity, "validation_failed", "validation error", net.InvalidParam{Name: "password", Reason: "required"}),
 			databaseUsers: make(map[string]db.User),
 		},
 		{
 			description:   "UserId name too short",
-			body:          `{"name":"s"}`,
-			responseCode:  http.StatusBadRequest,
-			responseBody:  `{"error":"invalid user name"}`,
+			body:          `{"name":"s","password":"correct horse"}`,
+			responseCode:  http.StatusUnprocessableEntity,
+			responseBody:  invalidField("name", "invalid user name"),
 			databaseUsers: make(map[string]db.User),
 		},
 		{
 			description:   "UserId name invalid character",
-			body:          `{"name":"name-%*("}`,
-			responseCode:  http.StatusBadRequest,
-			responseBody:  `{"error":"invalid user name"}`,
+			body:          `{"name":"name-%*(","password":"correct horse"}`,
+			responseCode:  http.StatusUnprocessableEntity,
+			responseBody:  invalidField("name", "invalid user name"),
 			databaseUsers: make(map[string]db.User),
 		},
 		{
 			description:   "UserId name too long",
-			body:          fmt.Sprintf(`{"name":"%s"}`, strings.Repeat("a", 33)),
-			responseCode:  http.StatusBadRequest,
-			responseBody:  `{"error":"invalid user name"}`,
+			body:          fmt.Sprintf(`{"name":"%s","password":"correct horse"}`, strings.Repeat("a", 33)),
+			responseCode:  http.StatusUnprocessableEntity,
+			responseBody:  invalidField("name", "invalid user name"),
+			databaseUsers: make(map[string]db.User),
+		},
+		{
+			description:   "Password too short",
+			body:          `{"name":"myname","password":"horse"}`,
+			responseCode:  http.StatusUnprocessableEntity,
+			responseBody:  invalidField("password", "password must be between 8 and 72 characters"),
+			databaseUsers: make(map[string]db.User),
+		},
+		{
+			description:   "Password too long",
+			body:          fmt.Sprintf(`{"name":"myname","password":"%s"}`, strings.Repeat("a", 73)),
+			responseCode:  http.StatusUnprocessableEntity,
+			responseBody:  invalidField("password", "password must be between 8 and 72 characters"),
+			databaseUsers: make(map[string]db.User),
+		},
+		{
+			description:   "Name already taken",
+			body:          `{"name":"taken","password":"correct horse"}`,
+			responseCode:  http.StatusConflict,
+			responseBody:  problem(http.StatusConflict, "user_name_taken", "user name already taken"),
 			databaseUsers: make(map[string]db.User),
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.description, func(t *testing.T) {
-			database := db.TestDatabase(
-				func() time.Time { return util.FakeTime(2024, 6, 30) },
-				func(string) string { return "static_uuid" },
-			)
-			users := CreateUsers(&database)
+			forEachDatabase(t, func() *db.InMemoryDatabase {
+				database := db.TestDatabase(
+					func() time.Time { return util.FakeTime(2024, 6, 30) },
+					func(string) string { return "static_uuid" },
+				)
+				database.Users[fakeUserId] = db.User{Id: fakeUserId, Name: "taken", PasswordHash: "hash"}
+				return database
+			}, func(t *testing.T, database db.Database, contents func() *db.InMemoryDatabase) {
+				users := CreateUsers(database, net.CreateDatabaseTokens(database), fakeAccessTokenLifetime, fakeRefreshTokenLifetime)
+				users.passwordCost = bcrypt.MinCost
+
+				request := httptest.NewRequest(http.MethodGet, "/users/register", strings.NewReader(tt.body))
+				writer := httptest.NewRecorder()
 
-			request := httptest.NewRequest(http.MethodGet, "/users/register", strings.NewReader(tt.body))
-			writer := httptest.NewRecorder()
+				users.Register(writer, request)
 
-			users.Register(writer, request)
+				assert.Equal(t, tt.responseCode, writer.Code)
+				assert.Equal(t, tt.responseBody, writer.Body.String())
 
-			assert.Equal(t, tt.responseCode, writer.Code)
-			assert.Equal(t, tt.responseBody, writer.Body.String())
-			assert.Equal(t, tt.databaseUsers, database.Users)
+				// The hash is salted, so only check it matches the password
+				createdUsers := contents().Users
+				delete(createdUsers, fakeUserId)
+				for id, user := range createdUsers {
+					assert.Nil(t, bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(fakePassword)))
+					user.PasswordHash = ""
+					createdUsers[id] = user
+				}
+				assert.Equal(t, tt.databaseUsers, createdUsers)
+			})
 		})
 	}
 }
@@ -89,54 +135,323 @@ type loginTestCase struct {
 }
 
 func TestUsers_Login(t *testing.T) {
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(fakePassword), bcrypt.MinCost)
+	assert.Nil(t, err)
+
 	tests := []loginTestCase{
 		{
 			description:    "Valid body",
-			body:           fmt.Sprintf(`{"user_id":"%s"}`, fakeUserId),
+			body:           `{"name":"myname","password":"correct horse"}`,
 			responseCode:   http.StatusOK,
-			responseBody:   `{"access_token":"static_uuid"}`,
-			databaseTokens: map[string]db.AccessToken{"static_uuid": {UserId: fakeUserId, Token: "static_uuid"}},
+			responseBody:   `{"access_token":"static_uuid","refresh_token":"static_uuid","expires_at":"2021-01-01T00:59:59Z"}`,
+			databaseTokens: map[string]db.AccessToken{"static_uuid": {UserId: fakeUserId, Token: "static_uuid", IssuedAt: util.FakeTime(2021, 1, 1).UTC(), ExpiresAt: util.FakeTime(2021, 1, 1).Add(time.Hour).UTC()}},
 		},
 		{
 			description:    "Invalid body",
 			body:           `{"invalid":"body"}`,
 			responseCode:   http.StatusBadRequest,
-			responseBody:   `{"error":"body not valid"}`,
+			responseBody:   problem(http.StatusBadRequest, "invalid_body", "body not valid"),
 			databaseTokens: make(map[string]db.AccessToken),
 		},
 		{
-			description:    "Account number not a uuid",
-			body:           `{"user_id":"not_a_uuid"}`,
-			responseCode:   http.StatusBadRequest,
-			responseBody:   `{"error":"invalid user id"}`,
+			description:    "Missing password",
+			body:           `{"name":"myname"}`,
+			responseCode:   http.StatusUnprocessableEntity,
+			responseBody:   problem(http.StatusUnprocessableEntity, "validation_failed", "validation error", net.InvalidParam{Name: "password", Reason: "required"}),
+			databaseTokens: make(map[string]db.AccessToken),
+		},
+		{
+			description:    "Wrong password",
+			body:           `{"name":"myname","password":"wrong horse"}`,
+			responseCode:   http.StatusUnauthorized,
+			responseBody:   problem(http.StatusUnauthorized, "invalid_credentials", "invalid user name or password"),
 			databaseTokens: make(map[string]db.AccessToken),
 		},
 		{
 			description:    "Account does not exist",
-			body:           fmt.Sprintf(`{"user_id":"%s"}`, fakeWrongUserId),
-			responseCode:   http.StatusBadRequest,
-			responseBody:   `{"error":"user not found"}`,
+			body:           `{"name":"othername","password":"correct horse"}`,
+			responseCode:   http.StatusUnauthorized,
+			responseBody:   problem(http.StatusUnauthorized, "invalid_credentials", "invalid user name or password"),
+			databaseTokens: make(map[string]db.AccessToken),
+		},
+		{
+			description:    "Account disabled",
+			body:           `{"name":"disabled","password":"correct horse"}`,
+			responseCode:   http.StatusForbidden,
+			responseBody:   problem(http.StatusForbidden, "account_disabled", "account disabled"),
+			databaseTokens: make(map[string]db.AccessToken),
+		},
+		{
+			description:    "Account disabled and wrong password",
+			body:           `{"name":"disabled","password":"wrong horse"}`,
+			responseCode:   http.StatusUnauthorized,
+			responseBody:   problem(http.StatusUnauthorized, "invalid_credentials", "invalid user name or password"),
+			databaseTokens: make(map[string]db.AccessToken),
+		},
+		{
+			description:    "Account without password",
+			body:           `{"name":"legacy","password":"correct horse"}`,
+			responseCode:   http.StatusUnauthorized,
+			responseBody:   problem(http.StatusUnauthorized, "invalid_credentials", "invalid user name or password"),
 			databaseTokens: make(map[string]db.AccessToken),
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.description, func(t *testing.T) {
-			database := db.TestDatabase(
-				func() time.Time { return util.FakeTime(2021, 1, 1) },
-				func(string) string { return "static_uuid" },
-			)
-			database.Users[fakeUserId] = db.User{Id: fakeUserId, Name: "myname"}
-			users := CreateUsers(&database)
+			forEachDatabase(t, func() *db.InMemoryDatabase {
+				database := db.TestDatabase(
+					func() time.Time { return util.FakeTime(2021, 1, 1) },
+					func(string) string { return "static_uuid" },
+				)
+				database.Users[fakeUserId] = db.User{Id: fakeUserId, Name: "myname", PasswordHash: string(passwordHash)}
+				database.Users[fakeMemberUserId] = db.User{Id: fakeMemberUserId, Name: "legacy"}
+				database.Users[fakeOutsiderUserId] = db.User{Id: fakeOutsiderUserId, Name: "disabled", PasswordHash: string(passwordHash), Disabled: true}
+				return database
+			}, func(t *testing.T, database db.Database, contents func() *db.InMemoryDatabase) {
+				users := CreateUsers(database, net.CreateDatabaseTokens(database), fakeAccessTokenLifetime, fakeRefreshTokenLifetime)
 
-			request := httptest.NewRequest(http.MethodGet, "/users/login", strings.NewReader(tt.body))
-			writer := httptest.NewRecorder()
+				request := httptest.NewRequest(http.MethodGet, "/users/login", strings.NewReader(tt.body))
+				writer := httptest.NewRecorder()
 
-			users.Login(writer, request)
+				users.Login(writer, request)
 
-			assert.Equal(t, tt.responseCode, writer.Code)
-			assert.Equal(t, tt.responseBody, writer.Body.String())
-			assert.Equal(t, tt.databaseTokens, database.AccessTokens)
+				assert.Equal(t, tt.responseCode, writer.Code)
+				assert.Equal(t, tt.responseBody, writer.Body.String())
+				assert.Equal(t, tt.databaseTokens, contents().AccessTokens)
+			})
 		})
 	}
 }
+
+// sessionFixture has two sessions of fakeUserId, and one of fakeMemberUserId.
+func sessionFixture() *db.InMemoryDatabase {
+	database := db.TestDatabase(
+		func() time.Time { return util.FakeTime(2024, 6, 30) },
+		func(string) string { return "static_uuid" },
+	)
+	database.Users[fakeUserId] = db.User{Id: fakeUserId, Name: "myname"}
+	database.Users[fakeMemberUserId] = db.User{Id: fakeMemberUserId, Name: "member"}
+	database.AccessTokens[fakeToken] = db.AccessToken{UserId: fakeUserId, Token: fakeToken, ExpiresAt: util.FakeTime(2024, 6, 1).UTC()}
+	database.AccessTokens[fakeOtherSessionToken] = db.AccessToken{UserId: fakeUserId, Token: fakeOtherSessionToken, ExpiresAt: util.FakeTime(2030, 1, 1).UTC()}
+	database.AccessTokens[fakeMemberToken] = db.AccessToken{UserId: fakeMemberUserId, Token: fakeMemberToken, ExpiresAt: util.FakeTime(2030, 1, 1).UTC()}
+	database.RefreshTokens[fakeRefreshToken] = db.RefreshToken{UserId: fakeUserId, Token: fakeRefreshToken, AccessToken: fakeToken, ExpiresAt: util.FakeTime(2030, 1, 1).UTC()}
+	database.RefreshTokens[fakeExpiredRefreshToken] = db.RefreshToken{UserId: fakeUserId, Token: fakeExpiredRefreshToken, AccessToken: fakeOtherSessionToken, ExpiresAt: util.FakeTime(2024, 6, 1).UTC()}
+	return database
+}
+
+type refreshTestCase struct {
+	description           string
+	body                  string
+	responseCode          int
+	responseBody          string
+	databaseTokens        []string
+	databaseRefreshTokens []string
+}
+
+func TestUsers_Refresh(t *testing.T) {
+	tests := []refreshTestCase{
+		{
+			description:           "Invalid body",
+			body:                  `{"invalid":"body"}`,
+			responseCode:          http.StatusBadRequest,
+			responseBody:          problem(http.StatusBadRequest, "invalid_body", "body not valid"),
+			databaseTokens:        []string{fakeToken, fakeOtherSessionToken, fakeMemberToken},
+			databaseRefreshTokens: []string{fakeRefreshToken, fakeExpiredRefreshToken},
+		},
+		{
+			description:           "Unknown refresh token",
+			body:                  `{"refresh_token":"rtk_ffffffffffffffffffffff"}`,
+			responseCode:          http.StatusUnauthorized,
+			responseBody:          problem(http.StatusUnauthorized, "invalid_refresh_token", "invalid refresh token"),
+			databaseTokens:        []string{fakeToken, fakeOtherSessionToken, fakeMemberToken},
+			databaseRefreshTokens: []string{fakeRefreshToken, fakeExpiredRefreshToken},
+		},
+		{
+			description:           "Expired refresh token",
+			body:                  fmt.Sprintf(`{"refresh_token":"%s"}`, fakeExpiredRefreshToken),
+			responseCode:          http.StatusUnauthorized,
+			responseBody:          problem(http.StatusUnauthorized, "invalid_refresh_token", "invalid refresh token"),
+			databaseTokens:        []string{fakeToken, fakeOtherSessionToken, fakeMemberToken},
+			databaseRefreshTokens: []string{fakeRefreshToken, fakeExpiredRefreshToken},
+		},
+		{
+			description:           "Refresh expired access token",
+			body:                  fmt.Sprintf(`{"refresh_token":"%s"}`, fakeRefreshToken),
+			responseCode:          http.StatusOK,
+			responseBody:          `{"access_token":"static_uuid","refresh_token":"static_uuid","expires_at":"2024-06-30T00:59:59Z"}`,
+			databaseTokens:        []string{"static_uuid", fakeOtherSessionToken, fakeMemberToken},
+			databaseRefreshTokens: []string{"static_uuid"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.description, func(t *testing.T) {
+			forEachDatabase(t, sessionFixture, func(t *testing.T, database db.Database, contents func() *db.InMemoryDatabase) {
+				users := CreateUsers(database, net.CreateDatabaseTokens(database), fakeAccessTokenLifetime, fakeRefreshTokenLifetime)
+
+				request := httptest.NewRequest(http.MethodPost, "/users/refresh", strings.NewReader(tt.body))
+				writer := httptest.NewRecorder()
+
+				users.Refresh(writer, request)
+
+				assert.Equal(t, tt.responseCode, writer.Code)
+				assert.Equal(t, tt.responseBody, writer.Body.String())
+				assertTokens(t, tt.databaseTokens, tt.databaseRefreshTokens, contents())
+			})
+		})
+	}
+}
+
+func TestUsers_RefreshDisabledUser(t *testing.T) {
+	forEachDatabase(t, func() *db.InMemoryDatabase {
+		database := sessionFixture()
+		database.Users[fakeUserId] = db.User{Id: fakeUserId, Name: "myname", Disabled: true}
+		return database
+	}, func(t *testing.T, database db.Database, contents func() *db.InMemoryDatabase) {
+		users := CreateUsers(database, net.CreateDatabaseTokens(database), fakeAccessTokenLifetime, fakeRefreshTokenLifetime)
+
+		request := httptest.NewRequest(http.MethodPost, "/users/refresh", strings.NewReader(fmt.Sprintf(`{"refresh_token":"%s"}`, fakeRefreshToken)))
+		writer := httptest.NewRecorder()
+
+		users.Refresh(writer, request)
+
+		assert.Equal(t, http.StatusUnauthorized, writer.Code)
+		assert.Equal(t, problem(http.StatusUnauthorized, "invalid_refresh_token", "invalid refresh token"), writer.Body.String())
+		assertTokens(t, []string{fakeToken, fakeOtherSessionToken, fakeMemberToken}, []string{fakeRefreshToken, fakeExpiredRefreshToken}, contents())
+	})
+}
+
+type logoutTestCase struct {
+	description           string
+	accessToken           string
+	all                   bool
+	responseCode          int
+	responseBody          string
+	databaseTokens        []string
+	databaseRefreshTokens []string
+}
+
+func TestUsers_Logout(t *testing.T) {
+	tests := []logoutTestCase{
+		{
+			description:           "Logout with expired token",
+			accessToken:           fakeToken,
+			responseCode:          http.StatusUnauthorized,
+			responseBody:          problem(http.StatusUnauthorized, "invalid_token", "access token expired"),
+			databaseTokens:        []string{fakeToken, fakeOtherSessionToken, fakeMemberToken},
+			databaseRefreshTokens: []string{fakeRefreshToken, fakeExpiredRefreshToken},
+		},
+		{
+			description:           "Logout current session",
+			accessToken:           fakeOtherSessionToken,
+			responseCode:          http.StatusNoContent,
+			databaseTokens:        []string{fakeToken, fakeMemberToken},
+			databaseRefreshTokens: []string{fakeRefreshToken},
+		},
+		{
+			description:           "Logout all sessions",
+			accessToken:           fakeOtherSessionToken,
+			all:                   true,
+			responseCode:          http.StatusNoContent,
+			databaseTokens:        []string{fakeMemberToken},
+			databaseRefreshTokens: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.description, func(t *testing.T) {
+			forEachDatabase(t, sessionFixture, func(t *testing.T, database db.Database, contents func() *db.InMemoryDatabase) {
+				users := CreateUsers(database, net.CreateDatabaseTokens(database), fakeAccessTokenLifetime, fakeRefreshTokenLifetime)
+
+				request := httptest.NewRequest(http.MethodPost, "/users/logout", nil)
+				request.Header.Set("Authorization", "Bearer "+tt.accessToken)
+				writer := httptest.NewRecorder()
+
+				if tt.all {
+					authenticated(database, users.LogoutAll).ServeHTTP(writer, request)
+				} else {
+					authenticated(database, users.Logout).ServeHTTP(writer, request)
+				}
+
+				assert.Equal(t, tt.responseCode, writer.Code)
+				assert.Equal(t, tt.responseBody, writer.Body.String())
+				assertTokens(t, tt.databaseTokens, tt.databaseRefreshTokens, contents())
+			})
+		})
+	}
+}
+
+func assertTokens(t *testing.T, accessTokens []string, refreshTokens []string, database *db.InMemoryDatabase) {
+	storedAccessTokens := []string{}
+	for token := range database.AccessTokens {
+		storedAccessTokens = append(storedAccessTokens, token)
+	}
+	storedRefreshTokens := []string{}
+	for token := range database.RefreshTokens {
+		storedRefreshTokens = append(storedRefreshTokens, token)
+	}
+	assert.ElementsMatch(t, accessTokens, storedAccessTokens)
+	assert.ElementsMatch(t, refreshTokens, storedRefreshTokens)
+}
+
+func TestUsers_SignedTokens(t *testing.T) {
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(fakePassword), bcrypt.MinCost)
+	assert.Nil(t, err)
+
+	forEachDatabase(t, func() *db.InMemoryDatabase {
+		database := db.TestDatabase(
+			func() time.Time { return util.FakeTime(2021, 1, 1) },
+			util.GenerateRandomUuid,
+		)
+		database.Users[fakeUserId] = db.User{Id: fakeUserId, Name: "myname", PasswordHash: string(passwordHash)}
+		return database
+	}, func(t *testing.T, database db.Database, contents func() *db.InMemoryDatabase) {
+		tokens, err := net.TestSignedTokens(
+			[]net.SigningKey{{Id: "key", Secret: []byte("kkkkkkkkkkkkkkkkkkkkkkkkkkkkkkkk")}},
+			func() time.Time { return util.FakeTime(2021, 1, 1) },
+			util.GenerateRandomUuid,
+		)
+		assert.Nil(t, err)
+		users := CreateUsers(database, tokens, fakeAccessTokenLifetime, fakeRefreshTokenLifetime)
+		users.passwordCost = bcrypt.MinCost
+
+		// Login doesn't store the access token, only the refresh token pointing to it
+		writer := httptest.NewRecorder()
+		users.Login(writer, httptest.NewRequest(http.MethodPost, "/users/login", strings.NewReader(`{"name":"myname","password":"correct horse"}`)))
+		assert.Equal(t, http.StatusOK, writer.Code)
+		var session struct {
+			AccessToken  string `json:"access_token"`
+			RefreshToken string `json:"refresh_token"`
+		}
+		assert.Nil(t, json.Unmarshal(writer.Body.Bytes(), &session))
+		accessToken, err := tokens.Verify(session.AccessToken)
+		assert.Nil(t, err)
+		assert.Equal(t, fakeUserId, accessToken.UserId)
+		assert.Empty(t, contents().AccessTokens)
+		assert.Equal(t, session.AccessToken, contents().RefreshTokens[session.RefreshToken].AccessToken)
+
+		// Refreshing replaces the refresh token
+		writer = httptest.NewRecorder()
+		users.Refresh(writer, httptest.NewRequest(http.MethodPost, "/users/refresh", strings.NewReader(fmt.Sprintf(`{"refresh_token":"%s"}`, session.RefreshToken))))
+		assert.Equal(t, http.StatusOK, writer.Code)
+		assert.Nil(t, json.Unmarshal(writer.Body.Bytes(), &session))
+		assert.Len(t, contents().RefreshTokens, 1)
+
+		// Logging out revokes the refresh token of the session
+		writer = httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, "/users/logout", nil)
+		request.Header.Set("Authorization", "Bearer "+session.AccessToken)
+		net.AuthenticationMiddleware(http.HandlerFunc(users.Logout), tokens, database, false).ServeHTTP(writer, request)
+		assert.Equal(t, http.StatusNoContent, writer.Code)
+		assert.Empty(t, contents().RefreshTokens)
+
+		// The signed access token still works, but its session already ended
+		writer = httptest.NewRecorder()
+		request = httptest.NewRequest(http.MethodPost, "/users/logout", nil)
+		request.Header.Set("Authorization", "Bearer "+session.AccessToken)
+		net.AuthenticationMiddleware(http.HandlerFunc(users.Logout), tokens, database, false).ServeHTTP(writer, request)
+		assert.Equal(t, http.StatusNoContent, writer.Code)
+		assert.Empty(t, writer.Body.String())
+	})
+}
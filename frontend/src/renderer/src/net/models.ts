@@ -1,5 +1,6 @@
 export type RegisterRequest = {
   name: string
+  password: string
 }
 
 export type RegisterResponse = {
@@ -7,25 +8,54 @@ export type RegisterResponse = {
 }
 
 export type LogInRequest = {
-  user_id: string
+  name: string
+  password: string
 }
 
 export type LogInResponse = {
   access_token: string
+  refresh_token: string
+  expires_at: string
 }
 
-// eslint-disable-next-line @typescript-eslint/ban-types
-export type CreateTodoListRequest = {}
+export type CreateTodoListRequest = {
+  title: string
+  description?: string
+}
 
 export type CreateTodoListResponse = {
   todo_list_id: string
 }
 
+export type GetTodoListsResponse = {
+  todo_lists: TodoListSummary[]
+}
+
+export type TodoListSummary = {
+  todo_list_id: string
+  title: string
+  owner_id: string
+  todo_count: number
+  status_counts: Partial<Record<TodoStatus, number>>
+}
+
 export type GetTodoListResponse = {
   todo_list_id: string
+  title: string
+  description: string
+  owner_id: string
+  created_at: string
+  updated_at: string
   todos: TodoItem[]
 }
 
+export type Workflow = {
+  todo_list_id: string
+  initial_status: TodoStatus
+  statuses: TodoStatus[]
+  transitions: Record<TodoStatus, TodoStatus[]>
+}
+
 export type CreateTodoRequest = {
   todo_list_id: string
   description: string
@@ -45,6 +75,19 @@ export type TodoItem = {
 
 export type ErrorResponse = {
   error: string
+  // The code of the problem, absent when the server couldn't be reached
+  code?: string
+}
+
+// Errors of the server follow RFC 7807, the code tells them apart and detail is meant for people
+export type Problem = {
+  type: string
+  title: string
+  status: number
+  detail?: string
+  code: string
+  invalid_params?: { name: string; reason: string }[]
 }
 
-export type TodoStatus = 'todo' | 'ongoing' | 'done'
+// Every todo list has its own workflow, the statuses of the default workflow are 'todo', 'ongoing' and 'done'
+export type TodoStatus = string
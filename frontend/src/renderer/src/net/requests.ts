@@ -6,38 +6,80 @@ import {
   type LogInRequest,
   type CreateTodoListResponse,
   type GetTodoListResponse,
+  type GetTodoListsResponse,
   type TodoItem,
   type CreateTodoRequest,
   type TodoStatus,
   type UpdateTodoRequest,
-  type CreateTodoListRequest
+  type CreateTodoListRequest,
+  type Workflow,
+  type Problem
 } from './models'
 
-export async function createAccount(userName: string): Promise<RegisterResponse | ErrorResponse> {
+export async function createAccount(
+  userName: string,
+  password: string
+): Promise<RegisterResponse | ErrorResponse> {
   if (userName.length < 3) {
     return { error: 'Name must be at least 3 characters long' }
   }
+  if (password.length < 8) {
+    return { error: 'Password must be at least 8 characters long' }
+  }
   return await doRequest<RegisterRequest, RegisterResponse>(
     'http://localhost:8080/users/register',
     'POST',
-    { name: userName }
+    { name: userName, password: password }
   )
 }
 
-export async function logIn(userId: string): Promise<LogInResponse | ErrorResponse> {
+export async function logIn(
+  userName: string,
+  password: string
+): Promise<LogInResponse | ErrorResponse> {
   return await doRequest<LogInRequest, LogInResponse>('http://localhost:8080/users/login', 'POST', {
-    user_id: userId
+    name: userName,
+    password: password
   })
 }
 
+export async function revokeAccessToken(accessToken: string): Promise<void | ErrorResponse> {
+  try {
+    const response = await fetch('http://localhost:8080/users/logout', {
+      method: 'POST',
+      headers: { Authorization: `Bearer ${accessToken}` }
+    })
+    if (!response.ok) {
+      return toErrorResponse(response)
+    }
+  } catch (e) {
+    return { error: 'Server offline?' }
+  }
+}
+
 export async function createTodoList(
-  accessToken: string
+  accessToken: string,
+  title: string
 ): Promise<CreateTodoListResponse | ErrorResponse> {
+  if (title.length < 1) {
+    return { error: 'Title cannot be empty' }
+  }
   return await doRequestWithAuth<CreateTodoListRequest, CreateTodoListResponse>(
     'http://localhost:8080/todolists',
     'POST',
     accessToken,
-    {}
+    { title: title }
+  )
+}
+
+export async function getTodoLists(
+  accessToken: string
+): Promise<GetTodoListsResponse | ErrorResponse> {
+  return await doRequestWithAuth<undefined, GetTodoListsResponse>(
+    'http://localhost:8080/todolists',
+    'GET',
+    accessToken,
+    undefined
   )
 }
 
@@ -53,6 +95,18 @@ export async function getTodoList(
   )
 }
 
+export async function getWorkflow(
+  accessToken: string,
+  listId: string
+): Promise<Workflow | ErrorResponse> {
+  return await doRequestWithAuth<undefined, Workflow>(
+    `http://localhost:8080/todolists/${listId}/workflow`,
+    'GET',
+    accessToken,
+    undefined
+  )
+}
+
 export async function createTodoItem(
   accessToken: string,
   listId: string,
@@ -92,7 +146,7 @@ async function doRequest<T, K>(url: string, method: string, body: T): Promise<K
     if (response.ok) {
       return (await response.json()) as K
     } else {
-      return (await response.json()) as ErrorResponse
+      return toErrorResponse(response)
     }
   } catch (e) {
     return { error: 'Server offline?' }
@@ -109,15 +163,20 @@ async function doRequestWithAuth<T, K>(
     const response = await fetch(url, {
       method: method,
       body: JSON.stringify(body),
-      headers: { Authorization: `${token}` }
+      headers: { Authorization: `Bearer ${token}` }
     })
 
     if (response.ok) {
       return (await response.json()) as K
     } else {
-      return (await response.json()) as ErrorResponse
+      return toErrorResponse(response)
     }
   } catch (e) {
     return { error: 'Server offline?' }
   }
 }
+
+async function toErrorResponse(response: Response): Promise<ErrorResponse> {
+  const problem = (await response.json()) as Problem
+  return { error: problem.detail ?? problem.title, code: problem.code }
+}
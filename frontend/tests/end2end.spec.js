@@ -14,14 +14,16 @@ test('end 2 end test', async () => {
 
   // Login
   await window.getByText('Create Account').isVisible()
-  await window.getByRole('textbox').fill('jeroen')
+  await window.getByPlaceholder('Enter your name').fill('jeroen')
+  await window.getByPlaceholder('Enter your password').fill('correct horse')
   await window.screenshot({ path: 'screenshots/intro.png' })
 
-  await window.getByRole('button').click()
+  await window.getByText('Create account').click()
 
   // Todo lists
   await window.getByText('Choose a list').isVisible()
   await window.screenshot({ path: 'screenshots/lists.png' })
+  await window.getByPlaceholder('new list title').fill('Groceries')
   await window.getByText('create new').click()
 
   // Todo